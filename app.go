@@ -2,15 +2,25 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io/fs"
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"syscall"
 	"time"
 	"unsafe"
 
+	"WebGainInstaller/internal/api"
+	"WebGainInstaller/internal/collector"
+	"WebGainInstaller/internal/engine"
 	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
 	"WebGainInstaller/internal/setup"
+	"WebGainInstaller/internal/support"
+
+	"golang.org/x/sys/windows"
 
 	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -28,20 +38,29 @@ const (
 	mbYesNo       = 0x00000004
 	mbIconError   = 0x00000010
 	mbIconWarning = 0x00000030
+	mbIconInfo    = 0x00000040
 	idYes         = 6
 )
 
 type App struct {
 	ctx              context.Context
 	configFS         fs.FS
+	moduleFS         fs.FS
+	installFS        fs.FS
 	webgainRoot      string
+	setupSource      setup.Source
+	modules          []setup.Module
+	engine           *engine.Engine
+	apiServer        *api.Server
+	collector        *collector.Client
 	hwnd             uintptr
 	skipCloseConfirm bool
 }
 
-func NewApp(configFS fs.FS) *App {
+func NewApp(configFS fs.FS, moduleFS fs.FS) *App {
 	return &App{
 		configFS: configFS,
+		moduleFS: moduleFS,
 	}
 }
 
@@ -94,17 +113,24 @@ func (a *App) RunSetupSteps() {
 	wailsRuntime.EventsEmit(a.ctx, "setup:step", "Preparazione installazione...")
 	time.Sleep(1 * time.Second)
 
+	logOpts := setup.LoggingOptions(a.configFS)
+	logOpts.Dir = setup.PersistentDir("logs")
+
 	root, err := setup.PrepareRoot()
 	if err != nil {
 		logger.Error("Creazione WEBGAINROOT fallita: %v", err)
+		if err := logger.Init("", logOpts); err != nil {
+			log.Printf("Impossibile inizializzare log: %v", err)
+		}
 		a.fatalCorruptError()
 		return
 	}
 	a.webgainRoot = root
 
-	if err := logger.Init(root); err != nil {
+	if err := logger.Init(root, logOpts); err != nil {
 		log.Printf("Impossibile inizializzare log: %v", err)
 	}
+	logger.Info("Log in %s", logger.Path())
 	logger.Info("WEBGAINROOT creata: %s", root)
 	logger.Info("Modalita: %s", func() string {
 		if devMode == "true" {
@@ -113,6 +139,9 @@ func (a *App) RunSetupSteps() {
 		return "produzione"
 	}())
 
+	a.startAPIServer()
+	a.startCollector()
+
 	if devMode == "true" {
 		logger.Info("Apertura Explorer su WEBGAINROOT (dev mode)")
 		exec.Command("explorer", root).Start()
@@ -122,29 +151,127 @@ func (a *App) RunSetupSteps() {
 	time.Sleep(1 * time.Second)
 
 	logger.Info("Avvio verifica moduli...")
-	webgainOnline, err := setup.VerifyModules(a.configFS, a.webgainRoot)
+	source, err := setup.VerifyModules(a.configFS, a.webgainRoot)
 	if err != nil {
 		logger.Error("Verifica moduli fallita: %v", err)
 		a.fatalCorruptError()
 		return
 	}
-	logger.Info("Verifica moduli completata (online=%v)", webgainOnline)
+	a.setupSource = source
+	logger.Info("Verifica moduli completata (origine=%s)", source)
 
 	wailsRuntime.EventsEmit(a.ctx, "setup:step", "Inizializzazione moduli...")
 	time.Sleep(1 * time.Second)
 
 	logger.Info("Avvio inizializzazione moduli...")
-	modules, err := setup.InitModules(a.configFS, a.webgainRoot, webgainOnline)
+	modules, err := setup.InitModules(a.configFS, a.webgainRoot, source)
 	if err != nil {
 		logger.Error("Inizializzazione moduli fallita: %v", err)
 		a.fatalCorruptError()
 		return
 	}
+	a.modules = modules
 	logger.Info("Inizializzazione moduli completata: %d moduli pronti", len(modules))
-	_ = modules
+
+	wailsRuntime.EventsEmit(a.ctx, "setup:step", "Recupero moduli...")
+
+	logger.Info("Avvio recupero moduli...")
+	installFS, err := setup.PrepareModules(a.configFS, a.moduleFS, a.webgainRoot, modules)
+	if err != nil {
+		logger.Error("Recupero moduli fallito: %v", err)
+		a.fatalCorruptError()
+		return
+	}
+	a.installFS = installFS
+	logger.Info("Recupero moduli completato")
 
 	wailsRuntime.EventsEmit(a.ctx, "setup:done", nil)
-	logger.Info("Setup completato")
+	logger.Info("Setup completato, log completo in %s", logger.Path())
+}
+
+// startAPIServer avvia l'API HTTP di stato se abilitata in online.json.
+func (a *App) startAPIServer() {
+	cfg := setup.LoadAPIConfig(a.configFS)
+	if !cfg.Enabled {
+		return
+	}
+	server := api.New(cfg)
+	if err := server.Start(); err != nil {
+		logger.Error("Avvio API di stato fallito: %v", err)
+		return
+	}
+	a.apiServer = server
+}
+
+// startCollector prepara l'invio dei report al collettore di online.json e
+// reinvia in background quelli rimasti in coda dalle esecuzioni precedenti.
+func (a *App) startCollector() {
+	cfg := setup.LoadCollectorConfig(a.configFS)
+	if cfg.URL == "" {
+		return
+	}
+	client, err := setup.NewHTTPClient(a.configFS, 30*time.Second)
+	if err != nil {
+		logger.Error("Collettore report disattivato: %v", err)
+		return
+	}
+	a.collector = collector.New(cfg, client, setup.PersistentDir("outbox"))
+	logger.Info("Collettore report: %s", cfg.URL)
+
+	go func() {
+		if sent, err := a.collector.Flush(); err != nil {
+			logger.Warn("Report in coda non inviati: %v", err)
+		} else if sent > 0 {
+			logger.Info("Inviati %d report in coda al collettore", sent)
+		}
+	}()
+}
+
+// StartInstall avvia l'engine sui moduli preparati in WEBGAINROOT.
+// Gli eventi dell'engine vengono emessi al frontend come engine:<evento>.
+func (a *App) StartInstall() error {
+	if a.installFS == nil {
+		return fmt.Errorf("moduli non ancora preparati")
+	}
+	if a.engine == nil {
+		eng, err := engine.New(a.installFS, a.onEngineEvent)
+		if err != nil {
+			logger.Error("Inizializzazione engine fallita: %v", err)
+			return err
+		}
+		a.engine = eng
+		if devMode == "true" {
+			for _, m := range a.modules {
+				if m.Source == setup.ModuleSourceEmbedded {
+					eng.AllowMissingManifest(m.Name)
+				}
+			}
+		}
+		if a.apiServer != nil {
+			a.apiServer.SetController(api.EngineController{Engine: eng})
+		}
+	}
+
+	go func() {
+		if err := a.engine.Run(); err != nil {
+			logger.Error("Installazione fallita: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (a *App) onEngineEvent(event string, data interface{}) {
+	wailsRuntime.EventsEmit(a.ctx, "engine:"+event, data)
+	if a.apiServer != nil {
+		a.apiServer.Publish(event, data)
+	}
+	if a.collector != nil {
+		if event == "report" {
+			a.collector.SendReport(data)
+		} else {
+			a.collector.SendEvent(event, data)
+		}
+	}
 }
 
 func (a *App) GetEulaText() string {
@@ -161,14 +288,121 @@ func (a *App) fatalCorruptError() {
 	wailsRuntime.EventsEmit(a.ctx, "setup:fatal", nil)
 	time.Sleep(200 * time.Millisecond)
 	title, _ := syscall.UTF16PtrFromString("Installazione Corrotta")
-	msg, _ := syscall.UTF16PtrFromString("L'installazione risulta corrotta, provare a recuperare il pacchetto o contattare il supporto tecnico.")
-	procMessageBoxW.Call(
+	text := "L'installazione risulta corrotta, provare a recuperare il pacchetto o contattare il supporto tecnico."
+	if logPath := logger.Path(); logPath != "" {
+		text += "\n\nLog: " + logPath
+	}
+	text += "\n\nCreare un pacchetto di supporto sul Desktop da allegare alla segnalazione?"
+	msg, _ := syscall.UTF16PtrFromString(text)
+	ret, _, _ := procMessageBoxW.Call(
 		a.getHWND(),
 		uintptr(unsafe.Pointer(msg)),
 		uintptr(unsafe.Pointer(title)),
-		uintptr(mbOK|mbIconError),
+		uintptr(mbYesNo|mbIconError),
 	)
+	if int(ret) == idYes {
+		a.fatalSupportBundle()
+	}
 	logger.Error("Applicazione terminata per errore fatale")
 	logger.Close()
 	wailsRuntime.Quit(a.ctx)
 }
+
+// CreateSupportBundle chiede dove salvare il pacchetto di supporto e lo crea.
+// Restituisce il percorso dell'archivio, o stringa vuota se annullato o fallito.
+func (a *App) CreateSupportBundle() string {
+	dest, err := wailsRuntime.SaveFileDialog(a.ctx, wailsRuntime.SaveDialogOptions{
+		Title:            "Salva pacchetto di supporto",
+		DefaultDirectory: desktopDir(),
+		DefaultFilename:  supportBundleName(),
+		Filters:          []wailsRuntime.FileFilter{{DisplayName: "Archivio ZIP (*.zip)", Pattern: "*.zip"}},
+	})
+	if err != nil || dest == "" {
+		return ""
+	}
+	if err := a.createSupportBundle(dest); err != nil {
+		return ""
+	}
+	return dest
+}
+
+func (a *App) fatalSupportBundle() {
+	dest := filepath.Join(desktopDir(), supportBundleName())
+	text := "Pacchetto di supporto creato:\n" + dest
+	icon := mbIconInfo
+	if err := a.createSupportBundle(dest); err != nil {
+		text = fmt.Sprintf("Impossibile creare il pacchetto di supporto: %v", err)
+		icon = mbIconError
+	}
+	title, _ := syscall.UTF16PtrFromString("Pacchetto di Supporto")
+	msg, _ := syscall.UTF16PtrFromString(text)
+	procMessageBoxW.Call(
+		a.getHWND(),
+		uintptr(unsafe.Pointer(msg)),
+		uintptr(unsafe.Pointer(title)),
+		uintptr(mbOK|icon),
+	)
+}
+
+func (a *App) createSupportBundle(dest string) error {
+	logger.Info("Creazione pacchetto di supporto: %s", dest)
+	err := support.CreateBundle(dest, support.Info{
+		WebgainRoot: a.webgainRoot,
+		Source:      string(a.setupSource),
+		Modules:     a.moduleStatuses(),
+		LogDir:      setup.PersistentDir("logs"),
+		CacheDir:    setup.PersistentDir("cache"),
+		ReportDir:   setup.PersistentDir("reports"),
+	})
+	if err != nil {
+		logger.Error("%v", err)
+		return err
+	}
+	logger.Info("Pacchetto di supporto creato")
+	return nil
+}
+
+// moduleStatuses preferisce lo stato dell'engine; prima dell'installazione legge
+// i moduli preparati in WEBGAINROOT o, se non disponibili, riporta quelli di
+// setup.json come pending.
+func (a *App) moduleStatuses() []module.ModuleStatus {
+	if a.engine != nil {
+		return a.engine.GetModuleStatuses()
+	}
+	var loadErr error
+	if a.installFS != nil {
+		order, err := module.LoadOrder(a.installFS)
+		if err == nil {
+			var modules []*module.Module
+			if modules, err = module.LoadModules(a.installFS, order); err == nil {
+				statuses := make([]module.ModuleStatus, len(modules))
+				for i, m := range modules {
+					statuses[i] = m.ToStatus()
+				}
+				return statuses
+			}
+		}
+		loadErr = err
+	}
+
+	statuses := make([]module.ModuleStatus, len(a.modules))
+	for i, m := range a.modules {
+		statuses[i] = module.ModuleStatus{FolderName: m.Name, Name: m.Name, Status: module.StatusPending}
+		if loadErr != nil {
+			statuses[i].Error = loadErr.Error()
+		}
+	}
+	return statuses
+}
+
+func supportBundleName() string {
+	return "WebGain-supporto-" + time.Now().Format("20060102-150405") + ".zip"
+}
+
+func desktopDir() string {
+	dir, err := windows.KnownFolderPath(windows.FOLDERID_Desktop, 0)
+	if err != nil {
+		return os.TempDir()
+	}
+	return dir
+}
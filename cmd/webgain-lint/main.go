@@ -0,0 +1,46 @@
+// Comando webgain-lint: analizza la configurazione e le cartelle modulo
+// senza installare nulla. Esce con codice 1 se trova errori (o avvisi con -strict).
+//
+//	go run ./cmd/webgain-lint [-strict] [setup.json aggiuntivi...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"WebGainInstaller/internal/lint"
+)
+
+func main() {
+	root := flag.String("root", ".", "cartella radice del repository")
+	setupPath := flag.String("setup", filepath.Join("config", "setup.json"), "setup.json da analizzare, relativo a -root")
+	moduleDir := flag.String("modules", "module", "cartella dei moduli embedded, relativa a -root")
+	repoModuleDir := flag.String("repo-modules", filepath.Join("repo", "module"), "cartella dei moduli pubblicati nel repo, relativa a -root")
+	strict := flag.Bool("strict", false, "considera gli avvisi come errori")
+	flag.Parse()
+
+	opts := lint.Options{
+		SetupFiles:    []string{filepath.Join(*root, *setupPath)},
+		ModuleDir:     filepath.Join(*root, *moduleDir),
+		RepoModuleDir: filepath.Join(*root, *repoModuleDir),
+	}
+	opts.SetupFiles = append(opts.SetupFiles, flag.Args()...)
+
+	problems := lint.Run(opts)
+	errors, warnings := 0, 0
+	for _, p := range problems {
+		fmt.Println(p)
+		if p.Severity == lint.SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	fmt.Printf("%d errori, %d avvisi\n", errors, warnings)
+
+	if errors > 0 || (*strict && warnings > 0) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,98 @@
+// Comando webgain-pack: crea il pacchetto .wgm di una cartella modulo,
+// con manifest (nome, versione, file e SHA-256) generato automaticamente.
+// Con -manifest scrive solo manifest.json nella cartella, usato dall'engine
+// per verificare i file estratti prima di eseguire gli step.
+//
+// Il pacchetto va per default in dist/, non accanto alla cartella: un .wgm
+// nella cartella dei moduli verrebbe installato al posto della cartella.
+//
+//	go run ./cmd/webgain-pack [-version 1.2.0] [-o out.wgm] [-manifest] module/<nome>
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"WebGainInstaller/internal/module"
+)
+
+func main() {
+	version := flag.String("version", "", "versione del pacchetto (default: campo version di command.json)")
+	out := flag.String("o", "", "file di destinazione (default: dist/<cartella>.wgm)")
+	manifestOnly := flag.Bool("manifest", false, "scrive solo manifest.json nella cartella del modulo, senza creare il pacchetto")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "uso: webgain-pack [-version v] [-o file.wgm] [-manifest] <cartella modulo>")
+		os.Exit(2)
+	}
+	srcDir := filepath.Clean(flag.Arg(0))
+	name := filepath.Base(srcDir)
+
+	if *version == "" {
+		data, err := os.ReadFile(filepath.Join(srcDir, "command.json"))
+		if err != nil {
+			fail("impossibile leggere command.json: %v", err)
+		}
+		var cmd module.Command
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			fail("impossibile parsare command.json: %v", err)
+		}
+		*version = cmd.Version
+	}
+	if *version == "" {
+		fail("versione mancante: usare -version o valorizzare version in command.json")
+	}
+
+	if *manifestOnly {
+		manifest, err := module.BuildManifest(os.DirFS(srcDir), name, *version)
+		if err != nil {
+			fail("creazione manifest fallita: %v", err)
+		}
+		data, err := json.MarshalIndent(manifest, "", "    ")
+		if err != nil {
+			fail("%v", err)
+		}
+		dest := filepath.Join(srcDir, module.ManifestFileName)
+		if err := os.WriteFile(dest, data, 0644); err != nil {
+			fail("impossibile scrivere %s: %v", dest, err)
+		}
+		fmt.Printf("%s %s: %d file, %s\n", manifest.Name, manifest.Version, len(manifest.Files), dest)
+		return
+	}
+
+	if *out == "" {
+		*out = filepath.Join("dist", name+module.PackageExt)
+	}
+	if err := os.MkdirAll(filepath.Dir(*out), 0755); err != nil {
+		fail("impossibile creare cartella %s: %v", filepath.Dir(*out), err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fail("impossibile creare %s: %v", *out, err)
+	}
+	manifest, err := module.Pack(os.DirFS(srcDir), name, *version, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*out)
+		fail("creazione pacchetto fallita: %v", err)
+	}
+
+	data, err := os.ReadFile(*out)
+	if err != nil {
+		fail("impossibile rileggere %s: %v", *out, err)
+	}
+	fmt.Printf("%s %s: %d file, %s\n", manifest.Name, manifest.Version, len(manifest.Files), *out)
+	fmt.Printf("sha256 %s\n", module.HashBytes(data))
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "webgain-pack: "+format+"\n", args...)
+	os.Exit(1)
+}
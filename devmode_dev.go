@@ -0,0 +1,9 @@
+//go:build dev
+
+package main
+
+// wails dev compila con il tag dev: la build si comporta come quella di
+// sviluppo di release.bat.
+func init() {
+	devMode = "true"
+}
@@ -3,6 +3,10 @@
 
 export function ConfirmCancel():Promise<boolean>;
 
+export function CreateSupportBundle():Promise<string>;
+
 export function GetEulaText():Promise<string>;
 
 export function RunSetupSteps():Promise<void>;
+
+export function StartInstall():Promise<void>;
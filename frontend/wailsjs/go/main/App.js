@@ -6,6 +6,10 @@ export function ConfirmCancel() {
   return window['go']['main']['App']['ConfirmCancel']();
 }
 
+export function CreateSupportBundle() {
+  return window['go']['main']['App']['CreateSupportBundle']();
+}
+
 export function GetEulaText() {
   return window['go']['main']['App']['GetEulaText']();
 }
@@ -13,3 +17,7 @@ export function GetEulaText() {
 export function RunSetupSteps() {
   return window['go']['main']['App']['RunSetupSteps']();
 }
+
+export function StartInstall() {
+  return window['go']['main']['App']['StartInstall']();
+}
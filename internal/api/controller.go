@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"WebGainInstaller/internal/engine"
+	"WebGainInstaller/internal/logger"
+)
+
+// tailChunk e' la quantita' letta dalla fine del log per volta.
+const tailChunk = 64 << 10
+
+// EngineController adatta un *engine.Engine a Controller: Retry riporta a
+// pending i moduli falliti e rilancia Run in background.
+type EngineController struct {
+	*engine.Engine
+}
+
+func (c EngineController) Cancel() error {
+	if !c.IsRunning() {
+		return fmt.Errorf("nessuna installazione in corso")
+	}
+	c.Engine.Cancel()
+	return nil
+}
+
+func (c EngineController) Retry() error {
+	if err := c.ResetFailed(); err != nil {
+		return err
+	}
+	go func() {
+		if err := c.Run(); err != nil {
+			logger.Error("Nuovo tentativo fallito: %v", err)
+		}
+	}()
+	return nil
+}
+
+// tailLog restituisce le ultime n righe del file di log, leggendo a blocchi
+// dalla fine per non caricare in memoria log di grandi dimensioni.
+func tailLog(path string, n int) ([]string, error) {
+	if path == "" {
+		return nil, fmt.Errorf("log non inizializzato")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("impossibile aprire il log: %w", err)
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	offset := size
+	for offset > 0 && bytes.Count(data, []byte("\n")) <= n {
+		chunk := int64(tailChunk)
+		if offset < chunk {
+			chunk = offset
+		}
+		offset -= chunk
+		buf := make([]byte, chunk)
+		if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		data = append(buf, data...)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i, line := range lines {
+		lines[i] = logger.Redact(strings.TrimRight(line, "\r"))
+	}
+	return lines, nil
+}
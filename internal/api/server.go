@@ -0,0 +1,318 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"WebGainInstaller/internal/engine"
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+	"WebGainInstaller/internal/setup"
+)
+
+// Controller e' cio' che il server espone dell'installazione in corso.
+type Controller interface {
+	GetProgress() engine.ProgressInfo
+	GetModuleStatuses() []module.ModuleStatus
+	IsRunning() bool
+	Cancel() error
+	Retry() error
+}
+
+const (
+	defaultTailLines = 200
+	maxTailLines     = 5000
+	heartbeat        = 15 * time.Second
+	subscriberBuffer = 64
+)
+
+type event struct {
+	name string
+	data []byte
+}
+
+// Server e' il server HTTP locale di stato e controllo. Tutte le richieste
+// devono presentare il token come "Authorization: Bearer <token>" oppure,
+// per EventSource che non puo' impostare header, come parametro ?token=.
+type Server struct {
+	cfg         setup.APIConfig
+	httpServer  *http.Server
+	listener    net.Listener
+	ctrl        Controller
+	subscribers map[chan event]bool
+	mu          sync.Mutex
+}
+
+func New(cfg setup.APIConfig) *Server {
+	s := &Server{
+		cfg:         cfg,
+		subscribers: make(map[chan event]bool),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/progress", s.handleProgress)
+	mux.HandleFunc("/api/modules", s.handleModules)
+	mux.HandleFunc("/api/log", s.handleLog)
+	mux.HandleFunc("/api/cancel", s.handleCancel)
+	mux.HandleFunc("/api/retry", s.handleRetry)
+	mux.HandleFunc("/api/events", s.handleEvents)
+	s.httpServer = &http.Server{Handler: s.authorize(mux), ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// Start apre il listener e serve in background.
+func (s *Server) Start() error {
+	if s.cfg.Token == "" {
+		return fmt.Errorf("api: token obbligatorio")
+	}
+	ln, err := net.Listen("tcp", s.cfg.Bind)
+	if err != nil {
+		return fmt.Errorf("api: impossibile ascoltare su %s: %w", s.cfg.Bind, err)
+	}
+	s.listener = ln
+	if host, _, err := net.SplitHostPort(s.cfg.Bind); err == nil {
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			logger.Warn("API di stato in ascolto su un indirizzo non locale: %s", ln.Addr())
+		}
+	}
+	logger.Info("API di stato in ascolto su http://%s", ln.Addr())
+
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("API di stato terminata: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Addr restituisce l'indirizzo effettivo del listener, utile con porta 0.
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	for ch := range s.subscribers {
+		close(ch)
+		delete(s.subscribers, ch)
+	}
+	s.mu.Unlock()
+	return s.httpServer.Close()
+}
+
+// SetController collega l'installazione da esporre; prima di allora gli
+// endpoint di stato rispondono 503.
+func (s *Server) SetController(ctrl Controller) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ctrl = ctrl
+}
+
+func (s *Server) controller() Controller {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ctrl
+}
+
+// Publish inoltra un evento dell'engine ai client SSE collegati. I client
+// troppo lenti perdono gli eventi invece di bloccare l'installazione.
+func (s *Server) Publish(name string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logger.Warn("API: evento %s non serializzabile: %v", name, err)
+		return
+	}
+	ev := event{name: name, data: []byte(logger.Redact(string(payload)))}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+			logger.Warn("API: richiesta non autorizzata da %s a %s", r.RemoteAddr, r.URL.Path)
+			writeError(w, http.StatusUnauthorized, "token non valido")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type statusResponse struct {
+	Running  bool                  `json:"running"`
+	Progress engine.ProgressInfo   `json:"progress"`
+	Modules  []module.ModuleStatus `json:"modules"`
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	ctrl := s.requireController(w, r, http.MethodGet)
+	if ctrl == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, statusResponse{
+		Running:  ctrl.IsRunning(),
+		Progress: ctrl.GetProgress(),
+		Modules:  ctrl.GetModuleStatuses(),
+	})
+}
+
+func (s *Server) handleProgress(w http.ResponseWriter, r *http.Request) {
+	if ctrl := s.requireController(w, r, http.MethodGet); ctrl != nil {
+		writeJSON(w, http.StatusOK, ctrl.GetProgress())
+	}
+}
+
+func (s *Server) handleModules(w http.ResponseWriter, r *http.Request) {
+	if ctrl := s.requireController(w, r, http.MethodGet); ctrl != nil {
+		writeJSON(w, http.StatusOK, ctrl.GetModuleStatuses())
+	}
+}
+
+func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	lines := defaultTailLines
+	if v := r.URL.Query().Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "parametro lines non valido")
+			return
+		}
+		lines = min(n, maxTailLines)
+	}
+	tail, err := tailLog(logger.Path(), lines)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(strings.Join(tail, "\n")))
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	ctrl := s.requireController(w, r, http.MethodPost)
+	if ctrl == nil {
+		return
+	}
+	logger.Info("API: annullamento richiesto da %s", r.RemoteAddr)
+	if err := ctrl.Cancel(); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"result": "annullamento richiesto"})
+}
+
+func (s *Server) handleRetry(w http.ResponseWriter, r *http.Request) {
+	ctrl := s.requireController(w, r, http.MethodPost)
+	if ctrl == nil {
+		return
+	}
+	logger.Info("API: nuovo tentativo richiesto da %s", r.RemoteAddr)
+	if err := ctrl.Retry(); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"result": "installazione riavviata"})
+}
+
+// handleEvents invia gli eventi dell'engine come Server-Sent Events,
+// con un commento periodico per tenere aperta la connessione.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming non supportato")
+		return
+	}
+
+	ch := make(chan event, subscriberBuffer)
+	s.mu.Lock()
+	s.subscribers[ch] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.subscribers[ch] {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.name, ev.data)
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *Server) requireController(w http.ResponseWriter, r *http.Request, method string) Controller {
+	if !requireMethod(w, r, method) {
+		return nil
+	}
+	ctrl := s.controller()
+	if ctrl == nil {
+		writeError(w, http.StatusServiceUnavailable, "installazione non avviata")
+	}
+	return ctrl
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, "metodo non consentito")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
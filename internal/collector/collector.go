@@ -0,0 +1,337 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/setup"
+)
+
+// SchemaVersion e' la versione del formato Payload, descritto in
+// internal/schema/collector.schema.json.
+const SchemaVersion = 1
+
+const (
+	KindReport = "report"
+	KindEvent  = "event"
+)
+
+// retryDelay e' l'attesa tra i tentativi, moltiplicata per il numero del tentativo.
+var retryDelay = 2 * time.Second
+
+const (
+	maxRetries   = 3
+	maxQueued    = 50
+	eventBuffer  = 256
+	queueFileExt = ".json"
+)
+
+// Payload e' il corpo di ogni POST al collettore. ID resta invariato tra i
+// reinvii dalla coda offline, cosi' il collettore puo' scartare i duplicati.
+type Payload struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	ID            string          `json:"id"`
+	Kind          string          `json:"kind"`
+	Event         string          `json:"event,omitempty"`
+	RunID         string          `json:"runId"`
+	Computer      string          `json:"computer"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Client invia report ed eventi al collettore configurato in online.json.
+// I report non consegnati vengono salvati in queueDir e reinviati da Flush,
+// tipicamente all'esecuzione successiva; gli eventi intermedi sono best-effort.
+type Client struct {
+	cfg      setup.CollectorConfig
+	http     *http.Client
+	queueDir string
+	events   chan Payload
+	flushMu  sync.Mutex
+}
+
+func New(cfg setup.CollectorConfig, client *http.Client, queueDir string) *Client {
+	c := &Client{cfg: cfg, http: client, queueDir: queueDir}
+	if cfg.Events {
+		c.events = make(chan Payload, eventBuffer)
+		go c.sendEvents()
+	}
+	return c
+}
+
+// SendReport salva il report nella coda su disco e lo invia in background
+// con retry, rimuovendolo dalla coda solo a consegna avvenuta (o se rifiutato
+// dal collettore). Se l'applicazione si chiude prima, il report resta in coda
+// e viene inviato da Flush all'avvio successivo.
+func (c *Client) SendReport(report interface{}) error {
+	payload, err := newPayload(KindReport, "", report)
+	if err != nil {
+		return err
+	}
+	path, qerr := c.enqueue(payload)
+	if qerr != nil {
+		logger.Warn("Accodamento report per il collettore fallito, invio senza coda: %v", qerr)
+	}
+	go c.deliver(payload, path)
+	return qerr
+}
+
+// deliver invia un report gia' accodato in path (vuoto se non accodato).
+func (c *Client) deliver(payload Payload, path string) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	err := c.postWithRetry(payload)
+	if err == nil || errors.Is(err, errRejected) {
+		if path != "" {
+			os.Remove(path)
+		}
+	}
+	if err == nil {
+		logger.Info("Report inviato al collettore")
+		return nil
+	}
+	logger.Warn("Invio report al collettore fallito: %v", err)
+	if path != "" && !errors.Is(err, errRejected) {
+		logger.Info("Report in coda in %s per il prossimo avvio", c.queueDir)
+	}
+	return err
+}
+
+// SendEvent accoda un evento intermedio se abilitato da collector.events.
+// Gli eventi non consegnati vengono scartati.
+func (c *Client) SendEvent(name string, data interface{}) {
+	if c.events == nil {
+		return
+	}
+	payload, err := newPayload(KindEvent, name, data)
+	if err != nil {
+		logger.Debug("Evento %s non serializzabile: %v", name, err)
+		return
+	}
+	select {
+	case c.events <- payload:
+	default:
+		logger.Debug("Coda eventi collettore piena, evento %s scartato", name)
+	}
+}
+
+func (c *Client) sendEvents() {
+	for payload := range c.events {
+		if err := c.post(payload); err != nil {
+			logger.Debug("Evento %s non inviato al collettore: %v", payload.Event, err)
+		}
+	}
+}
+
+// Flush reinvia i report accodati, dal piu' vecchio. Si ferma al primo errore
+// temporaneo; i payload rifiutati dal collettore vengono scartati.
+func (c *Client) Flush() (int, error) {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	names, err := c.queued()
+	if err != nil || len(names) == 0 {
+		return 0, err
+	}
+	logger.Info("Invio di %d report in coda al collettore", len(names))
+
+	sent := 0
+	for _, name := range names {
+		path := filepath.Join(c.queueDir, name)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// gia' consegnato da deliver
+			continue
+		}
+		if err != nil {
+			logger.Warn("Report in coda %s illeggibile: %v", name, err)
+			continue
+		}
+		var payload Payload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			logger.Warn("Report in coda %s non valido, rimosso: %v", name, err)
+			os.Remove(path)
+			continue
+		}
+
+		err = c.post(payload)
+		if errors.Is(err, errRejected) {
+			logger.Warn("Report in coda %s rifiutato dal collettore, rimosso: %v", name, err)
+			os.Remove(path)
+			continue
+		}
+		if err != nil {
+			return sent, fmt.Errorf("collettore non raggiungibile: %w", err)
+		}
+		os.Remove(path)
+		sent++
+	}
+	return sent, nil
+}
+
+var errRejected = errors.New("payload rifiutato")
+
+func (c *Client) postWithRetry(payload Payload) error {
+	var lastErr error
+	for i := 0; i < maxRetries; i++ {
+		if i > 0 {
+			time.Sleep(retryDelay * time.Duration(i))
+		}
+		lastErr = c.post(payload)
+		if lastErr == nil || errors.Is(lastErr, errRejected) {
+			return lastErr
+		}
+		logger.Warn("Invio al collettore tentativo %d/%d fallito: %v", i+1, maxRetries, lastErr)
+	}
+	return fmt.Errorf("invio fallito dopo %d tentativi: %w", maxRetries, lastErr)
+}
+
+// post invia un singolo payload. Le risposte 4xx diverse da 408 e 429 sono
+// definitive e restituiscono errRejected.
+func (c *Client) post(payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRejected, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "WebGainInstaller")
+	req.Header.Set("X-WebGain-Payload-Id", payload.ID)
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: HTTP %d", errRejected, resp.StatusCode)
+	}
+	return fmt.Errorf("HTTP %d", resp.StatusCode)
+}
+
+// enqueue salva il payload nella coda e restituisce il percorso del file.
+func (c *Client) enqueue(payload Payload) (string, error) {
+	if err := os.MkdirAll(c.queueDir, 0755); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%020d_%s%s", payload.CreatedAt.UnixNano(), payload.ID, queueFileExt)
+	path := filepath.Join(c.queueDir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+
+	names, err := c.queued()
+	if err != nil {
+		return path, nil
+	}
+	for len(names) > maxQueued {
+		logger.Warn("Coda collettore piena, rimosso il report piu' vecchio %s", names[0])
+		os.Remove(filepath.Join(c.queueDir, names[0]))
+		names = names[1:]
+	}
+	return path, nil
+}
+
+// queued elenca i payload in coda dal piu' vecchio: il nome inizia con il timestamp.
+func (c *Client) queued() ([]string, error) {
+	entries, err := os.ReadDir(c.queueDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), queueFileExt) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func newPayload(kind, event string, data interface{}) (Payload, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Payload{}, fmt.Errorf("payload %s non serializzabile: %w", kind, err)
+	}
+	redacted, err := redactJSON(raw)
+	if err != nil {
+		return Payload{}, fmt.Errorf("payload %s non serializzabile: %w", kind, err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Payload{}, err
+	}
+	computer, _ := os.Hostname()
+	return Payload{
+		SchemaVersion: SchemaVersion,
+		ID:            hex.EncodeToString(id),
+		Kind:          kind,
+		Event:         event,
+		RunID:         logger.RunID(),
+		Computer:      computer,
+		CreatedAt:     time.Now().UTC(),
+		Data:          redacted,
+	}, nil
+}
+
+// redactJSON maschera i segreti nei valori stringa di raw. Il mascheramento
+// avviene sui valori decodificati, cosi' il risultato resta JSON valido anche
+// quando un segreto contiene caratteri con escape.
+func redactJSON(raw []byte) (json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(redactValue(v))
+}
+
+func redactValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case string:
+		return logger.Redact(x)
+	case map[string]interface{}:
+		for k, item := range x {
+			x[k] = redactValue(item)
+		}
+	case []interface{}:
+		for i, item := range x {
+			x[i] = redactValue(item)
+		}
+	}
+	return v
+}
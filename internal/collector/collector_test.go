@@ -0,0 +1,204 @@
+package collector
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/setup"
+)
+
+// collectorServer registra i payload ricevuti e risponde con status.
+type collectorServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	payloads []Payload
+	auth     []string
+}
+
+func newCollectorServer(t *testing.T, status int) *collectorServer {
+	s := &collectorServer{status: status}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("payload non valido: %v", err)
+		}
+		s.mu.Lock()
+		s.payloads = append(s.payloads, p)
+		s.auth = append(s.auth, r.Header.Get("Authorization"))
+		status := s.status
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *collectorServer) received() []Payload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Payload(nil), s.payloads...)
+}
+
+func newTestClient(t *testing.T, url string) *Client {
+	retryDelay = 0
+	cfg := setup.CollectorConfig{URL: url, Token: "tok-123"}
+	return New(cfg, &http.Client{Timeout: 5 * time.Second}, t.TempDir())
+}
+
+// waitQueue attende che la coda contenga n report.
+func waitQueue(t *testing.T, c *Client, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.flushMu.Lock()
+		names, err := c.queued()
+		c.flushMu.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) == n || time.Now().After(deadline) {
+			if len(names) != n {
+				t.Fatalf("coda con %d report, attesi %d", len(names), n)
+			}
+			return names
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSendReportDelivered(t *testing.T) {
+	srv := newCollectorServer(t, http.StatusAccepted)
+	c := newTestClient(t, srv.URL)
+
+	if err := c.SendReport(map[string]string{"status": "completed"}); err != nil {
+		t.Fatal(err)
+	}
+	waitQueue(t, c, 0)
+
+	got := srv.received()
+	if len(got) != 1 {
+		t.Fatalf("ricevuti %d payload, atteso 1", len(got))
+	}
+	if got[0].Kind != KindReport || got[0].SchemaVersion != SchemaVersion || got[0].ID == "" {
+		t.Errorf("payload inatteso: %+v", got[0])
+	}
+	if srv.auth[0] != "Bearer tok-123" {
+		t.Errorf("Authorization = %q", srv.auth[0])
+	}
+}
+
+func TestSendReportQueuedUntilFlush(t *testing.T) {
+	srv := newCollectorServer(t, http.StatusServiceUnavailable)
+	c := newTestClient(t, srv.URL)
+
+	if err := c.SendReport(map[string]string{"status": "error"}); err != nil {
+		t.Fatal(err)
+	}
+	// il report resta in coda dopo i tentativi falliti
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.received()) < maxRetries && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	names := waitQueue(t, c, 1)
+
+	srv.mu.Lock()
+	srv.status = http.StatusOK
+	srv.mu.Unlock()
+	sent, err := c.Flush()
+	if err != nil || sent != 1 {
+		t.Fatalf("Flush = %d, %v; atteso 1, nil", sent, err)
+	}
+	waitQueue(t, c, 0)
+
+	got := srv.received()
+	if first, last := got[0], got[len(got)-1]; first.ID != last.ID {
+		t.Errorf("ID cambiato tra i reinvii: %s, %s (coda %v)", first.ID, last.ID, names)
+	}
+}
+
+func TestFlushDropsRejected(t *testing.T) {
+	srv := newCollectorServer(t, http.StatusBadRequest)
+	c := newTestClient(t, srv.URL)
+
+	payload, err := newPayload(KindReport, "", map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.enqueue(payload); err != nil {
+		t.Fatal(err)
+	}
+	if sent, err := c.Flush(); err != nil || sent != 0 {
+		t.Fatalf("Flush = %d, %v; atteso 0, nil", sent, err)
+	}
+	waitQueue(t, c, 0)
+}
+
+func TestFlushStopsWhenUnreachable(t *testing.T) {
+	srv := newCollectorServer(t, http.StatusOK)
+	c := newTestClient(t, srv.URL)
+	srv.Close()
+
+	payload, err := newPayload(KindReport, "", map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.enqueue(payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Flush(); err == nil {
+		t.Fatal("Flush senza collettore non ha restituito errore")
+	}
+	waitQueue(t, c, 1)
+}
+
+func TestPayloadRedactionKeepsJSONValid(t *testing.T) {
+	secret := `pa"ss\word`
+	logger.AddSecret(secret)
+
+	payload, err := newPayload(KindReport, "", map[string]interface{}{
+		"error": "login con " + secret + " fallito",
+		"steps": []string{secret},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		Error string   `json:"error"`
+		Steps []string `json:"steps"`
+	}
+	if err := json.Unmarshal(payload.Data, &data); err != nil {
+		t.Fatalf("payload non valido: %v", err)
+	}
+	if data.Error != "login con *** fallito" || data.Steps[0] != "***" {
+		t.Errorf("segreto non mascherato: %+v", data)
+	}
+}
+
+func TestEnqueueKeepsMaxQueued(t *testing.T) {
+	c := newTestClient(t, "http://127.0.0.1:0")
+	for i := 0; i < maxQueued+3; i++ {
+		payload, err := newPayload(KindReport, "", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.enqueue(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(c.queueDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != maxQueued {
+		t.Errorf("coda con %d report, attesi %d", len(entries), maxQueued)
+	}
+}
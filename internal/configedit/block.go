@@ -0,0 +1,106 @@
+package configedit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BlockMarkers restituisce le righe che delimitano il blocco gestito name,
+// precedute dal carattere di commento del file (# per PowerShell e bash,
+// REM per cmd).
+func BlockMarkers(name, comment string) (begin, end string) {
+	return comment + " >>> webgain:" + name + " >>>", comment + " <<< webgain:" + name + " <<<"
+}
+
+// findBlock restituisce le righe di inizio e fine del blocco, -1 se assente.
+func findBlock(lines []string, begin, end string) (int, int, error) {
+	start := -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case begin:
+			if start >= 0 {
+				return 0, 0, fmt.Errorf("blocco %q aperto due volte", begin)
+			}
+			start = i
+		case end:
+			if start < 0 {
+				return 0, 0, fmt.Errorf("fine blocco %q senza inizio", end)
+			}
+			return start, i, nil
+		}
+	}
+	if start >= 0 {
+		return 0, 0, fmt.Errorf("blocco %q non chiuso", begin)
+	}
+	return -1, -1, nil
+}
+
+// SetBlock inserisce in text il blocco gestito name con content, sostituendo
+// quello esistente. Se il blocco manca ma text contiene legacy (il contenuto
+// aggiunto senza marcatori dalle versioni precedenti) lo sostituisce, cosi'
+// non resta duplicato. I fine riga di text sono mantenuti.
+func SetBlock(text, name, comment, content, legacy string) (string, error) {
+	crlf := strings.Contains(text, "\r\n")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	content = strings.TrimRight(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	legacy = strings.ReplaceAll(legacy, "\r\n", "\n")
+
+	begin, end := BlockMarkers(name, comment)
+	block := begin + "\n" + comment + " Gestito da WebGain Installer: le modifiche al blocco verranno sovrascritte.\n" + content + "\n" + end
+
+	lines := strings.Split(text, "\n")
+	start, stop, err := findBlock(lines, begin, end)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case start >= 0:
+		lines = append(lines[:start:start], append([]string{block}, lines[stop+1:]...)...)
+		text = strings.Join(lines, "\n")
+	case legacy != "" && strings.Contains(text, legacy):
+		text = strings.Replace(text, legacy, block, 1)
+	default:
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		if strings.TrimSpace(text) != "" {
+			text += "\n"
+		}
+		text += block + "\n"
+	}
+	if crlf {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	return text, nil
+}
+
+// RemoveBlock elimina il blocco gestito name e la riga vuota che lo separava
+// dal resto del file. Restituisce false se il blocco non c'era.
+func RemoveBlock(text, name, comment string) (string, bool, error) {
+	crlf := strings.Contains(text, "\r\n")
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	begin, end := BlockMarkers(name, comment)
+	start, stop, err := findBlock(lines, begin, end)
+	if err != nil || start < 0 {
+		return text, false, err
+	}
+	stop++
+	if start > 0 && strings.TrimSpace(lines[start-1]) == "" && (stop == len(lines) || strings.TrimSpace(lines[stop]) == "") {
+		start--
+	}
+	text = strings.Join(append(lines[:start:start], lines[stop:]...), "\n")
+	if crlf {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	return text, true, nil
+}
+
+// HasBlocks indica se text contiene ancora blocchi gestiti.
+func HasBlocks(text, comment string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), comment+" >>> webgain:") {
+			return true
+		}
+	}
+	return false
+}
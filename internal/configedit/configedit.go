@@ -0,0 +1,219 @@
+package configedit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Formati di file supportati.
+const (
+	JSON = "json"
+	INI  = "ini"
+	XML  = "xml"
+	YAML = "yaml"
+)
+
+// Azioni di modifica (set se vuota). merge e' ammessa solo per JSON.
+const (
+	ActionSet    = "set"
+	ActionMerge  = "merge"
+	ActionDelete = "delete"
+)
+
+// Edit descrive una modifica puntuale a un file di configurazione.
+type Edit struct {
+	Action string
+	// Path e' un percorso JSON/YAML ($.a.b, items[0], ["chiave.con.punti"])
+	// o un XPath semplificato (/a/b[@k='v']/@attr). Non usato per INI.
+	Path string
+	// Section e Key identificano la chiave INI; Section vuota indica le chiavi
+	// prima della prima sezione (es. .npmrc).
+	Section string
+	Key     string
+	// Value e' scritto come stringa; Raw, se presente, e' un valore letterale
+	// nel formato del file (JSON o YAML inline) e ha la precedenza.
+	Value string
+	Raw   string
+}
+
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Apply applica e al contenuto data di un file nel formato indicato e
+// restituisce il nuovo contenuto. Commenti, ordine delle chiavi, indentazione,
+// BOM e fine riga (CRLF o LF) del resto del file restano invariati. data vuoto
+// indica un file assente, che viene creato.
+func Apply(format string, data []byte, e Edit) ([]byte, error) {
+	if err := Validate(format, e); err != nil {
+		return nil, err
+	}
+	hasBOM := bytes.HasPrefix(data, bom)
+	data = bytes.TrimPrefix(data, bom)
+	crlf := bytes.Contains(data, []byte("\r\n"))
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	created := strings.TrimSpace(text) == ""
+
+	var out string
+	var err error
+	switch format {
+	case JSON:
+		out, err = editJSON(text, e)
+	case INI:
+		out, err = editINI(text, e)
+	case XML:
+		out, err = editXML(text, e)
+	case YAML:
+		out, err = editYAML(text, e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if out == text {
+		return append(bomPrefix(hasBOM), data...), nil
+	}
+	if created && !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	if crlf {
+		out = strings.ReplaceAll(out, "\n", "\r\n")
+	}
+	return append(bomPrefix(hasBOM), out...), nil
+}
+
+func bomPrefix(has bool) []byte {
+	if has {
+		return append([]byte(nil), bom...)
+	}
+	return nil
+}
+
+// Validate controlla la modifica senza leggere il file.
+func Validate(format string, e Edit) error {
+	switch e.Action {
+	case "", ActionSet, ActionDelete:
+	case ActionMerge:
+		if format != JSON {
+			return fmt.Errorf("azione merge ammessa solo per file JSON")
+		}
+		if e.Raw == "" {
+			return fmt.Errorf("azione merge richiede content con un oggetto JSON")
+		}
+	default:
+		return fmt.Errorf("azione sconosciuta: %s (ammesse: set, merge, delete)", e.Action)
+	}
+
+	switch format {
+	case JSON:
+		if e.Section != "" || e.Key != "" {
+			return fmt.Errorf("section e key ammessi solo per file INI")
+		}
+		segs, err := ParsePath(e.Path)
+		if err != nil {
+			return err
+		}
+		if len(segs) == 0 && e.Action != ActionMerge {
+			return fmt.Errorf("path obbligatorio")
+		}
+		if e.Raw != "" {
+			n, err := parseJSON(e.Raw)
+			if err != nil {
+				return fmt.Errorf("content non e' JSON valido: %w", err)
+			}
+			if e.Action == ActionMerge && n.kind != '{' {
+				return fmt.Errorf("azione merge richiede content con un oggetto JSON")
+			}
+		}
+	case YAML:
+		if e.Section != "" || e.Key != "" {
+			return fmt.Errorf("section e key ammessi solo per file INI")
+		}
+		segs, err := ParsePath(e.Path)
+		if err != nil {
+			return err
+		}
+		if len(segs) == 0 {
+			return fmt.Errorf("path obbligatorio")
+		}
+		for _, seg := range segs {
+			if !seg.IsKey {
+				return fmt.Errorf("path YAML: indici di lista non supportati")
+			}
+		}
+		if strings.Contains(e.Raw, "\n") {
+			return fmt.Errorf("content YAML deve essere un valore su una riga (es. true, 8080, [a, b])")
+		}
+	case INI:
+		if e.Path != "" || e.Raw != "" {
+			return fmt.Errorf("path e content non ammessi per file INI: usare section, key e value")
+		}
+		if e.Key == "" && e.Action != ActionDelete {
+			return fmt.Errorf("key obbligatoria per file INI")
+		}
+		if strings.ContainsAny(e.Key, "=\n") || strings.ContainsAny(e.Section, "[]\n") {
+			return fmt.Errorf("section o key INI non valida")
+		}
+		if strings.Contains(e.Value, "\n") {
+			return fmt.Errorf("valore INI su piu' righe non supportato")
+		}
+	case XML:
+		if e.Section != "" || e.Key != "" || e.Raw != "" {
+			return fmt.Errorf("section, key e content non ammessi per file XML")
+		}
+		if _, err := parseXPath(e.Path); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("formato sconosciuto: %s", format)
+	}
+	return nil
+}
+
+// lineStart restituisce l'inizio della riga che contiene pos.
+func lineStart(s string, pos int) int {
+	return strings.LastIndexByte(s[:pos], '\n') + 1
+}
+
+// lineIndent restituisce gli spazi iniziali della riga che contiene pos.
+func lineIndent(s string, pos int) string {
+	start := lineStart(s, pos)
+	end := start
+	for end < len(s) && (s[end] == ' ' || s[end] == '\t') {
+		end++
+	}
+	return s[start:end]
+}
+
+// onlySpaceBefore indica se pos e' preceduto solo da spazi sulla sua riga.
+func onlySpaceBefore(s string, pos int) bool {
+	return strings.TrimLeft(s[lineStart(s, pos):pos], " \t") == ""
+}
+
+// removeSpan rimuove s[start:end]; se la parte rimossa occupava righe intere
+// elimina anche l'indentazione e il fine riga, senza lasciare righe vuote.
+func removeSpan(s string, start, end int) string {
+	if onlySpaceBefore(s, start) {
+		rest := end
+		for rest < len(s) && (s[rest] == ' ' || s[rest] == '\t') {
+			rest++
+		}
+		if rest == len(s) || s[rest] == '\n' {
+			start = lineStart(s, start)
+			end = rest
+			if end < len(s) {
+				end++
+			} else if start > 0 {
+				start--
+			}
+		}
+	}
+	return s[:start] + s[end:]
+}
+
+// indentUnit restituisce l'indentazione di un livello usata da child rispetto
+// a parent, o def se non ricavabile.
+func indentUnit(parent, child, def string) string {
+	if strings.HasPrefix(child, parent) && len(child) > len(parent) {
+		return child[len(parent):]
+	}
+	return def
+}
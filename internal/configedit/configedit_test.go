@@ -0,0 +1,261 @@
+package configedit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		in     string
+		edit   Edit
+		want   string
+	}{
+		{
+			name:   "jsonc set con commenti e virgole finali",
+			format: JSON,
+			in: `{
+    // dimensione tab
+    "editor.tabSize": 2, // commento a fine riga
+    "files.exclude": {
+        "**/.git": true,
+    },
+}
+`,
+			edit: Edit{Path: `$["editor.tabSize"]`, Raw: "4"},
+			want: `{
+    // dimensione tab
+    "editor.tabSize": 4, // commento a fine riga
+    "files.exclude": {
+        "**/.git": true,
+    },
+}
+`,
+		},
+		{
+			name:   "jsonc aggiunta dopo virgola finale",
+			format: JSON,
+			in: `{
+    /* impostazioni */
+    "a": 1,
+}
+`,
+			edit: Edit{Path: "$.b.c", Value: "x"},
+			want: `{
+    /* impostazioni */
+    "a": 1,
+    "b": {
+        "c": "x"
+    }
+}
+`,
+		},
+		{
+			name:   "jsonc delete con commento a fine riga",
+			format: JSON,
+			in: `{
+    "a": 1, // da togliere
+    "b": 2,
+}
+`,
+			edit: Edit{Action: ActionDelete, Path: "$.a"},
+			want: `{
+    "b": 2,
+}
+`,
+		},
+		{
+			name:   "merge in JSON compatto",
+			format: JSON,
+			in:     `{"a":1,"b":{"c":2}}`,
+			edit:   Edit{Action: ActionMerge, Raw: `{"b": {"d": 3}, "e": [1, 2]}`},
+			want:   `{"a":1,"b":{"c":2,"d":3},"e":[1,2]}`,
+		},
+		{
+			name:   "merge in JSON compatto con oggetto vuoto",
+			format: JSON,
+			in:     `{"a":{}, "b":true}`,
+			edit:   Edit{Action: ActionMerge, Raw: `{"a": {"x": {"y": 1}}}`},
+			want:   `{"a":{"x":{"y":1}}, "b":true}`,
+		},
+		{
+			name:   "merge in JSON indentato",
+			format: JSON,
+			in:     "{\n  \"a\": 1\n}\n",
+			edit:   Edit{Action: ActionMerge, Raw: `{"a": 2, "b": {"c": true}}`},
+			want:   "{\n  \"a\": 2,\n  \"b\": {\n    \"c\": true\n  }\n}\n",
+		},
+		{
+			name:   "json file creato",
+			format: JSON,
+			in:     "",
+			edit:   Edit{Path: "$.a", Raw: "1"},
+			want:   "{\n    \"a\": 1\n}\n",
+		},
+		{
+			name:   "npmrc set chiave esistente",
+			format: INI,
+			in:     "registry=https://registry.npmjs.org/\nsave-exact=true\n",
+			edit:   Edit{Key: "registry", Value: "https://npm.example.com/"},
+			want:   "registry=https://npm.example.com/\nsave-exact=true\n",
+		},
+		{
+			name:   "npmrc set chiave nuova",
+			format: INI,
+			in:     "registry=https://registry.npmjs.org/\n",
+			edit:   Edit{Key: "always-auth", Value: "true"},
+			want:   "registry=https://registry.npmjs.org/\nalways-auth=true\n",
+		},
+		{
+			name:   "npmrc delete",
+			format: INI,
+			in:     "registry=https://registry.npmjs.org/\nsave-exact=true\n",
+			edit:   Edit{Action: ActionDelete, Key: "registry"},
+			want:   "save-exact=true\n",
+		},
+		{
+			name:   "ini set in sezione con tab",
+			format: INI,
+			in:     "[core]\n\tautocrlf = true\n[user]\n\tname = dev\n",
+			edit:   Edit{Section: "user", Key: "email", Value: "dev@example.com"},
+			want:   "[core]\n\tautocrlf = true\n[user]\n\tname = dev\n\temail = dev@example.com\n",
+		},
+		{
+			name:   "ini sezione nuova",
+			format: INI,
+			in:     "; configurazione\n[core]\nautocrlf = true\n",
+			edit:   Edit{Section: `remote "origin"`, Key: "url", Value: "https://example.com/repo.git"},
+			want:   "; configurazione\n[core]\nautocrlf = true\n\n[remote \"origin\"]\nurl = https://example.com/repo.git\n",
+		},
+		{
+			name:   "ini delete sezione",
+			format: INI,
+			in:     "[a]\nx = 1\n\n[b]\ny = 2\n",
+			edit:   Edit{Action: ActionDelete, Section: "b"},
+			want:   "[a]\nx = 1\n",
+		},
+		{
+			name:   "xml aggiunta elemento con attributo",
+			format: XML,
+			in: `<?xml version="1.0" encoding="utf-8"?>
+<configuration>
+  <packageSources>
+    <add key="nuget.org" value="https://api.nuget.org/v3/index.json" />
+  </packageSources>
+</configuration>
+`,
+			edit: Edit{Path: "/configuration/packageSources/add[@key='interno']/@value", Value: "https://nuget.example.com/"},
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<configuration>
+  <packageSources>
+    <add key="nuget.org" value="https://api.nuget.org/v3/index.json" />
+    <add key="interno" value="https://nuget.example.com/" />
+  </packageSources>
+</configuration>
+`,
+		},
+		{
+			name:   "xml modifica attributo",
+			format: XML,
+			in:     "<configuration>\n  <add key=\"a\" value=\"1\" />\n</configuration>\n",
+			edit:   Edit{Path: "/configuration/add[@key='a']/@value", Value: "2 & 3"},
+			want:   "<configuration>\n  <add key=\"a\" value=\"2 &amp; 3\" />\n</configuration>\n",
+		},
+		{
+			name:   "xml modifica testo",
+			format: XML,
+			in:     "<settings>\n  <proxy>old</proxy>\n</settings>\n",
+			edit:   Edit{Path: "/settings/proxy", Value: "http://proxy:8080"},
+			want:   "<settings>\n  <proxy>http://proxy:8080</proxy>\n</settings>\n",
+		},
+		{
+			name:   "xml delete elemento",
+			format: XML,
+			in:     "<configuration>\n  <add key=\"a\" />\n  <add key=\"b\" />\n</configuration>\n",
+			edit:   Edit{Action: ActionDelete, Path: "/configuration/add[@key='a']"},
+			want:   "<configuration>\n  <add key=\"b\" />\n</configuration>\n",
+		},
+		{
+			name:   "yaml set annidato",
+			format: YAML,
+			in:     "# config\nserver:\n  port: 80 # porta\n",
+			edit:   Edit{Path: "$.server.port", Raw: "8080"},
+			want:   "# config\nserver:\n  port: 8080 # porta\n",
+		},
+		{
+			name:   "yaml set chiavi mancanti",
+			format: YAML,
+			in:     "server:\n  port: 80\n",
+			edit:   Edit{Path: "$.server.tls.enabled", Raw: "true"},
+			want:   "server:\n  port: 80\n  tls:\n    enabled: true\n",
+		},
+		{
+			name:   "yaml stringa da quotare",
+			format: YAML,
+			in:     "a: 1\n",
+			edit:   Edit{Path: "$.b", Value: "yes"},
+			want:   "a: 1\nb: \"yes\"\n",
+		},
+		{
+			name:   "yaml delete annidato",
+			format: YAML,
+			in:     "server:\n  port: 80\n  tls:\n    enabled: true\nlog: info\n",
+			edit:   Edit{Action: ActionDelete, Path: "$.server.tls"},
+			want:   "server:\n  port: 80\nlog: info\n",
+		},
+		{
+			name:   "CRLF e BOM conservati",
+			format: INI,
+			in:     "\ufeffa=1\r\nb=2\r\n",
+			edit:   Edit{Key: "b", Value: "3"},
+			want:   "\ufeffa=1\r\nb=3\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.format, []byte(tt.in), tt.edit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("risultato:\n%s\natteso:\n%s", got, tt.want)
+			}
+			// riapplicare la stessa modifica non cambia il file
+			again, err := Apply(tt.format, got, tt.edit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(again) != string(got) {
+				t.Errorf("seconda applicazione non idempotente:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		edit   Edit
+		want   string
+	}{
+		{"merge su INI", INI, Edit{Action: ActionMerge, Raw: "{}"}, "solo per file JSON"},
+		{"merge non oggetto", JSON, Edit{Action: ActionMerge, Raw: "[1]"}, "oggetto JSON"},
+		{"azione sconosciuta", JSON, Edit{Action: "append", Path: "$.a"}, "azione sconosciuta"},
+		{"path JSON vuoto", JSON, Edit{Value: "x"}, "path obbligatorio"},
+		{"indice in YAML", YAML, Edit{Path: "$.a[0]", Value: "x"}, "indici di lista"},
+		{"INI senza key", INI, Edit{Value: "x"}, "key obbligatoria"},
+		{"XPath relativo", XML, Edit{Path: "a/b"}, "XPath non valido"},
+		{"formato sconosciuto", "toml", Edit{}, "formato sconosciuto"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.format, tt.edit)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("errore = %v, atteso %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package configedit
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	iniSection = regexp.MustCompile(`^\s*\[([^\]]*)\]\s*(?:[;#].*)?$`)
+	iniKey     = regexp.MustCompile(`^(\s*)([^=;#\[\s][^=]*?)(\s*)=(\s*)(.*)$`)
+)
+
+// iniSectionName normalizza il nome di una sezione per il confronto:
+// [remote "origin"] e [Remote  "origin"] sono la stessa sezione.
+func iniSectionName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// iniRange restituisce le righe della sezione: header e' -1 per le chiavi
+// prima della prima sezione, o se la sezione non esiste (found false).
+func iniRange(lines []string, section string) (header, end int, found bool) {
+	want := iniSectionName(section)
+	header = -1
+	found = want == ""
+	for i, line := range lines {
+		m := iniSection.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if found {
+			return header, i, true
+		}
+		if iniSectionName(m[1]) == want {
+			header, found = i, true
+		}
+	}
+	if !found {
+		return -1, len(lines), false
+	}
+	return header, len(lines), true
+}
+
+func editINI(text string, e Edit) (string, error) {
+	lines := strings.Split(text, "\n")
+	header, end, found := iniRange(lines, e.Section)
+
+	if e.Action == ActionDelete {
+		if !found {
+			return text, nil
+		}
+		if e.Key == "" {
+			if header < 0 {
+				return text, nil
+			}
+			if end < len(lines) {
+				return strings.Join(append(lines[:header:header], lines[end:]...), "\n"), nil
+			}
+			// Ultima sezione: rimuove anche le righe vuote che la precedevano.
+			for header > 0 && strings.TrimSpace(lines[header-1]) == "" {
+				header--
+			}
+			return strings.Join(append(lines[:header:header], ""), "\n"), nil
+		}
+		for i := header + 1; i < end; i++ {
+			if m := iniKey.FindStringSubmatch(lines[i]); m != nil && strings.EqualFold(m[2], e.Key) {
+				return strings.Join(append(lines[:i:i], lines[i+1:]...), "\n"), nil
+			}
+		}
+		return text, nil
+	}
+
+	if found {
+		for i := header + 1; i < end; i++ {
+			m := iniKey.FindStringSubmatch(lines[i])
+			if m == nil || !strings.EqualFold(m[2], e.Key) {
+				continue
+			}
+			lines[i] = m[1] + m[2] + m[3] + "=" + m[4] + e.Value
+			return strings.Join(lines, "\n"), nil
+		}
+	}
+
+	indent, sep := iniStyle(lines, header, end, e.Section == "")
+	entry := indent + e.Key + sep + e.Value
+	if !found {
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		if strings.TrimSpace(text) != "" && !strings.HasSuffix(text, "\n\n") {
+			text += "\n"
+		}
+		return text + "[" + e.Section + "]\n" + entry + "\n", nil
+	}
+
+	// Inserisce dopo l'ultima riga non vuota della sezione.
+	at := end
+	for at > header+1 && strings.TrimSpace(lines[at-1]) == "" {
+		at--
+	}
+	lines = append(lines[:at], append([]string{entry}, lines[at:]...)...)
+	return strings.Join(lines, "\n"), nil
+}
+
+// iniStyle ricava indentazione e separatore dalle chiavi esistenti, preferendo
+// quelle della stessa sezione (git config usa il tab, .npmrc "chiave=valore").
+func iniStyle(lines []string, header, end int, global bool) (indent, sep string) {
+	sep = " = "
+	if global {
+		sep = "="
+	}
+	found := false
+	for i, line := range lines {
+		m := iniKey.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if i > header && i < end {
+			return m[1], m[3] + "=" + m[4]
+		}
+		if !found {
+			indent, sep, found = m[1], m[3]+"="+m[4], true
+		}
+	}
+	if global {
+		indent = ""
+	}
+	return indent, sep
+}
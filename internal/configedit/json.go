@@ -0,0 +1,461 @@
+package configedit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonNode e' un valore JSON con la sua posizione nel testo. Il parser accetta
+// commenti e virgole finali (JSONC), come settings.json di VS Code.
+type jsonNode struct {
+	kind    byte // '{', '[' o 0 per stringhe, numeri, booleani e null
+	start   int
+	end     int
+	entries []jsonEntry
+}
+
+type jsonEntry struct {
+	key   string
+	start int // inizio della chiave, o del valore negli array
+	value *jsonNode
+	comma int // posizione della virgola successiva, -1 se assente
+}
+
+type jsonParser struct {
+	s string
+	i int
+}
+
+func parseJSON(s string) (*jsonNode, error) {
+	p := &jsonParser{s: s}
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	n, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.i != len(s) {
+		return nil, p.errorf("contenuto inatteso dopo il valore")
+	}
+	return n, nil
+}
+
+func (p *jsonParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.s[:p.i], "\n") + 1
+	return fmt.Errorf("JSON non valido alla riga %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skip salta spazi e commenti // e /* */.
+func (p *jsonParser) skip() error {
+	for p.i < len(p.s) {
+		switch rest := p.s[p.i:]; {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r':
+			p.i++
+		case strings.HasPrefix(rest, "//"):
+			if end := strings.IndexByte(rest, '\n'); end >= 0 {
+				p.i += end
+			} else {
+				p.i = len(p.s)
+			}
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return p.errorf("commento non chiuso")
+			}
+			p.i += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *jsonParser) value() (*jsonNode, error) {
+	if p.i >= len(p.s) {
+		return nil, p.errorf("valore mancante")
+	}
+	start := p.i
+	switch p.s[p.i] {
+	case '{', '[':
+		return p.container()
+	case '"':
+		if _, err := p.str(); err != nil {
+			return nil, err
+		}
+		return &jsonNode{start: start, end: p.i}, nil
+	}
+	for p.i < len(p.s) && !strings.ContainsRune(",:[]{}\" \t\r\n/", rune(p.s[p.i])) {
+		p.i++
+	}
+	if !json.Valid([]byte(p.s[start:p.i])) {
+		p.i = start
+		return nil, p.errorf("valore non valido")
+	}
+	return &jsonNode{start: start, end: p.i}, nil
+}
+
+func (p *jsonParser) str() (string, error) {
+	start := p.i
+	for p.i++; p.i < len(p.s); p.i++ {
+		switch p.s[p.i] {
+		case '\\':
+			p.i++
+		case '\n':
+			p.i = start
+			return "", p.errorf("stringa non chiusa")
+		case '"':
+			p.i++
+			var out string
+			if err := json.Unmarshal([]byte(p.s[start:p.i]), &out); err != nil {
+				p.i = start
+				return "", p.errorf("stringa non valida")
+			}
+			return out, nil
+		}
+	}
+	p.i = start
+	return "", p.errorf("stringa non chiusa")
+}
+
+func (p *jsonParser) container() (*jsonNode, error) {
+	n := &jsonNode{kind: p.s[p.i], start: p.i}
+	closing := byte('}')
+	if n.kind == '[' {
+		closing = ']'
+	}
+	p.i++
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.i >= len(p.s) {
+			return nil, p.errorf("manca %c", closing)
+		}
+		if p.s[p.i] == closing {
+			p.i++
+			n.end = p.i
+			return n, nil
+		}
+		if len(n.entries) > 0 && n.entries[len(n.entries)-1].comma < 0 {
+			return nil, p.errorf("virgola mancante")
+		}
+		e := jsonEntry{start: p.i, comma: -1}
+		if n.kind == '{' {
+			if p.s[p.i] != '"' {
+				return nil, p.errorf("chiave attesa")
+			}
+			key, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			e.key = key
+			if err := p.skip(); err != nil {
+				return nil, err
+			}
+			if p.i >= len(p.s) || p.s[p.i] != ':' {
+				return nil, p.errorf("':' atteso dopo %q", key)
+			}
+			p.i++
+			if err := p.skip(); err != nil {
+				return nil, err
+			}
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		e.value = v
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.i < len(p.s) && p.s[p.i] == ',' {
+			e.comma = p.i
+			p.i++
+		}
+		n.entries = append(n.entries, e)
+	}
+}
+
+func editJSON(text string, e Edit) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		if e.Action == ActionDelete {
+			return text, nil
+		}
+		text = "{}"
+	}
+	segs, err := ParsePath(e.Path)
+	if err != nil {
+		return "", err
+	}
+	raw := e.Raw
+	if raw == "" {
+		raw = jsonString(e.Value)
+	}
+	switch e.Action {
+	case ActionDelete:
+		return deleteJSON(text, segs)
+	case ActionMerge:
+		return mergeJSON(text, segs, raw)
+	}
+	return setJSON(text, segs, raw)
+}
+
+type jsonStep struct {
+	container *jsonNode
+	entry     int
+}
+
+// walkJSON segue segs da root. Restituisce l'ultimo nodo raggiunto e i passi
+// risolti: se sono meno di segs, il nodo e' il contenitore in cui manca il
+// segmento successivo.
+func walkJSON(root *jsonNode, segs []Segment) (*jsonNode, []jsonStep, error) {
+	node := root
+	var trail []jsonStep
+	for _, seg := range segs {
+		idx := -1
+		if seg.IsKey {
+			if node.kind != '{' {
+				return nil, nil, fmt.Errorf("%s non e' un oggetto", formatPath(segs[:len(trail)]))
+			}
+			for i, e := range node.entries {
+				if e.key == seg.Key {
+					idx = i
+				}
+			}
+		} else {
+			if node.kind != '[' {
+				return nil, nil, fmt.Errorf("%s non e' un array", formatPath(segs[:len(trail)]))
+			}
+			if seg.Index < len(node.entries) {
+				idx = seg.Index
+			}
+		}
+		if idx < 0 {
+			break
+		}
+		trail = append(trail, jsonStep{node, idx})
+		node = node.entries[idx].value
+	}
+	return node, trail, nil
+}
+
+func setJSON(s string, segs []Segment, raw string) (string, error) {
+	root, err := parseJSON(s)
+	if err != nil {
+		return "", err
+	}
+	node, trail, err := walkJSON(root, segs)
+	if err != nil {
+		return "", err
+	}
+	if len(trail) == len(segs) {
+		if equalJSON(s[node.start:node.end], raw) {
+			return s, nil
+		}
+		value := renderJSON(raw, lineIndent(s, node.start), jsonIndentUnit(s, root))
+		if jsonInline(s, trail[len(trail)-1].container) {
+			value = compactJSON(raw)
+		}
+		return s[:node.start] + value + s[node.end:], nil
+	}
+
+	missing := segs[len(trail):]
+	for _, seg := range missing[1:] {
+		if !seg.IsKey {
+			return "", fmt.Errorf("%s non presente", formatPath(segs))
+		}
+	}
+	for i := len(missing) - 1; i > 0; i-- {
+		raw = "{" + jsonString(missing[i].Key) + ":" + raw + "}"
+	}
+	if !missing[0].IsKey && missing[0].Index != len(node.entries) {
+		return "", fmt.Errorf("%s: indice %d oltre la fine dell'array", formatPath(segs), missing[0].Index)
+	}
+	return insertJSON(s, root, node, missing[0].Key, raw), nil
+}
+
+// insertJSON aggiunge in fondo al contenitore c il membro key (o un elemento,
+// per gli array), seguendo l'indentazione degli elementi esistenti.
+func insertJSON(s string, root, c *jsonNode, key, raw string) string {
+	unit := jsonIndentUnit(s, root)
+	colon := ": "
+	member := func(value string) string {
+		if c.kind == '[' {
+			return value
+		}
+		return jsonString(key) + colon + value
+	}
+
+	// in un file compatto su una riga il nuovo elemento resta sulla riga
+	// e segue la spaziatura di quelli esistenti
+	if len(c.entries) == 0 && c != root && !strings.Contains(s[root.start:root.end], "\n") {
+		_, colon = jsonSeparators(s, root)
+		return s[:c.start+1] + member(compactJSON(raw)) + s[c.start+1:]
+	}
+	if len(c.entries) == 0 {
+		indent := lineIndent(s, c.start)
+		inner := indent + unit
+		text := "\n" + inner + member(renderJSON(raw, inner, unit))
+		if strings.TrimSpace(s[c.start+1:c.end-1]) == "" {
+			return s[:c.start+1] + text + "\n" + indent + s[c.end-1:]
+		}
+		return s[:c.start+1] + text + s[c.start+1:]
+	}
+
+	last := c.entries[len(c.entries)-1]
+	pos, sep := last.value.end, ","
+	if last.comma >= 0 {
+		pos, sep = last.comma+1, ""
+	}
+	if jsonInline(s, c) {
+		var comma string
+		comma, colon = jsonSeparators(s, c)
+		return s[:pos] + sep + comma + member(compactJSON(raw)) + s[pos:]
+	}
+	indent := lineIndent(s, last.start)
+	text := "\n" + indent + member(renderJSON(raw, indent, unit))
+	eol := strings.IndexByte(s[pos:], '\n')
+	if eol < 0 {
+		eol = len(s) - pos
+	}
+	if rest := strings.TrimSpace(s[pos : pos+eol]); rest == "" || strings.HasPrefix(rest, "//") {
+		// Il commento a fine riga resta all'elemento a cui si riferisce.
+		return s[:pos] + sep + s[pos:pos+eol] + text + s[pos+eol:]
+	}
+	return s[:pos] + sep + text + s[pos:]
+}
+
+// jsonInline indica se il primo elemento di c e' sulla riga della sua apertura.
+func jsonInline(s string, c *jsonNode) bool {
+	return len(c.entries) > 0 && !strings.Contains(s[c.start:c.entries[0].start], "\n")
+}
+
+// jsonSeparators ricava dagli elementi di c gli spazi dopo la virgola e i due
+// punti, ad esempio "" e ":" per JSON compatto.
+func jsonSeparators(s string, c *jsonNode) (comma, colon string) {
+	colon = ": "
+	if c.kind == '{' && len(c.entries) > 0 {
+		e := c.entries[0]
+		between := s[e.start:e.value.start]
+		if sep := between[strings.LastIndexByte(between, ':'):]; strings.TrimSpace(sep) == ":" {
+			colon = sep
+		}
+	}
+	comma = colon[1:]
+	if len(c.entries) > 1 && c.entries[0].comma >= 0 {
+		if between := s[c.entries[0].comma+1 : c.entries[1].start]; strings.TrimSpace(between) == "" {
+			comma = between
+		}
+	}
+	return comma, colon
+}
+
+func deleteJSON(s string, segs []Segment) (string, error) {
+	root, err := parseJSON(s)
+	if err != nil {
+		return "", err
+	}
+	_, trail, err := walkJSON(root, segs)
+	if err != nil {
+		return "", err
+	}
+	if len(trail) < len(segs) {
+		return s, nil
+	}
+	last := trail[len(trail)-1]
+	c, i := last.container, last.entry
+	e := c.entries[i]
+	switch {
+	case e.comma >= 0:
+		end := e.comma + 1
+		// Il commento a fine riga appartiene all'elemento rimosso.
+		if eol := strings.IndexByte(s[end:], '\n'); eol >= 0 && strings.HasPrefix(strings.TrimSpace(s[end:end+eol]), "//") {
+			end += eol
+		}
+		return removeSpan(s, e.start, end), nil
+	case i > 0:
+		return s[:c.entries[i-1].value.end] + s[e.value.end:], nil
+	}
+	return removeSpan(s, e.start, e.value.end), nil
+}
+
+// mergeJSON fonde l'oggetto raw in quello al percorso segs: gli oggetti sono
+// fusi ricorsivamente, gli altri valori sostituiti.
+func mergeJSON(s string, segs []Segment, raw string) (string, error) {
+	src, err := parseJSON(raw)
+	if err != nil {
+		return "", err
+	}
+	if src.kind != '{' {
+		return "", fmt.Errorf("merge richiede un oggetto JSON")
+	}
+	root, err := parseJSON(s)
+	if err != nil {
+		return "", err
+	}
+	node, trail, err := walkJSON(root, segs)
+	if err != nil {
+		return "", err
+	}
+	if len(trail) < len(segs) || node.kind != '{' {
+		return setJSON(s, segs, raw)
+	}
+	for _, e := range src.entries {
+		child := append(append([]Segment(nil), segs...), Segment{Key: e.key, IsKey: true})
+		value := raw[e.value.start:e.value.end]
+		if e.value.kind == '{' {
+			s, err = mergeJSON(s, child, value)
+		} else {
+			s, err = setJSON(s, child, value)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return s, nil
+}
+
+// jsonIndentUnit ricava l'indentazione di un livello dal primo elemento della
+// radice; 4 spazi se non ricavabile, come VS Code.
+func jsonIndentUnit(s string, root *jsonNode) string {
+	if len(root.entries) == 0 {
+		return "    "
+	}
+	return indentUnit(lineIndent(s, root.start), lineIndent(s, root.entries[0].start), "    ")
+}
+
+func jsonString(v string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func compactJSON(raw string) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(raw)); err != nil {
+		return raw
+	}
+	return buf.String()
+}
+
+// renderJSON formatta raw su piu' righe per inserirlo in una riga indentata
+// con indent.
+func renderJSON(raw, indent, unit string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(compactJSON(raw)), indent, unit); err != nil {
+		return raw
+	}
+	return buf.String()
+}
+
+func equalJSON(a, b string) bool {
+	return compactJSON(a) == compactJSON(b)
+}
@@ -0,0 +1,93 @@
+package configedit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Segment e' un elemento di un percorso JSON o YAML: una chiave o un indice.
+type Segment struct {
+	Key   string
+	Index int
+	IsKey bool
+}
+
+// ParsePath interpreta percorsi come $.editor.tabSize, items[0].name o
+// $["editor.fontSize"]; le chiavi che contengono punti vanno tra virgolette.
+// "$" o "" indicano la radice e restituiscono nessun segmento.
+func ParsePath(p string) ([]Segment, error) {
+	invalid := func() ([]Segment, error) {
+		return nil, fmt.Errorf("path non valido: %q", p)
+	}
+	rest := strings.TrimPrefix(strings.TrimSpace(p), "$")
+	var segments []Segment
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return invalid()
+			}
+			segments = append(segments, Segment{Key: rest[:end], IsKey: true})
+			rest = rest[end:]
+		case '[':
+			inner, tail, ok := bracket(rest)
+			if !ok {
+				return invalid()
+			}
+			rest = tail
+			if unquoted, err := strconv.Unquote(inner); err == nil {
+				segments = append(segments, Segment{Key: unquoted, IsKey: true})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return invalid()
+			}
+			segments = append(segments, Segment{Index: index})
+		default:
+			if len(segments) > 0 {
+				return invalid()
+			}
+			rest = "." + rest
+		}
+	}
+	return segments, nil
+}
+
+// bracket separa il contenuto di [...] all'inizio di s dal resto, ignorando
+// le ']' dentro una stringa tra virgolette.
+func bracket(s string) (inner, rest string, ok bool) {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ']' && !quoted:
+			return s[1:i], s[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+func formatPath(segs []Segment) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, seg := range segs {
+		if !seg.IsKey {
+			fmt.Fprintf(&b, "[%d]", seg.Index)
+		} else if strings.ContainsAny(seg.Key, ".[]\" ") {
+			fmt.Fprintf(&b, "[%s]", strconv.Quote(seg.Key))
+		} else {
+			b.WriteString("." + seg.Key)
+		}
+	}
+	return b.String()
+}
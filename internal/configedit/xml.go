@@ -0,0 +1,344 @@
+package configedit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// xmlNode e' un elemento con le posizioni dei suoi tag nel testo, cosi' le
+// modifiche sostituiscono solo le parti interessate.
+type xmlNode struct {
+	name     string // nome come scritto nel file, con l'eventuale prefisso
+	attrs    []xml.Attr
+	start    int // inizio del tag di apertura
+	startEnd int // fine del tag di apertura
+	endStart int // inizio del tag di chiusura (= startEnd se autochiuso)
+	end      int
+	children []*xmlNode
+}
+
+func (n *xmlNode) selfClosing() bool {
+	return n.endStart == n.startEnd && n.end == n.startEnd
+}
+
+func (n *xmlNode) attr(name string) (string, bool) {
+	for _, a := range n.attrs {
+		if xmlName(a.Name) == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func xmlName(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+func parseXML(s string) (*xmlNode, error) {
+	d := xml.NewDecoder(strings.NewReader(s))
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		offset := int(d.InputOffset())
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("XML non valido: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: xmlName(t.Name), attrs: t.Attr, start: offset, startEnd: int(d.InputOffset())}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root != nil {
+				return nil, fmt.Errorf("XML non valido: piu' elementi radice")
+			} else {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1].name != xmlName(t.Name) {
+				return nil, fmt.Errorf("XML non valido: chiusura inattesa </%s>", xmlName(t.Name))
+			}
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			n.endStart, n.end = offset, int(d.InputOffset())
+		}
+	}
+	if root == nil || len(stack) > 0 {
+		return nil, fmt.Errorf("XML non valido: elemento radice mancante o non chiuso")
+	}
+	return root, nil
+}
+
+// xpathStep e' un passo di un XPath semplificato: nome[@a='v'][n].
+type xpathStep struct {
+	name  string
+	attrs []xml.Attr // predicati [@nome='valore']
+	index int        // predicato [n], 1-based; 0 se assente
+}
+
+type xpath struct {
+	steps []xpathStep
+	attr  string // @attributo finale, vuoto per il testo dell'elemento
+}
+
+var xpathPredicate = regexp.MustCompile(`^\[\s*(?:@([\w:.-]+)\s*=\s*(?:'([^']*)'|"([^"]*)")|(\d+))\s*\]`)
+
+// parseXPath accetta percorsi assoluti come
+// /configuration/packageSources/add[@key='nuget.org']/@value.
+func parseXPath(p string) (xpath, error) {
+	var x xpath
+	invalid := func() (xpath, error) {
+		return xpath{}, fmt.Errorf("XPath non valido o non supportato: %q", p)
+	}
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") {
+		return invalid()
+	}
+	rest := p[1:]
+	for rest != "" {
+		if strings.HasPrefix(rest, "@") {
+			x.attr = rest[1:]
+			if !isXMLName(x.attr) || len(x.steps) == 0 {
+				return invalid()
+			}
+			return x, nil
+		}
+		end := strings.IndexAny(rest, "[/")
+		if end < 0 {
+			end = len(rest)
+		}
+		step := xpathStep{name: rest[:end]}
+		if !isXMLName(step.name) {
+			return invalid()
+		}
+		rest = rest[end:]
+		for strings.HasPrefix(rest, "[") {
+			m := xpathPredicate.FindStringSubmatch(rest)
+			if m == nil {
+				return invalid()
+			}
+			if m[4] != "" {
+				n, _ := strconv.Atoi(m[4])
+				if n < 1 || step.index != 0 {
+					return invalid()
+				}
+				step.index = n
+			} else {
+				step.attrs = append(step.attrs, xml.Attr{Name: xml.Name{Local: m[1]}, Value: m[2] + m[3]})
+			}
+			rest = rest[len(m[0]):]
+		}
+		x.steps = append(x.steps, step)
+		if rest == "" {
+			break
+		}
+		if rest[0] != '/' || len(rest) == 1 {
+			return invalid()
+		}
+		rest = rest[1:]
+	}
+	if len(x.steps) == 0 {
+		return invalid()
+	}
+	return x, nil
+}
+
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][\w:.-]*$`)
+
+func isXMLName(s string) bool {
+	return xmlNamePattern.MatchString(s)
+}
+
+// matches confronta il nome con o senza prefisso: add corrisponde anche a x:add.
+func (st xpathStep) matches(n *xmlNode) bool {
+	if n.name != st.name && !(!strings.Contains(st.name, ":") && strings.HasSuffix(n.name, ":"+st.name)) {
+		return false
+	}
+	for _, a := range st.attrs {
+		if v, ok := n.attr(a.Name.Local); !ok || v != a.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func (st xpathStep) find(children []*xmlNode) *xmlNode {
+	count := 0
+	for _, c := range children {
+		if st.matches(c) {
+			count++
+			if st.index == 0 || st.index == count {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func editXML(text string, e Edit) (string, error) {
+	x, err := parseXPath(e.Path)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(text) == "" {
+		if e.Action == ActionDelete {
+			return text, nil
+		}
+		text = `<?xml version="1.0" encoding="utf-8"?>` + "\n" + renderXMLElement(x.steps[0], nil, "", "", "", false) + "\n"
+	}
+	root, err := parseXML(text)
+	if err != nil {
+		return "", err
+	}
+	if !x.steps[0].matches(root) {
+		return "", fmt.Errorf("elemento radice <%s> diverso da %s", root.name, x.steps[0].name)
+	}
+
+	node := root
+	for i, st := range x.steps[1:] {
+		child := st.find(node.children)
+		if child == nil {
+			if e.Action == ActionDelete {
+				return text, nil
+			}
+			for _, missing := range x.steps[i+1:] {
+				if missing.index > 1 {
+					return "", fmt.Errorf("%s non presente: impossibile creare l'elemento %d", e.Path, missing.index)
+				}
+			}
+			return insertXML(text, root, node, x.steps[i+1:], x.attr, e.Value)
+		}
+		node = child
+	}
+
+	if e.Action == ActionDelete {
+		if x.attr == "" {
+			return removeSpan(text, node.start, node.end), nil
+		}
+		tag := text[node.start:node.startEnd]
+		if loc := attrPattern(x.attr).FindStringIndex(tag); loc != nil {
+			return text[:node.start] + tag[:loc[0]] + tag[loc[1]:] + text[node.startEnd:], nil
+		}
+		return text, nil
+	}
+
+	if x.attr != "" {
+		return text[:node.start] + setXMLAttr(text[node.start:node.startEnd], x.attr, e.Value) + text[node.startEnd:], nil
+	}
+	if len(node.children) > 0 {
+		return "", fmt.Errorf("%s contiene altri elementi: impossibile impostarne il testo", e.Path)
+	}
+	escaped := escapeXML(e.Value, false)
+	if node.selfClosing() {
+		tag := text[node.start:node.startEnd]
+		open := strings.TrimRight(strings.TrimSuffix(tag, "/>"), " \t\n") + ">"
+		return text[:node.start] + open + escaped + "</" + node.name + ">" + text[node.end:], nil
+	}
+	return text[:node.startEnd] + escaped + text[node.endStart:], nil
+}
+
+// insertXML crea sotto parent gli elementi mancanti di steps, con gli
+// attributi dei predicati, e imposta il valore sull'ultimo.
+func insertXML(text string, root, parent *xmlNode, steps []xpathStep, attr, value string) (string, error) {
+	unit := "  "
+	if len(root.children) > 0 {
+		unit = indentUnit(lineIndent(text, root.start), lineIndent(text, root.children[0].start), "  ")
+	}
+	parentIndent := lineIndent(text, parent.start)
+	indent := parentIndent + unit
+	if len(parent.children) > 0 {
+		indent = lineIndent(text, parent.children[len(parent.children)-1].start)
+	}
+	elem := renderXMLElement(steps[0], steps[1:], indent, unit, value, attr != "")
+	if attr != "" {
+		elem = setXMLAttrDeepest(elem, attr, value)
+	}
+
+	switch {
+	case parent.selfClosing():
+		tag := text[parent.start:parent.startEnd]
+		open := strings.TrimRight(strings.TrimSuffix(tag, "/>"), " \t\n") + ">"
+		return text[:parent.start] + open + "\n" + indent + elem + "\n" + parentIndent + "</" + parent.name + ">" + text[parent.end:], nil
+	case len(parent.children) > 0:
+		last := parent.children[len(parent.children)-1]
+		return text[:last.end] + "\n" + indent + elem + text[last.end:], nil
+	case strings.TrimSpace(text[parent.startEnd:parent.endStart]) == "":
+		return text[:parent.startEnd] + "\n" + indent + elem + "\n" + parentIndent + text[parent.endStart:], nil
+	}
+	return "", fmt.Errorf("<%s> contiene testo: impossibile aggiungere elementi", parent.name)
+}
+
+// renderXMLElement scrive l'elemento st con i figli rest annidati; l'ultimo
+// contiene value, oppure resta vuoto se il valore va in un attributo.
+func renderXMLElement(st xpathStep, rest []xpathStep, indent, unit, value string, valueIsAttr bool) string {
+	var b strings.Builder
+	b.WriteString("<" + st.name)
+	for _, a := range st.attrs {
+		b.WriteString(" " + a.Name.Local + `="` + escapeXML(a.Value, true) + `"`)
+	}
+	switch {
+	case len(rest) > 0:
+		inner := indent + unit
+		b.WriteString(">\n" + inner + renderXMLElement(rest[0], rest[1:], inner, unit, value, valueIsAttr) + "\n" + indent + "</" + st.name + ">")
+	case value == "" || valueIsAttr:
+		b.WriteString(" />")
+	default:
+		b.WriteString(">" + escapeXML(value, false) + "</" + st.name + ">")
+	}
+	return b.String()
+}
+
+// setXMLAttrDeepest imposta l'attributo sull'ultimo tag autochiuso di elem,
+// cioe' l'elemento piu' interno appena creato.
+func setXMLAttrDeepest(elem, name, value string) string {
+	end := strings.LastIndex(elem, " />") + len(" />")
+	start := strings.LastIndex(elem[:end], "<")
+	return elem[:start] + setXMLAttr(elem[start:end], name, value) + elem[end:]
+}
+
+func attrPattern(name string) *regexp.Regexp {
+	return regexp.MustCompile(`\s+` + regexp.QuoteMeta(name) + `\s*=\s*("[^"]*"|'[^']*')`)
+}
+
+// setXMLAttr imposta un attributo nel tag di apertura tag, mantenendo le
+// virgolette usate e la posizione se gia' presente, altrimenti lo aggiunge in fondo.
+func setXMLAttr(tag, name, value string) string {
+	re := attrPattern(name)
+	if loc := re.FindStringSubmatchIndex(tag); loc != nil {
+		quote := tag[loc[2]]
+		escaped := escapeXML(value, true)
+		if quote == '\'' {
+			escaped = strings.ReplaceAll(escapeXML(value, false), "'", "&apos;")
+		}
+		return tag[:loc[2]+1] + escaped + tag[loc[3]-1:]
+	}
+	end := len(tag) - 1
+	if strings.HasSuffix(tag, "/>") {
+		end = len(tag) - 2
+	}
+	body := strings.TrimRight(tag[:end], " \t\n")
+	closing := tag[end:]
+	if strings.HasSuffix(tag, " />") {
+		closing = " />"
+	}
+	return body + " " + name + `="` + escapeXML(value, true) + `"` + closing
+}
+
+func escapeXML(s string, attr bool) string {
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	if attr {
+		r = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\n", "&#xA;", "\t", "&#x9;")
+	}
+	return r.Replace(s)
+}
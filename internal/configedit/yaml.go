@@ -0,0 +1,255 @@
+package configedit
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// L'editor YAML lavora per righe e gestisce le mappe a blocchi, il caso dei
+// file di configurazione: le chiavi lungo il percorso devono essere mappe
+// indentate, non liste o mappe inline ({a: 1}).
+
+type yamlLine struct {
+	content bool // false per righe vuote, commenti e separatori di documento
+	indent  int
+	key     string // vuota se la riga non e' "chiave: ..."
+	keyText string // la chiave come scritta nel file, con le eventuali virgolette
+	rest    string // quanto segue i due punti
+	seq     bool   // elemento di lista "- ..."
+}
+
+func parseYAMLLine(line string) yamlLine {
+	trimmed := strings.TrimLeft(line, " ")
+	l := yamlLine{indent: len(line) - len(trimmed)}
+	trimmed = strings.TrimRight(trimmed, " \t")
+	if trimmed == "" || trimmed[0] == '#' || trimmed == "---" || trimmed == "..." {
+		return l
+	}
+	l.content = true
+	if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+		l.seq = true
+		return l
+	}
+
+	end := -1
+	switch trimmed[0] {
+	case '"', '\'':
+		q := trimmed[0]
+		for i := 1; i < len(trimmed); i++ {
+			if q == '"' && trimmed[i] == '\\' {
+				i++
+			} else if trimmed[i] == q {
+				if q == '\'' && i+1 < len(trimmed) && trimmed[i+1] == '\'' {
+					i++
+					continue
+				}
+				end = i + 1
+				break
+			}
+		}
+		if end < 0 {
+			return l
+		}
+		rest := strings.TrimLeft(trimmed[end:], " ")
+		if !strings.HasPrefix(rest, ":") {
+			return l
+		}
+		end = len(trimmed) - len(rest)
+		l.keyText = trimmed[:end]
+		l.key = unquoteYAML(l.keyText)
+	default:
+		for i := 0; i < len(trimmed); i++ {
+			if trimmed[i] == '#' && i > 0 && trimmed[i-1] == ' ' {
+				return l
+			}
+			if trimmed[i] == ':' && (i+1 == len(trimmed) || trimmed[i+1] == ' ') {
+				end = i
+				break
+			}
+		}
+		if end <= 0 {
+			return l
+		}
+		l.keyText = strings.TrimRight(trimmed[:end], " ")
+		l.key = l.keyText
+	}
+	l.rest = strings.TrimSpace(trimmed[end+1:])
+	return l
+}
+
+func unquoteYAML(s string) string {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	if v, err := strconv.Unquote(s); err == nil {
+		return v
+	}
+	return s[1 : len(s)-1]
+}
+
+type yamlDoc struct {
+	lines  []string
+	parsed []yamlLine
+}
+
+// blockEnd restituisce la fine del blocco della chiave alla riga i: la prima
+// riga di contenuto meno indentata, o con pari indentazione se non e' un
+// elemento di lista.
+func (d *yamlDoc) blockEnd(i int) int {
+	n := d.parsed[i].indent
+	for j := i + 1; j < len(d.lines); j++ {
+		l := d.parsed[j]
+		if l.content && (l.indent < n || l.indent == n && !l.seq) {
+			return j
+		}
+	}
+	return len(d.lines)
+}
+
+// lastContent restituisce l'indice successivo all'ultima riga di contenuto in
+// [start, end), o start se non ce ne sono.
+func (d *yamlDoc) lastContent(start, end int) int {
+	for j := end - 1; j >= start; j-- {
+		if d.parsed[j].content {
+			return j + 1
+		}
+	}
+	return start
+}
+
+// unit ricava l'indentazione di un livello dal file, 2 spazi se non ricavabile.
+func (d *yamlDoc) unit() int {
+	prev := -1
+	for _, l := range d.parsed {
+		if !l.content {
+			continue
+		}
+		if prev >= 0 && l.indent > prev {
+			return l.indent - prev
+		}
+		prev = l.indent
+	}
+	return 2
+}
+
+func editYAML(text string, e Edit) (string, error) {
+	d := &yamlDoc{lines: strings.Split(text, "\n")}
+	for _, line := range d.lines {
+		if strings.HasPrefix(strings.TrimLeft(line, " "), "\t") {
+			return "", fmt.Errorf("YAML non valido: indentazione con tabulazioni")
+		}
+		d.parsed = append(d.parsed, parseYAMLLine(line))
+	}
+	segs, err := ParsePath(e.Path)
+	if err != nil {
+		return "", err
+	}
+
+	value := e.Raw
+	if value == "" {
+		value = yamlScalar(e.Value)
+	}
+
+	start, end, parentIndent := 0, len(d.lines), -d.unit()
+	for i, seg := range segs {
+		childIndent, idx := -1, -1
+		for j := start; j < end; j++ {
+			l := d.parsed[j]
+			if !l.content {
+				continue
+			}
+			if childIndent < 0 {
+				childIndent = l.indent
+			}
+			if l.seq && l.indent == childIndent || l.key == "" && l.indent == childIndent {
+				return "", fmt.Errorf("%s non e' una mappa", formatPath(segs[:i]))
+			}
+			if l.indent == childIndent && l.key == seg.Key {
+				idx = j
+				break
+			}
+		}
+
+		if idx < 0 {
+			if e.Action == ActionDelete {
+				return text, nil
+			}
+			if childIndent < 0 {
+				childIndent = parentIndent + d.unit()
+			}
+			var insert []string
+			for k, s := range segs[i:] {
+				line := strings.Repeat(" ", childIndent+k*d.unit()) + yamlScalar(s.Key) + ":"
+				if i+k == len(segs)-1 {
+					line += " " + value
+				}
+				insert = append(insert, line)
+			}
+			at := d.lastContent(start, end)
+			lines := append(d.lines[:at:at], append(insert, d.lines[at:]...)...)
+			return strings.Join(lines, "\n"), nil
+		}
+
+		blockEnd := d.blockEnd(idx)
+		if i == len(segs)-1 {
+			last := d.lastContent(idx+1, blockEnd)
+			if e.Action == ActionDelete {
+				return strings.Join(append(d.lines[:idx:idx], d.lines[last:]...), "\n"), nil
+			}
+			l := d.parsed[idx]
+			_, comment := splitYAMLComment(l.rest)
+			line := strings.Repeat(" ", l.indent) + l.keyText + ": " + value + comment
+			if line == d.lines[idx] && last == idx+1 {
+				return text, nil
+			}
+			lines := append(d.lines[:idx:idx], line)
+			return strings.Join(append(lines, d.lines[last:]...), "\n"), nil
+		}
+
+		if v, _ := splitYAMLComment(d.parsed[idx].rest); v != "" {
+			return "", fmt.Errorf("%s non e' una mappa", formatPath(segs[:i+1]))
+		}
+		start, end, parentIndent = idx+1, blockEnd, childIndent
+	}
+	return text, nil
+}
+
+// splitYAMLComment separa un valore dal commento finale " # ...", ignorando i
+// '#' tra virgolette. Il commento restituito include lo spazio iniziale.
+func splitYAMLComment(rest string) (value, comment string) {
+	var quote byte
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || rest[i-1] == ' '):
+			return strings.TrimSpace(rest[:i]), " " + rest[i:]
+		}
+	}
+	return rest, ""
+}
+
+var yamlSpecial = regexp.MustCompile(`(?i)^(true|false|yes|no|on|off|y|n|null|~|[-+]?(\d|\.\d|\.inf|\.nan).*)$`)
+
+// yamlScalar scrive s come stringa YAML, tra virgolette solo se necessario
+// perche' non venga letta come numero, booleano, null o sintassi YAML.
+func yamlScalar(s string) string {
+	plain := s != "" && s == strings.TrimSpace(s) &&
+		!strings.ContainsAny(s, "\n\t") &&
+		!strings.ContainsRune("-?:,[]{}#&*!|>'\"%@`", rune(s[0])) &&
+		!strings.Contains(s, ": ") && !strings.Contains(s, " #") &&
+		!strings.HasSuffix(s, ":") && !yamlSpecial.MatchString(s)
+	if plain {
+		return s
+	}
+	return jsonString(s)
+}
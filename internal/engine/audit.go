@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+)
+
+// Audit esegue solo gli step verify di tutti i moduli, o del modulo only
+// (cartella o nome), per controllare una postazione gia' installata senza
+// modificarla. Tutti i controlli vengono eseguiti anche dopo un errore; lo
+// stato dei moduli dell'engine resta invariato. Il report viene salvato come
+// quello di Run e restituito insieme all'eventuale errore.
+func (e *Engine) Audit(only string) (*Report, error) {
+	e.mu.Lock()
+	if e.isRunning {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("installazione gia' in corso")
+	}
+	e.isRunning = true
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.isRunning = false
+		e.mu.Unlock()
+	}()
+
+	var modules []*module.Module
+	for _, mod := range e.modules {
+		if only == "" || mod.FolderName == only || mod.Command.Name == only {
+			audited := *mod
+			audited.Status, audited.Error = module.StatusPending, ""
+			modules = append(modules, &audited)
+		}
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("modulo %s non trovato", only)
+	}
+	for _, mod := range modules {
+		registerStepSecrets(mod.Command.Steps)
+	}
+
+	report := newReport(modules)
+	report.Audit = true
+	failed := 0
+	for i, mod := range modules {
+		moduleStart := time.Now()
+		for stepIdx, step := range mod.Command.Steps {
+			if step.Type != "verify" || step.OnUninstall {
+				continue
+			}
+			if mod.Status == module.StatusPending {
+				mod.Status = module.StatusCompleted
+			}
+			stepReport, err := e.runStep(mod, stepIdx, step, &integrityCheck{}, "")
+			report.Modules[i].Steps[stepIdx] = stepReport
+			if err != nil && mod.Status != module.StatusError {
+				mod.Status = module.StatusError
+				mod.Error = logger.Redact(fmt.Sprintf("Step %d (%s): %s", stepIdx+1, step.Type, err.Error()))
+				failed++
+			}
+		}
+		report.Modules[i].DurationMs = time.Since(moduleStart).Milliseconds()
+		if mod.Status == module.StatusPending {
+			logger.Info("Modulo %s: nessuno step verify", mod.Command.Name)
+		}
+	}
+
+	var err error
+	if failed > 0 {
+		err = fmt.Errorf("verifica fallita per %d moduli su %d", failed, len(modules))
+	}
+	report.finish(modules, err)
+	if reportPath, werr := report.Write(e.reportDir); werr != nil {
+		logger.Warn("Report verifica non salvato: %v", werr)
+	} else {
+		logger.Info("Report verifica: %s", reportPath)
+	}
+	e.emitEvent("report", report)
+	return report, err
+}
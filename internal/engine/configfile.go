@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"WebGainInstaller/internal/configedit"
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+)
+
+// editConfigFile applica la modifica di uno step json_config, ini_config,
+// xml_config o yaml_config al file target, creandolo se assente. Il file
+// viene riscritto solo se cambia.
+func editConfigFile(step module.Step) error {
+	format, edit, err := step.ConfigEdit()
+	if err != nil {
+		return err
+	}
+	target := os.ExpandEnv(step.Target)
+
+	data, err := os.ReadFile(target)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("impossibile leggere %s: %w", target, err)
+	}
+	if err != nil && edit.Action == configedit.ActionDelete {
+		logger.Info("%s assente, nulla da rimuovere", target)
+		return nil
+	}
+
+	updated, err := configedit.Apply(format, data, edit)
+	if err != nil {
+		return fmt.Errorf("modifica di %s fallita: %w", target, err)
+	}
+	if bytes.Equal(updated, data) {
+		logger.Info("%s gia' aggiornato", target)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("impossibile creare directory di %s: %w", target, err)
+	}
+	if err := writeFileAtomic(target, updated); err != nil {
+		return err
+	}
+	logger.Info("%s aggiornato", target)
+	return nil
+}
+
+// writeFileAtomic scrive data in un file temporaneo e lo rinomina, cosi' un
+// errore non lascia il file scritto a meta'.
+func writeFileAtomic(target string, data []byte) error {
+	tmp := target + ".webgain-tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("impossibile scrivere %s: %w", target, err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("impossibile scrivere %s: %w", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"WebGainInstaller/internal/glob"
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+	"WebGainInstaller/internal/setup"
+
+	"golang.org/x/sys/windows"
+)
+
+type copier struct {
+	step      module.Step
+	backupDir string
+	copied    int
+	skipped   int
+}
+
+// copyFiles copia un file, una cartella o i file che corrispondono a un glob
+// del modulo in dest, applicando esclusioni, modalita' di sovrascrittura,
+// backup dei file sostituiti, date di modifica e ACL delle cartelle create.
+func copyFiles(step module.Step, workDir string) error {
+	if err := step.ValidateCopy(); err != nil {
+		return err
+	}
+	c := &copier{
+		step:      step,
+		backupDir: filepath.Join(setup.PersistentDir("backup"), logger.RunID()),
+	}
+	dest := os.ExpandEnv(step.Dest)
+	pattern := path.Clean(glob.ToSlash(step.File))
+
+	var err error
+	if glob.HasMeta(pattern) {
+		err = c.copyGlob(workDir, pattern, dest)
+	} else {
+		err = c.copyPath(workDir, pattern, dest)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("Copia %s -> %s: %d file copiati, %d invariati", step.File, dest, c.copied, c.skipped)
+	return nil
+}
+
+func (c *copier) copyPath(workDir, rel, dest string) error {
+	src := filepath.Join(workDir, filepath.FromSlash(rel))
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("impossibile leggere sorgente %s: %w", src, err)
+	}
+	if info.IsDir() {
+		return c.copyTree(src, dest, func(string) bool { return true })
+	}
+
+	target := dest
+	if strings.HasSuffix(dest, `\`) || strings.HasSuffix(dest, "/") {
+		target = filepath.Join(dest, info.Name())
+	} else if destInfo, err := os.Stat(dest); err == nil && destInfo.IsDir() {
+		target = filepath.Join(dest, info.Name())
+	}
+	return c.copyFile(src, target, info)
+}
+
+// copyGlob copia i file che corrispondono a pattern mantenendo il percorso
+// relativo alla parte del pattern senza caratteri jolly.
+func (c *copier) copyGlob(workDir, pattern, dest string) error {
+	base := glob.Base(pattern)
+	root := filepath.Join(workDir, filepath.FromSlash(base))
+	before := c.copied + c.skipped
+
+	err := c.copyTree(root, dest, func(rel string) bool {
+		ok, _ := glob.Match(pattern, path.Join(base, rel))
+		return ok
+	})
+	if err != nil {
+		return err
+	}
+	if c.copied+c.skipped == before {
+		return fmt.Errorf("nessun file corrisponde a %s", c.step.File)
+	}
+	return nil
+}
+
+func (c *copier) copyTree(root, dest string, include func(rel string) bool) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, p)
+		if err != nil || relPath == "." {
+			return err
+		}
+		rel := filepath.ToSlash(relPath)
+		if glob.Excluded(c.step.Exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !include(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return c.copyFile(p, filepath.Join(dest, relPath), info)
+	})
+}
+
+func (c *copier) copyFile(src, target string, info fs.FileInfo) error {
+	existing, err := os.Stat(target)
+	exists := err == nil
+	if exists {
+		if existing.IsDir() {
+			return fmt.Errorf("destinazione %s e' una cartella", target)
+		}
+		replace, err := c.shouldReplace(src, target, info, existing)
+		if err != nil {
+			return err
+		}
+		if !replace {
+			logger.Debug("Copia saltata, %s invariato (overwrite=%s)", target, c.step.Overwrite)
+			c.skipped++
+			return nil
+		}
+		if c.step.Backup {
+			if err := c.backup(target, existing); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := c.ensureDir(filepath.Dir(target)); err != nil {
+		return err
+	}
+	if err := copyContent(src, target); err != nil {
+		return err
+	}
+	if c.step.PreserveTimestamps {
+		if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("impossibile impostare data di %s: %w", target, err)
+		}
+	}
+	logger.Debug("Copiato %s -> %s", src, target)
+	c.copied++
+	return nil
+}
+
+func (c *copier) shouldReplace(src, target string, info, existing fs.FileInfo) (bool, error) {
+	switch c.step.Overwrite {
+	case module.OverwriteNever:
+		return false, nil
+	case module.OverwriteIfNewer:
+		// un file con lo stesso contenuto non va sostituito anche se piu' recente,
+		// ad esempio se la data originale non e' nota
+		if !info.ModTime().After(existing.ModTime()) {
+			return false, nil
+		}
+		fallthrough
+	case module.OverwriteIfDifferent:
+		if info.Size() != existing.Size() {
+			return true, nil
+		}
+		srcSum, err := fileHash(src)
+		if err != nil {
+			return false, err
+		}
+		destSum, err := fileHash(target)
+		if err != nil {
+			return false, err
+		}
+		return !bytes.Equal(srcSum, destSum), nil
+	}
+	return true, nil
+}
+
+// backup salva il file che sta per essere sostituito in
+// backup\<run ID>\<unita'>\<percorso>, per poterlo ripristinare.
+func (c *copier) backup(target string, info fs.FileInfo) error {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	volume := filepath.VolumeName(abs)
+	name := strings.NewReplacer(":", "", `\\`, "UNC\\", "/", "").Replace(volume)
+	backupPath := filepath.Join(c.backupDir, name, strings.TrimPrefix(abs, volume))
+
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+		return fmt.Errorf("impossibile creare cartella backup: %w", err)
+	}
+	if err := copyContent(abs, backupPath); err != nil {
+		return fmt.Errorf("backup di %s fallito: %w", target, err)
+	}
+	os.Chtimes(backupPath, info.ModTime(), info.ModTime())
+	logger.Info("Backup di %s in %s", target, backupPath)
+	return nil
+}
+
+// ensureDir crea dir e, se lo step definisce un'ACL, la applica alla prima
+// cartella creata; le sottocartelle e i file la ereditano.
+func (c *copier) ensureDir(dir string) error {
+	created := ""
+	for p := dir; ; p = filepath.Dir(p) {
+		if _, err := os.Stat(p); err == nil {
+			break
+		}
+		created = p
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("impossibile creare directory destinazione: %w", err)
+	}
+	if created != "" && c.step.ACL != "" {
+		if err := applyACL(created, c.step.ACL); err != nil {
+			return err
+		}
+		logger.Info("ACL applicata a %s", created)
+	}
+	return nil
+}
+
+// applyACL imposta la DACL descritta in SDDL, protetta dall'ereditarieta'
+// se l'SDDL contiene il flag P.
+func applyACL(target, sddl string) error {
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return fmt.Errorf("acl non valida %q: %w", sddl, err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return fmt.Errorf("acl senza DACL %q: %w", sddl, err)
+	}
+	info := windows.SECURITY_INFORMATION(windows.DACL_SECURITY_INFORMATION)
+	if control, _, err := sd.Control(); err == nil && control&windows.SE_DACL_PROTECTED != 0 {
+		info |= windows.PROTECTED_DACL_SECURITY_INFORMATION
+	} else {
+		info |= windows.UNPROTECTED_DACL_SECURITY_INFORMATION
+	}
+	if err := windows.SetNamedSecurityInfo(target, windows.SE_FILE_OBJECT, info, nil, nil, dacl, nil); err != nil {
+		return fmt.Errorf("impossibile applicare acl a %s: %w", target, err)
+	}
+	return nil
+}
+
+// copyContent copia in streaming passando da un file temporaneo, cosi' la
+// destinazione non resta mai scritta a meta'.
+func copyContent(src, target string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("impossibile leggere file sorgente %s: %w", src, err)
+	}
+	defer in.Close()
+
+	tmp := target + ".webgain-tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("impossibile copiare in %s: %w", target, err)
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, target)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("impossibile copiare in %s: %w", target, err)
+	}
+	return nil
+}
+
+func fileHash(p string) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("impossibile leggere %s: %w", p, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("impossibile leggere %s: %w", p, err)
+	}
+	return h.Sum(nil), nil
+}
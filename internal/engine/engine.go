@@ -1,10 +1,19 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
 
+	"WebGainInstaller/internal/logger"
 	"WebGainInstaller/internal/module"
+	"WebGainInstaller/internal/setup"
 )
 
 type EventCallback func(event string, data interface{})
@@ -16,8 +25,19 @@ type Engine struct {
 	progress   *ProgressCalculator
 	onEvent    EventCallback
 	isRunning  bool
+	report     *Report
+	finished   *Report
+	reportDir  string
+	progressAt ProgressInfo
+	cancelled  bool
+	// noManifest elenca i moduli ammessi senza manifest.json
+	noManifest map[string]bool
+	mu         sync.Mutex
 }
 
+// ErrCancelled indica che l'installazione e' stata interrotta con Cancel.
+var ErrCancelled = errors.New("installazione annullata")
+
 func New(moduleFS fs.FS, onEvent EventCallback) (*Engine, error) {
 	order, err := module.LoadOrder(moduleFS)
 	if err != nil {
@@ -30,14 +50,41 @@ func New(moduleFS fs.FS, onEvent EventCallback) (*Engine, error) {
 	}
 
 	return &Engine{
-		moduleFS: moduleFS,
-		order:    order,
-		modules:  modules,
-		progress: NewProgressCalculator(modules),
-		onEvent:  onEvent,
+		moduleFS:  moduleFS,
+		order:     order,
+		modules:   modules,
+		progress:  NewProgressCalculator(modules),
+		onEvent:   onEvent,
+		reportDir: setup.PersistentDir("reports"),
 	}, nil
 }
 
+// SetReportDir cambia la cartella in cui Run salva il report di installazione.
+func (e *Engine) SetReportDir(dir string) {
+	e.reportDir = dir
+}
+
+// AllowMissingManifest accetta senza manifest.json i moduli indicati, ad
+// esempio quelli embedded nelle build di sviluppo, dove i manifest generati
+// da release.bat mancano.
+func (e *Engine) AllowMissingManifest(folderNames ...string) {
+	if e.noManifest == nil {
+		e.noManifest = make(map[string]bool)
+	}
+	for _, name := range folderNames {
+		e.noManifest[name] = true
+	}
+}
+
+// GetReport restituisce il report dell'ultima esecuzione conclusa, nil prima
+// che Run termini. Il report in corso non e' esposto perche' Run lo modifica
+// senza lock.
+func (e *Engine) GetReport() *Report {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.finished
+}
+
 func (e *Engine) GetOrder() *module.Order {
 	return e.order
 }
@@ -46,7 +93,11 @@ func (e *Engine) GetModules() []*module.Module {
 	return e.modules
 }
 
+// GetModuleStatuses restituisce una copia dello stato dei moduli, leggibile
+// anche durante l'installazione (ad esempio dall'API di stato).
 func (e *Engine) GetModuleStatuses() []module.ModuleStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	statuses := make([]module.ModuleStatus, len(e.modules))
 	for i, m := range e.modules {
 		statuses[i] = m.ToStatus()
@@ -55,49 +106,274 @@ func (e *Engine) GetModuleStatuses() []module.ModuleStatus {
 }
 
 func (e *Engine) IsRunning() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	return e.isRunning
 }
 
+// GetProgress restituisce l'ultimo avanzamento emesso.
+func (e *Engine) GetProgress() ProgressInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.progressAt
+}
+
+// Cancel chiede l'interruzione dell'installazione in corso. Lo step in
+// esecuzione viene completato, i successivi non vengono avviati.
+func (e *Engine) Cancel() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.isRunning {
+		e.cancelled = true
+		logger.Warn("Annullamento richiesto, attendo la fine dello step corrente")
+	}
+}
+
+func (e *Engine) cancelRequested() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cancelled
+}
+
+// ResetFailed riporta a pending i moduli in errore, cosi' che la Run successiva
+// riprenda dal modulo fallito saltando quelli gia' completati.
+func (e *Engine) ResetFailed() error {
+	e.mu.Lock()
+	if e.isRunning {
+		e.mu.Unlock()
+		return fmt.Errorf("installazione gia' in corso")
+	}
+	reset := 0
+	for _, mod := range e.modules {
+		if mod.Status == module.StatusError {
+			mod.Status = module.StatusPending
+			mod.Error = ""
+			reset++
+		}
+	}
+	e.mu.Unlock()
+	if reset == 0 {
+		return fmt.Errorf("nessun modulo da riprovare")
+	}
+	e.emitModuleUpdate()
+	return nil
+}
+
+// registerStepSecrets registra nel logger i valori degli step marcati secret,
+// anche espansi, perche' vengano mascherati nei log e nei report.
+func registerStepSecrets(steps []module.Step) {
+	for _, step := range steps {
+		for _, v := range step.SecretValues() {
+			logger.AddSecret(v, os.ExpandEnv(v))
+		}
+	}
+}
+
 func (e *Engine) Run() error {
+	e.mu.Lock()
 	if e.isRunning {
+		e.mu.Unlock()
 		return fmt.Errorf("installazione gia' in corso")
 	}
 	e.isRunning = true
-	defer func() { e.isRunning = false }()
+	e.cancelled = false
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.isRunning = false
+		e.mu.Unlock()
+	}()
+
+	for _, mod := range e.modules {
+		registerStepSecrets(mod.Command.Steps)
+	}
 
+	previous := e.report
+	e.report = newReport(e.modules)
 	for i, mod := range e.modules {
-		mod.Status = module.StatusInstalling
+		if previous != nil && mod.Status == module.StatusCompleted {
+			e.report.Modules[i] = previous.Modules[i]
+		}
+	}
+	err := e.runModules()
+	e.report.finish(e.modules, err)
+	e.mu.Lock()
+	e.finished = e.report
+	e.mu.Unlock()
+	if reportPath, werr := e.report.Write(e.reportDir); werr != nil {
+		logger.Warn("Report installazione non salvato: %v", werr)
+	} else {
+		logger.Info("Report installazione: %s", reportPath)
+	}
+	e.emitEvent("report", e.report)
+	if err != nil {
+		return err
+	}
+
+	e.emitEvent("complete", nil)
+	return nil
+}
+
+func (e *Engine) runModules() error {
+	for i, mod := range e.modules {
+		if mod.Status == module.StatusCompleted {
+			continue
+		}
+		if e.cancelRequested() {
+			return ErrCancelled
+		}
+		moduleStart := time.Now()
+		moduleReport := &e.report.Modules[i]
+		e.setStatus(mod, module.StatusInstalling, "")
 		e.emitProgress(i, 0, len(mod.Command.Steps))
 		e.emitModuleUpdate()
 
 		workDir, err := module.ExtractModule(e.moduleFS, mod.FolderName)
 		if err != nil {
-			mod.Status = module.StatusError
-			mod.Error = err.Error()
+			e.setStatus(mod, module.StatusError, logger.Redact(err.Error()))
+			moduleReport.DurationMs = time.Since(moduleStart).Milliseconds()
 			e.emitModuleUpdate()
 			return fmt.Errorf("errore estrazione modulo %s: %w", mod.FolderName, err)
 		}
 
+		integrity, err := checkIntegrity(mod.FolderName, workDir, e.noManifest[mod.FolderName])
+		if err != nil {
+			e.setStatus(mod, module.StatusError, logger.Redact(err.Error()))
+			moduleReport.DurationMs = time.Since(moduleStart).Milliseconds()
+			e.emitModuleUpdate()
+			module.CleanupModule(mod.FolderName)
+			return fmt.Errorf("errore verifica modulo %s: %w", mod.FolderName, err)
+		}
+
 		for stepIdx, step := range mod.Command.Steps {
+			if e.cancelRequested() {
+				e.setStatus(mod, module.StatusError, ErrCancelled.Error())
+				moduleReport.DurationMs = time.Since(moduleStart).Milliseconds()
+				e.emitModuleUpdate()
+				module.CleanupModule(mod.FolderName)
+				return ErrCancelled
+			}
+			if step.OnUninstall {
+				continue
+			}
 			e.emitProgress(i, stepIdx, len(mod.Command.Steps))
 
-			if err := executeStep(step, workDir); err != nil {
-				mod.Status = module.StatusError
-				mod.Error = fmt.Sprintf("Step %d (%s): %s", stepIdx+1, step.Type, err.Error())
+			stepReport, err := e.runStep(mod, stepIdx, step, integrity, workDir)
+			moduleReport.Steps[stepIdx] = stepReport
+			if err != nil {
+				e.setStatus(mod, module.StatusError, logger.Redact(fmt.Sprintf("Step %d (%s): %s", stepIdx+1, step.Type, err.Error())))
+				moduleReport.DurationMs = time.Since(moduleStart).Milliseconds()
 				e.emitModuleUpdate()
 				module.CleanupModule(mod.FolderName)
 				return fmt.Errorf("errore modulo %s, step %d: %w", mod.FolderName, stepIdx+1, err)
 			}
 		}
 
-		mod.Status = module.StatusCompleted
+		if mod.Command.Uninstall != nil {
+			if err := registerUninstall(mod, workDir); err != nil {
+				logger.Warn("Modulo %s: registrazione in App installate non riuscita: %v", mod.FolderName, err)
+			}
+		}
+
+		e.setStatus(mod, module.StatusCompleted, "")
+		moduleReport.DurationMs = time.Since(moduleStart).Milliseconds()
+		logger.Event(logger.INFO, "Modulo completato", logger.Module(mod.Command.Name), logger.Duration(time.Since(moduleStart)))
 		e.emitProgress(i, len(mod.Command.Steps), len(mod.Command.Steps))
 		e.emitModuleUpdate()
 
 		module.CleanupModule(mod.FolderName)
 	}
+	return nil
+}
 
-	e.emitEvent("complete", nil)
+// processSteps sono gli step che avviano un processo e per cui ha senso registrare l'exit code.
+var processSteps = map[string]bool{
+	"exe":               true,
+	"msi":               true,
+	"powershell":        true,
+	"powershell_script": true,
+	"powershell_module": true,
+	"batch":             true,
+	"scheduled_task":    true,
+	"verify":            true,
+}
+
+// runStep esegue uno step registrando modulo, indice, tipo, durata ed exit code
+// come campi strutturati del log, e ne restituisce l'esito per il report.
+func (e *Engine) runStep(mod *module.Module, stepIdx int, step module.Step, integrity *integrityCheck, workDir string) (StepReport, error) {
+	attrs := []slog.Attr{logger.Module(mod.Command.Name), logger.Step(stepIdx + 1), logger.StepType(step.Type)}
+	logger.Event(logger.DEBUG, "Avvio step", attrs...)
+	result := StepReport{Index: stepIdx + 1, Type: step.Type, Status: StepStatusCompleted}
+
+	start := time.Now()
+	err := integrity.checkStep(step)
+	if err == nil {
+		var output string
+		if step.Type == "verify" {
+			output, result.Checks, err = verifyInstall(step)
+		} else {
+			output, err = executeStep(step, workDir, mod.FolderName)
+		}
+		result.Output = excerpt(output)
+		if err == nil && step.Capture != "" {
+			err = captureOutput(step, output)
+		}
+	}
+	elapsed := time.Since(start)
+	result.DurationMs = elapsed.Milliseconds()
+	attrs = append(attrs, logger.Duration(elapsed))
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		code := exitErr.ExitCode()
+		result.ExitCode = &code
+	case err == nil && processSteps[step.Type] && len(step.Checks) == 0:
+		code := 0
+		result.ExitCode = &code
+	}
+	if result.ExitCode != nil {
+		attrs = append(attrs, logger.ExitCode(*result.ExitCode))
+	}
+
+	if err != nil {
+		result.Status = StepStatusFailed
+		result.Error = excerpt(err.Error())
+		logger.Event(logger.ERROR, "Step fallito: "+err.Error(), attrs...)
+		return result, err
+	}
+	logger.Event(logger.INFO, "Step completato", attrs...)
+	return result, nil
+}
+
+// capturedVars sono le variabili gia' impostate da capture: possono essere
+// riassegnate, mentre una variabile gia' presente nell'ambiente no.
+var (
+	capturedMu   sync.Mutex
+	capturedVars = make(map[string]bool)
+)
+
+// captureOutput assegna l'output dello step alla variabile d'ambiente del
+// processo, ereditata dagli step successivi ed espansa nei loro campi.
+func captureOutput(step module.Step, output string) error {
+	value, err := step.CaptureValue(output)
+	if err != nil {
+		return err
+	}
+	name := strings.ToUpper(step.Capture)
+	capturedMu.Lock()
+	defer capturedMu.Unlock()
+	if _, exists := os.LookupEnv(step.Capture); exists && !capturedVars[name] {
+		return fmt.Errorf("capture: la variabile %s esiste gia' nell'ambiente e non viene sovrascritta", step.Capture)
+	}
+	if step.Secret {
+		logger.AddSecret(value)
+	}
+	if err := os.Setenv(step.Capture, value); err != nil {
+		return fmt.Errorf("impossibile impostare variabile %s: %w", step.Capture, err)
+	}
+	capturedVars[name] = true
+	logger.Debug("Variabile %s catturata", step.Capture)
 	return nil
 }
 
@@ -113,13 +389,26 @@ func (e *Engine) emitProgress(moduleIndex, stepIndex, totalSteps int) {
 		}
 	}
 
-	e.emitEvent("progress", ProgressInfo{
+	info := ProgressInfo{
 		Percentage:    pct,
 		CurrentModule: moduleName,
 		CurrentStep:   stepType,
 		StepIndex:     stepIndex,
 		TotalSteps:    totalSteps,
-	})
+	}
+	e.mu.Lock()
+	e.progressAt = info
+	e.mu.Unlock()
+	e.emitEvent("progress", info)
+}
+
+// setStatus aggiorna lo stato del modulo sotto e.mu: durante Run viene letto
+// da altre goroutine tramite GetModuleStatuses.
+func (e *Engine) setStatus(mod *module.Module, status, errMsg string) {
+	e.mu.Lock()
+	mod.Status = status
+	mod.Error = errMsg
+	e.mu.Unlock()
 }
 
 func (e *Engine) emitModuleUpdate() {
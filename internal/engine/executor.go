@@ -5,14 +5,20 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
+	"unsafe"
 
+	"WebGainInstaller/internal/envpath"
 	"WebGainInstaller/internal/module"
 
 	"golang.org/x/sys/windows/registry"
 )
 
-func executeStep(step module.Step, workDir string) error {
+// executeStep esegue lo step del modulo nella cartella folder e restituisce
+// l'output dei processi avviati, vuoto per gli step che non ne avviano.
+func executeStep(step module.Step, workDir, folder string) (string, error) {
 	switch step.Type {
 	case "exe":
 		return runExe(step, workDir)
@@ -27,37 +33,44 @@ func executeStep(step module.Step, workDir string) error {
 	case "batch":
 		return runBatch(step, workDir)
 	case "env_path":
-		return setEnvPath(step)
+		return "", setEnvPath(step)
 	case "env_set":
-		return setEnvVariable(step)
+		return "", setEnvVariable(step)
 	case "shell_config":
-		return configureShell(step)
+		return "", configureShell(step, folder)
 	case "registry":
-		return setRegistry(step)
+		return setRegistry(step, workDir)
 	case "copy":
-		return copyFiles(step, workDir)
+		return "", copyFiles(step, workDir)
+	case "json_config", "ini_config", "xml_config", "yaml_config":
+		return "", editConfigFile(step)
 	case "service":
 		return manageService(step)
+	case "shortcut":
+		return "", manageShortcut(step)
+	case "scheduled_task":
+		return scheduleTask(step)
 	case "verify":
-		return verifyInstall(step)
+		output, _, err := verifyInstall(step)
+		return output, err
 	default:
-		return fmt.Errorf("tipo di step sconosciuto: %s", step.Type)
+		return "", fmt.Errorf("tipo di step sconosciuto: %s", step.Type)
 	}
 }
 
-func runExe(step module.Step, workDir string) error {
+func runExe(step module.Step, workDir string) (string, error) {
 	exePath := filepath.Join(workDir, step.File)
 	args := parseArgs(step.Args)
 	cmd := exec.Command(exePath, args...)
 	cmd.Dir = workDir
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("esecuzione %s fallita: %w\nOutput: %s", step.File, err, string(output))
+		return string(output), fmt.Errorf("esecuzione %s fallita: %w\nOutput: %s", step.File, err, string(output))
 	}
-	return nil
+	return string(output), nil
 }
 
-func runMsi(step module.Step, workDir string) error {
+func runMsi(step module.Step, workDir string) (string, error) {
 	msiPath := filepath.Join(workDir, step.File)
 	baseArgs := []string{"/i", msiPath}
 	baseArgs = append(baseArgs, parseArgs(step.Args)...)
@@ -65,32 +78,32 @@ func runMsi(step module.Step, workDir string) error {
 	cmd.Dir = workDir
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("installazione MSI %s fallita: %w\nOutput: %s", step.File, err, string(output))
+		return string(output), fmt.Errorf("installazione MSI %s fallita: %w\nOutput: %s", step.File, err, string(output))
 	}
-	return nil
+	return string(output), nil
 }
 
-func runPowerShellCommand(step module.Step) error {
+func runPowerShellCommand(step module.Step) (string, error) {
 	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", step.Command)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("comando PowerShell fallito: %w\nOutput: %s", err, string(output))
+		return string(output), fmt.Errorf("comando PowerShell fallito: %w\nOutput: %s", err, string(output))
 	}
-	return nil
+	return string(output), nil
 }
 
-func runPowerShellScript(step module.Step, workDir string) error {
+func runPowerShellScript(step module.Step, workDir string) (string, error) {
 	scriptPath := filepath.Join(workDir, step.File)
 	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", scriptPath)
 	cmd.Dir = workDir
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("script PowerShell %s fallito: %w\nOutput: %s", step.File, err, string(output))
+		return string(output), fmt.Errorf("script PowerShell %s fallito: %w\nOutput: %s", step.File, err, string(output))
 	}
-	return nil
+	return string(output), nil
 }
 
-func runPowerShellModule(step module.Step) error {
+func runPowerShellModule(step module.Step) (string, error) {
 	installCmd := fmt.Sprintf("Install-Module -Name %s -Force -AllowClobber -Scope AllUsers", step.Value)
 	if step.Command != "" {
 		installCmd = step.Command
@@ -98,50 +111,40 @@ func runPowerShellModule(step module.Step) error {
 	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-Command", installCmd)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("installazione modulo PowerShell fallita: %w\nOutput: %s", err, string(output))
+		return string(output), fmt.Errorf("installazione modulo PowerShell fallita: %w\nOutput: %s", err, string(output))
 	}
-	return nil
+	return string(output), nil
 }
 
-func runBatch(step module.Step, workDir string) error {
+func runBatch(step module.Step, workDir string) (string, error) {
 	batPath := filepath.Join(workDir, step.File)
 	cmd := exec.Command("cmd.exe", "/C", batPath)
 	cmd.Dir = workDir
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("script batch %s fallito: %w\nOutput: %s", step.File, err, string(output))
+		return string(output), fmt.Errorf("script batch %s fallito: %w\nOutput: %s", step.File, err, string(output))
 	}
-	return nil
+	return string(output), nil
 }
 
 func setEnvPath(step module.Step) error {
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE,
-		`SYSTEM\CurrentControlSet\Control\Session Manager\Environment`,
-		registry.QUERY_VALUE|registry.SET_VALUE)
+	key, err := openEnvironmentKey(step.Scope, registry.QUERY_VALUE|registry.SET_VALUE)
 	if err != nil {
-		return fmt.Errorf("impossibile aprire chiave registro Environment: %w", err)
+		return err
 	}
 	defer key.Close()
 
 	currentPath, _, err := key.GetStringValue("Path")
-	if err != nil {
+	if err != nil && err != registry.ErrNotExist {
 		return fmt.Errorf("impossibile leggere PATH: %w", err)
 	}
 
-	expandedValue := os.ExpandEnv(step.Value)
-
-	if strings.Contains(strings.ToLower(currentPath), strings.ToLower(expandedValue)) {
-		return nil
+	newPath, changed, err := envpath.Edit(currentPath, os.ExpandEnv(step.Value), step.Action, step.Target, os.LookupEnv)
+	if err != nil {
+		return err
 	}
-
-	var newPath string
-	switch step.Action {
-	case "append":
-		newPath = currentPath + ";" + expandedValue
-	case "prepend":
-		newPath = expandedValue + ";" + currentPath
-	default:
-		newPath = currentPath + ";" + expandedValue
+	if !changed {
+		return nil
 	}
 
 	if err := key.SetExpandStringValue("Path", newPath); err != nil {
@@ -153,11 +156,9 @@ func setEnvPath(step module.Step) error {
 }
 
 func setEnvVariable(step module.Step) error {
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE,
-		`SYSTEM\CurrentControlSet\Control\Session Manager\Environment`,
-		registry.SET_VALUE)
+	key, err := openEnvironmentKey(step.Scope, registry.SET_VALUE)
 	if err != nil {
-		return fmt.Errorf("impossibile aprire chiave registro Environment: %w", err)
+		return err
 	}
 	defer key.Close()
 
@@ -170,129 +171,198 @@ func setEnvVariable(step module.Step) error {
 	return nil
 }
 
-func configureShell(step module.Step) error {
-	var profilePath string
-	switch step.Target {
-	case "powershell_profile":
-		profileDir := filepath.Join(os.Getenv("ProgramFiles"), "PowerShell", "7")
-		if _, err := os.Stat(profileDir); os.IsNotExist(err) {
-			profileDir = filepath.Join(os.Getenv("WINDIR"), "System32", "WindowsPowerShell", "v1.0")
-		}
-		profilePath = filepath.Join(profileDir, "profile.ps1")
+// openEnvironmentKey apre le variabili d'ambiente di sistema (scope machine o
+// vuoto) o dell'utente corrente (scope user).
+func openEnvironmentKey(scope string, access uint32) (registry.Key, error) {
+	root, path := registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`
+	switch scope {
+	case "", "machine":
+	case "user":
+		root, path = registry.CURRENT_USER, `Environment`
 	default:
-		return fmt.Errorf("target shell sconosciuto: %s", step.Target)
+		return 0, fmt.Errorf("scope sconosciuto: %s", scope)
 	}
-
-	if err := os.MkdirAll(filepath.Dir(profilePath), 0755); err != nil {
-		return fmt.Errorf("impossibile creare directory profilo: %w", err)
+	key, _, err := registry.CreateKey(root, path, access)
+	if err != nil {
+		return 0, fmt.Errorf("impossibile aprire chiave registro Environment: %w", err)
 	}
+	return key, nil
+}
 
-	existing, _ := os.ReadFile(profilePath)
-	if strings.Contains(string(existing), step.Content) {
-		return nil
-	}
+var (
+	advapi32Dll       = syscall.NewLazyDLL("advapi32.dll")
+	procRegDeleteTree = advapi32Dll.NewProc("RegDeleteTreeW")
+)
 
-	content := step.Content
-	if len(existing) > 0 {
-		content = "\n" + content
+func setRegistry(step module.Step, workDir string) (string, error) {
+	if step.File != "" {
+		return importRegFile(step, workDir)
 	}
-
-	f, err := os.OpenFile(profilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("impossibile aprire profilo shell: %w", err)
+	if err := step.ValidateRegistry(); err != nil {
+		return "", err
 	}
-	defer f.Close()
 
-	if _, err := f.WriteString(content); err != nil {
-		return fmt.Errorf("impossibile scrivere profilo shell: %w", err)
+	rootKey, path, release, err := openRegistryKey(step.Key)
+	if err != nil {
+		return "", err
 	}
-	return nil
-}
+	defer release()
+	view := registryView(step.View)
 
-func setRegistry(step module.Step) error {
-	parts := strings.SplitN(step.Key, `\`, 2)
-	if len(parts) != 2 {
-		return fmt.Errorf("chiave di registro non valida: %s", step.Key)
+	switch step.Action {
+	case module.RegActionDelete, module.RegActionEnsureAbsent:
+		return "", deleteRegistry(step, rootKey, path, view)
 	}
 
-	var rootKey registry.Key
-	switch strings.ToUpper(parts[0]) {
-	case "HKLM", "HKEY_LOCAL_MACHINE":
-		rootKey = registry.LOCAL_MACHINE
-	case "HKCU", "HKEY_CURRENT_USER":
-		rootKey = registry.CURRENT_USER
-	case "HKCR", "HKEY_CLASSES_ROOT":
-		rootKey = registry.CLASSES_ROOT
-	default:
-		return fmt.Errorf("root key sconosciuta: %s", parts[0])
+	value, err := step.RegistryValue()
+	if err != nil {
+		return "", err
 	}
 
-	key, _, err := registry.CreateKey(rootKey, parts[1], registry.SET_VALUE)
+	key, _, err := registry.CreateKey(rootKey, path, registry.SET_VALUE|view)
 	if err != nil {
-		return fmt.Errorf("impossibile creare/aprire chiave %s: %w", step.Key, err)
+		return "", fmt.Errorf("impossibile creare/aprire chiave %s: %w", step.Key, err)
 	}
 	defer key.Close()
 
-	if err := key.SetStringValue(step.Variable, step.Value); err != nil {
-		return fmt.Errorf("impossibile impostare valore %s: %w", step.Variable, err)
+	switch value.Type {
+	case module.RegExpandString:
+		err = key.SetExpandStringValue(step.Variable, value.String)
+	case module.RegMultiString:
+		err = key.SetStringsValue(step.Variable, value.Strings)
+	case module.RegDWord:
+		err = key.SetDWordValue(step.Variable, uint32(value.Integer))
+	case module.RegQWord:
+		err = key.SetQWordValue(step.Variable, value.Integer)
+	case module.RegBinary:
+		err = key.SetBinaryValue(step.Variable, value.Binary)
+	default:
+		err = key.SetStringValue(step.Variable, value.String)
 	}
-	return nil
+	if err != nil {
+		return "", fmt.Errorf("impossibile impostare valore %s: %w", step.Variable, err)
+	}
+	return "", nil
 }
 
-func copyFiles(step module.Step, workDir string) error {
-	src := filepath.Join(workDir, step.File)
-	dest := os.ExpandEnv(step.Dest)
+// deleteRegistry elimina il valore variable, oppure l'intera chiave con le
+// sottochiavi se variable e' vuoto. Con ensure-absent un elemento gia'
+// assente non e' un errore.
+func deleteRegistry(step module.Step, rootKey registry.Key, path string, view uint32) error {
+	missingOK := step.Action == module.RegActionEnsureAbsent
 
-	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
-		return fmt.Errorf("impossibile creare directory destinazione: %w", err)
+	if step.Variable != "" {
+		key, err := registry.OpenKey(rootKey, path, registry.SET_VALUE|view)
+		if err == registry.ErrNotExist && missingOK {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("impossibile aprire chiave %s: %w", step.Key, err)
+		}
+		defer key.Close()
+		if err := key.DeleteValue(step.Variable); err != nil && !(err == registry.ErrNotExist && missingOK) {
+			return fmt.Errorf("impossibile eliminare valore %s: %w", step.Variable, err)
+		}
+		return nil
+	}
+
+	if err := step.ValidateRegistry(); err != nil {
+		return err
+	}
+	i := strings.LastIndex(path, `\`)
+	if i < 0 {
+		return fmt.Errorf("chiave %s troppo generica da eliminare", step.Key)
 	}
+	parentPath, name := path[:i], path[i+1:]
+	parent, err := registry.OpenKey(rootKey, parentPath, registry.ALL_ACCESS|view)
+	if err == registry.ErrNotExist && missingOK {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("impossibile aprire chiave padre di %s: %w", step.Key, err)
+	}
+	defer parent.Close()
 
-	data, err := os.ReadFile(src)
+	namePtr, err := syscall.UTF16PtrFromString(name)
 	if err != nil {
-		return fmt.Errorf("impossibile leggere file sorgente %s: %w", src, err)
+		return err
 	}
-	if err := os.WriteFile(dest, data, 0644); err != nil {
-		return fmt.Errorf("impossibile copiare in %s: %w", dest, err)
+	ret, _, _ := procRegDeleteTree.Call(uintptr(parent), uintptr(unsafe.Pointer(namePtr)))
+	if errno := syscall.Errno(ret); errno != 0 && !(errno == syscall.ERROR_FILE_NOT_FOUND && missingOK) {
+		return fmt.Errorf("impossibile eliminare chiave %s: %w", step.Key, errno)
 	}
 	return nil
 }
 
-func manageService(step module.Step) error {
-	var args []string
-	switch step.Action {
-	case "start":
-		args = []string{"start", step.Value}
-	case "stop":
-		args = []string{"stop", step.Value}
-	case "restart":
-		exec.Command("sc.exe", "stop", step.Value).Run()
-		args = []string{"start", step.Value}
-	default:
-		return fmt.Errorf("azione servizio sconosciuta: %s", step.Action)
+// importRegFile importa un file .reg del modulo con reg.exe nella vista richiesta.
+func importRegFile(step module.Step, workDir string) (string, error) {
+	if err := step.ValidateRegistry(); err != nil {
+		return "", err
 	}
-
-	cmd := exec.Command("sc.exe", args...)
-	output, err := cmd.CombinedOutput()
+	args := []string{"import", filepath.Join(workDir, step.File)}
+	if step.View != "" {
+		args = append(args, "/reg:"+step.View)
+	}
+	output, err := exec.Command("reg.exe", args...).CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("gestione servizio %s fallita: %w\nOutput: %s", step.Value, err, string(output))
+		return string(output), fmt.Errorf("importazione %s fallita: %w\nOutput: %s", step.File, err, string(output))
 	}
-	return nil
+	return string(output), nil
 }
 
-func verifyInstall(step module.Step) error {
-	cmd := exec.Command("cmd.exe", "/C", step.Command)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("verifica fallita (%s): %w\nOutput: %s", step.Command, err, string(output))
+func splitRegistryKey(fullKey string) (registry.Key, string, error) {
+	parts := strings.SplitN(fullKey, `\`, 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", fmt.Errorf("chiave di registro non valida: %s", fullKey)
 	}
-	return nil
+
+	switch strings.ToUpper(parts[0]) {
+	case "HKLM", "HKEY_LOCAL_MACHINE":
+		return registry.LOCAL_MACHINE, parts[1], nil
+	case "HKCU", "HKEY_CURRENT_USER":
+		return registry.CURRENT_USER, parts[1], nil
+	case "HKCR", "HKEY_CLASSES_ROOT":
+		return registry.CLASSES_ROOT, parts[1], nil
+	case "HKU", "HKEY_USERS":
+		return registry.USERS, parts[1], nil
+	}
+	return 0, "", fmt.Errorf("root key sconosciuta: %s", parts[0])
+}
+
+// registryView restituisce il flag di accesso per la vista 32 o 64 bit;
+// vuoto usa la vista nativa del processo.
+func registryView(view string) uint32 {
+	switch view {
+	case "32":
+		return registry.WOW64_32KEY
+	case "64":
+		return registry.WOW64_64KEY
+	}
+	return 0
 }
 
 func parseArgs(args string) []string {
 	if args == "" {
 		return nil
 	}
-	return strings.Fields(args)
+	fields := strings.Fields(args)
+	for i, f := range fields {
+		fields[i] = expandVars(f)
+	}
+	return fields
+}
+
+var braceVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandVars sostituisce solo i riferimenti ${NOME} a variabili definite, ad
+// esempio quelle di capture, lasciando invariati gli altri $ degli argomenti.
+func expandVars(s string) string {
+	return braceVar.ReplaceAllStringFunc(s, func(ref string) string {
+		if value, ok := os.LookupEnv(braceVar.FindStringSubmatch(ref)[1]); ok {
+			return value
+		}
+		return ref
+	})
 }
 
 func broadcastEnvironmentChange() {
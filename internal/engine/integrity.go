@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+)
+
+// integritySteps sono gli step che eseguono un file del modulo e che vengono
+// rifiutati se il file non corrisponde al manifest.
+var integritySteps = map[string]bool{
+	"exe":               true,
+	"msi":               true,
+	"batch":             true,
+	"powershell_script": true,
+}
+
+type integrityCheck struct {
+	manifest *module.Manifest
+	failures map[string]error
+}
+
+// checkIntegrity verifica i file estratti in workDir rispetto al manifest.json
+// del modulo, generato da release.bat per i moduli embedded e da webgain-pack
+// per quelli pubblicati. Un modulo senza manifest viene rifiutato, salvo che
+// optional lo consenta: in quel caso gli step non vengono verificati.
+func checkIntegrity(folderName, workDir string, optional bool) (*integrityCheck, error) {
+	extracted := os.DirFS(workDir)
+	manifest, err := module.LoadManifest(extracted, ".")
+	if errors.Is(err, fs.ErrNotExist) && optional {
+		logger.Warn("Modulo %s: %s assente, verifica integrita' saltata", folderName, module.ManifestFileName)
+		return &integrityCheck{}, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s assente, generarlo con webgain-pack -manifest", module.ErrIntegrity, module.ManifestFileName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", module.ErrIntegrity, err)
+	}
+
+	failures := manifest.VerifyFS(extracted)
+	for _, failure := range failures {
+		logger.Error("Modulo %s: %v", folderName, failure)
+	}
+	logger.Info("Modulo %s: verifica integrita' %d file, %d non conformi", folderName, len(manifest.Files), len(failures))
+	return &integrityCheck{manifest: manifest, failures: failures}, nil
+}
+
+func (c *integrityCheck) checkStep(step module.Step) error {
+	if c.manifest == nil {
+		return nil
+	}
+	// i file .reg modificano il sistema come gli eseguibili
+	if !integritySteps[step.Type] && !(step.Type == "registry" && step.File != "") {
+		return nil
+	}
+	file := path.Clean(filepath.ToSlash(step.File))
+	if !c.manifest.Has(file) {
+		return fmt.Errorf("%w: %s non presente nel manifest", module.ErrIntegrity, step.File)
+	}
+	if err := c.failures[file]; err != nil {
+		return fmt.Errorf("%w: %v", module.ErrIntegrity, err)
+	}
+	return nil
+}
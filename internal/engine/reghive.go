@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	procRegLoadKey   = advapi32Dll.NewProc("RegLoadKeyW")
+	procRegUnLoadKey = advapi32Dll.NewProc("RegUnLoadKeyW")
+)
+
+// defaultUserMount e' la sottochiave di HKU sotto cui viene caricato
+// temporaneamente l'hive del profilo predefinito.
+const defaultUserMount = "WebGainDefaultUser"
+
+// hiveMu serializza il caricamento dell'hive, che ha un solo punto di montaggio.
+var hiveMu sync.Mutex
+
+// openRegistryKey risolve fullKey in radice e percorso come splitRegistryKey.
+// Per HKU\DefaultUser carica l'hive del profilo predefinito e riscrive il
+// percorso sotto il punto di montaggio: release va chiamata dopo aver chiuso
+// tutte le chiavi aperte, per scaricare l'hive.
+func openRegistryKey(fullKey string) (registry.Key, string, func(), error) {
+	root, path, err := splitRegistryKey(fullKey)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	first, rest, _ := strings.Cut(path, `\`)
+	if root != registry.USERS || !strings.EqualFold(first, module.DefaultUserKey) {
+		return root, path, func() {}, nil
+	}
+
+	hiveMu.Lock()
+	release, err := loadDefaultUserHive()
+	if err != nil {
+		hiveMu.Unlock()
+		return 0, "", nil, err
+	}
+	mounted := defaultUserMount
+	if rest != "" {
+		mounted += `\` + rest
+	}
+	return registry.USERS, mounted, func() {
+		release()
+		hiveMu.Unlock()
+	}, nil
+}
+
+// loadDefaultUserHive carica NTUSER.DAT del profilo predefinito sotto
+// HKU\defaultUserMount e restituisce la funzione che lo scarica.
+func loadDefaultUserHive() (func(), error) {
+	hive := filepath.Join(defaultProfileDir(), "NTUSER.DAT")
+	if _, err := os.Stat(hive); err != nil {
+		return nil, fmt.Errorf("hive del profilo predefinito non trovato: %w", err)
+	}
+	if err := enablePrivileges("SeBackupPrivilege", "SeRestorePrivilege"); err != nil {
+		return nil, fmt.Errorf("privilegi per caricare l'hive non disponibili: %w", err)
+	}
+
+	mount, _ := syscall.UTF16PtrFromString(defaultUserMount)
+	file, err := syscall.UTF16PtrFromString(hive)
+	if err != nil {
+		return nil, err
+	}
+	// un montaggio rimasto da un'esecuzione interrotta viene rimosso prima
+	procRegUnLoadKey.Call(uintptr(registry.USERS), uintptr(unsafe.Pointer(mount)))
+	ret, _, _ := procRegLoadKey.Call(uintptr(registry.USERS), uintptr(unsafe.Pointer(mount)), uintptr(unsafe.Pointer(file)))
+	if ret != 0 {
+		return nil, fmt.Errorf("impossibile caricare %s: %w", hive, syscall.Errno(ret))
+	}
+	logger.Debug("Hive %s caricato in HKU\\%s", hive, defaultUserMount)
+
+	return func() {
+		ret, _, _ := procRegUnLoadKey.Call(uintptr(registry.USERS), uintptr(unsafe.Pointer(mount)))
+		if ret != 0 {
+			logger.Warn("Impossibile scaricare HKU\\%s: %v", defaultUserMount, syscall.Errno(ret))
+		}
+	}, nil
+}
+
+// defaultProfileDir restituisce la cartella del profilo predefinito da
+// ProfileList, C:\Users\Default se non indicata.
+func defaultProfileDir() string {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion\ProfileList`, registry.QUERY_VALUE)
+	if err == nil {
+		defer key.Close()
+		if dir, _, err := key.GetStringValue("Default"); err == nil && dir != "" {
+			if expanded, err := registry.ExpandString(dir); err == nil {
+				return expanded
+			}
+		}
+	}
+	return filepath.Join(os.Getenv("SystemDrive")+`\`, "Users", "Default")
+}
+
+// enablePrivileges abilita i privilegi indicati nel token del processo.
+func enablePrivileges(names ...string) error {
+	var token windows.Token
+	if err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, &token); err != nil {
+		return err
+	}
+	defer token.Close()
+	for _, name := range names {
+		var luid windows.LUID
+		namePtr, _ := windows.UTF16PtrFromString(name)
+		if err := windows.LookupPrivilegeValue(nil, namePtr, &luid); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		privs := windows.Tokenprivileges{PrivilegeCount: 1}
+		privs.Privileges[0] = windows.LUIDAndAttributes{Luid: luid, Attributes: windows.SE_PRIVILEGE_ENABLED}
+		if err := windows.AdjustTokenPrivileges(token, false, &privs, 0, nil, nil); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
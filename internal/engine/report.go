@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+)
+
+const (
+	StepStatusCompleted = "completed"
+	StepStatusFailed    = "failed"
+	StepStatusSkipped   = "skipped"
+
+	ModuleStatusSkipped = "skipped"
+)
+
+// maxExcerpt e' la lunghezza massima dell'estratto di output conservato per step.
+const maxExcerpt = 4000
+
+type StepReport struct {
+	Index      int    `json:"index"`
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"durationMs"`
+	ExitCode   *int   `json:"exitCode,omitempty"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Checks contiene l'esito dei controlli di uno step verify.
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+type ModuleReport struct {
+	FolderName string       `json:"folderName"`
+	Name       string       `json:"name"`
+	Version    string       `json:"version,omitempty"`
+	Status     string       `json:"status"`
+	DurationMs int64        `json:"durationMs"`
+	Executed   int          `json:"executed"`
+	Skipped    int          `json:"skipped"`
+	Failed     int          `json:"failed"`
+	Error      string       `json:"error,omitempty"`
+	Steps      []StepReport `json:"steps"`
+}
+
+// Report riassume un'esecuzione dell'engine: uno per postazione, da archiviare
+// come evidenza di cosa e' stato installato. Audit distingue i report di
+// verifica, che eseguono solo gli step verify.
+type Report struct {
+	RunID      string         `json:"runId"`
+	Computer   string         `json:"computer"`
+	User       string         `json:"user"`
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt"`
+	DurationMs int64          `json:"durationMs"`
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	Audit      bool           `json:"audit,omitempty"`
+	Modules    []ModuleReport `json:"modules"`
+}
+
+func newReport(modules []*module.Module) *Report {
+	computer, _ := os.Hostname()
+	r := &Report{
+		RunID:     logger.RunID(),
+		Computer:  computer,
+		User:      os.Getenv("USERNAME"),
+		StartedAt: time.Now().UTC(),
+		Modules:   make([]ModuleReport, len(modules)),
+	}
+	for i, mod := range modules {
+		steps := make([]StepReport, len(mod.Command.Steps))
+		for j, step := range mod.Command.Steps {
+			steps[j] = StepReport{Index: j + 1, Type: step.Type, Status: StepStatusSkipped}
+		}
+		r.Modules[i] = ModuleReport{
+			FolderName: mod.FolderName,
+			Name:       mod.Command.Name,
+			Version:    mod.Command.Version,
+			Status:     ModuleStatusSkipped,
+			Steps:      steps,
+		}
+	}
+	return r
+}
+
+// finish chiude il report: gli step mai eseguiti restano skipped e vengono
+// conteggiati insieme a eseguiti e falliti.
+func (r *Report) finish(modules []*module.Module, runErr error) {
+	r.FinishedAt = time.Now().UTC()
+	r.DurationMs = r.FinishedAt.Sub(r.StartedAt).Milliseconds()
+	r.Status = module.StatusCompleted
+	if runErr != nil {
+		r.Status = module.StatusError
+		r.Error = logger.Redact(runErr.Error())
+	}
+
+	for i := range r.Modules {
+		mr := &r.Modules[i]
+		if modules[i].Status != module.StatusPending {
+			mr.Status = modules[i].Status
+			mr.Error = modules[i].Error
+		}
+		mr.Executed, mr.Skipped, mr.Failed = 0, 0, 0
+		for _, s := range mr.Steps {
+			switch s.Status {
+			case StepStatusCompleted:
+				mr.Executed++
+			case StepStatusFailed:
+				mr.Executed++
+				mr.Failed++
+			default:
+				mr.Skipped++
+			}
+		}
+	}
+}
+
+// Write salva il report in dir come JSON e come pagina HTML autonoma,
+// restituendo il percorso del file JSON.
+func (r *Report) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("impossibile creare cartella report %s: %w", dir, err)
+	}
+	base := filepath.Join(dir, "webgain_report_"+r.StartedAt.Format("20060102-150405")+"_"+r.RunID)
+
+	data, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(base+".json", data, 0644); err != nil {
+		return "", fmt.Errorf("impossibile scrivere report JSON: %w", err)
+	}
+
+	f, err := os.Create(base + ".html")
+	if err != nil {
+		return "", fmt.Errorf("impossibile scrivere report HTML: %w", err)
+	}
+	defer f.Close()
+	if err := reportTemplate.Execute(f, r); err != nil {
+		return "", fmt.Errorf("impossibile scrivere report HTML: %w", err)
+	}
+	return base + ".json", nil
+}
+
+// excerpt conserva la parte finale dell'output, dove di solito compaiono gli errori.
+func excerpt(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > maxExcerpt {
+		cut := len(output) - maxExcerpt
+		for cut < len(output) && !utf8.RuneStart(output[cut]) {
+			cut++
+		}
+		output = "..." + output[cut:]
+	}
+	return logger.Redact(strings.ToValidUTF8(output, "?"))
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"seconds": func(ms int64) string { return fmt.Sprintf("%.1fs", float64(ms)/1000) },
+	"when":    func(t time.Time) string { return t.Local().Format("02/01/2006 15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html lang="it">
+<head>
+<meta charset="utf-8">
+<title>WebGain - Report {{if .Audit}}verifica{{else}}installazione{{end}} {{.Computer}}</title>
+<style>
+  body { font-family: Consolas, 'Cascadia Code', monospace; background: #0d1117; color: #e6edf3; margin: 32px; }
+  h1 { font-size: 22px; }
+  h2 { font-size: 16px; margin-top: 28px; }
+  table { border-collapse: collapse; width: 100%; margin-top: 8px; }
+  th, td { border: 1px solid #30363d; padding: 6px 10px; text-align: left; vertical-align: top; font-size: 13px; }
+  th { background: #161b22; color: #8b949e; }
+  pre { white-space: pre-wrap; word-wrap: break-word; margin: 0; color: #8b949e; max-height: 240px; overflow-y: auto; }
+  .completed { color: #3fb950; }
+  .error, .failed { color: #f85149; }
+  .skipped, .pending { color: #8b949e; }
+  .checks td { border: none; padding: 2px 10px 2px 0; }
+</style>
+</head>
+<body>
+<h1>WebGain - Report {{if .Audit}}verifica{{else}}installazione{{end}}</h1>
+<table>
+  <tr><th>Postazione</th><td>{{.Computer}}</td></tr>
+  <tr><th>Utente</th><td>{{.User}}</td></tr>
+  <tr><th>Esecuzione</th><td>{{.RunID}}</td></tr>
+  <tr><th>Avvio</th><td>{{when .StartedAt}}</td></tr>
+  <tr><th>Durata</th><td>{{seconds .DurationMs}}</td></tr>
+  <tr><th>Esito</th><td class="{{.Status}}">{{.Status}}</td></tr>
+  {{if .Error}}<tr><th>Errore</th><td><pre>{{.Error}}</pre></td></tr>{{end}}
+</table>
+
+<h2>Moduli</h2>
+<table>
+  <tr><th>Modulo</th><th>Versione</th><th>Esito</th><th>Durata</th><th>Eseguiti</th><th>Saltati</th><th>Falliti</th></tr>
+  {{range .Modules}}
+  <tr><td>{{.Name}}</td><td>{{.Version}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{seconds .DurationMs}}</td><td>{{.Executed}}</td><td>{{.Skipped}}</td><td>{{.Failed}}</td></tr>
+  {{end}}
+</table>
+
+{{range .Modules}}
+<h2>{{.Name}} <span class="{{.Status}}">[{{.Status}}]</span></h2>
+{{if .Error}}<pre class="error">{{.Error}}</pre>{{end}}
+<table>
+  <tr><th>#</th><th>Tipo</th><th>Esito</th><th>Durata</th><th>Exit code</th><th>Output</th></tr>
+  {{range .Steps}}
+  <tr><td>{{.Index}}</td><td>{{.Type}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{seconds .DurationMs}}</td><td>{{if .ExitCode}}{{.ExitCode}}{{end}}</td><td>{{if .Output}}<pre>{{.Output}}</pre>{{end}}</td></tr>
+  {{if .Checks}}
+  <tr><td></td><td colspan="5"><table class="checks">
+    {{range .Checks}}<tr><td class="{{if .Passed}}completed{{else}}failed{{end}}">{{if .Passed}}OK{{else}}KO{{end}}</td><td>{{.Type}}</td><td>{{.Name}}</td><td>{{.Detail}}</td></tr>{{end}}
+  </table></td></tr>
+  {{end}}
+  {{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,415 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceManager e serviceHandle sono la parte del Service Control Manager
+// usata dallo step service; *mgr.Service implementa serviceHandle, cosi' la
+// logica degli stati puo' girare anche su un SCM simulato.
+type serviceManager interface {
+	OpenService(name string) (serviceHandle, error)
+	CreateService(name, exePath string, cfg mgr.Config, args ...string) (serviceHandle, error)
+}
+
+type serviceHandle interface {
+	Query() (svc.Status, error)
+	Start(args ...string) error
+	Control(c svc.Cmd) (svc.Status, error)
+	Config() (mgr.Config, error)
+	UpdateConfig(c mgr.Config) error
+	SetRecoveryActions(actions []mgr.RecoveryAction, resetPeriod uint32) error
+	SetRecoveryCommand(cmd string) error
+	Delete() error
+	Close() error
+}
+
+type windowsSCM struct {
+	m *mgr.Mgr
+}
+
+func (w windowsSCM) OpenService(name string) (serviceHandle, error) {
+	s, err := w.m.OpenService(name)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (w windowsSCM) CreateService(name, exePath string, cfg mgr.Config, args ...string) (serviceHandle, error) {
+	s, err := w.m.CreateService(name, exePath, cfg, args...)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// serviceController esegue le azioni dello step service e attende i cambi di
+// stato; now e sleep sono sostituibili per simulare il passare del tempo.
+type serviceController struct {
+	scm     serviceManager
+	timeout time.Duration
+	now     func() time.Time
+	sleep   func(time.Duration)
+}
+
+func newServiceController(scm serviceManager, timeout time.Duration) *serviceController {
+	return &serviceController{scm: scm, timeout: timeout, now: time.Now, sleep: time.Sleep}
+}
+
+// manageService esegue lo step service tramite il Service Control Manager e
+// restituisce lo stato finale del servizio (running, stopped, absent...).
+func manageService(step module.Step) (string, error) {
+	if err := step.ValidateService(); err != nil {
+		return "", err
+	}
+	if step.Service != nil && step.Service.Password != "" {
+		logger.AddSecret(step.Service.Password)
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", fmt.Errorf("impossibile connettersi al Service Control Manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	c := newServiceController(windowsSCM{m}, time.Duration(step.ServiceTimeout())*time.Second)
+	return c.run(step)
+}
+
+func (c *serviceController) run(step module.Step) (string, error) {
+	name := step.Value
+	switch step.Action {
+	case module.ServiceCreate:
+		return c.create(step)
+	case module.ServiceDelete:
+		return c.delete(name)
+	}
+
+	s, err := c.scm.OpenService(name)
+	if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+		if step.Action == module.ServiceQuery {
+			return "absent", nil
+		}
+		return "", fmt.Errorf("servizio %s non installato", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("impossibile aprire servizio %s: %w", name, err)
+	}
+	defer s.Close()
+
+	switch step.Action {
+	case module.ServiceStart:
+		err = c.start(s, name)
+	case module.ServiceStop:
+		err = c.stop(s, name)
+	case module.ServiceRestart:
+		if err = c.stop(s, name); err == nil {
+			err = c.start(s, name)
+		}
+	case module.ServiceConfigure:
+		err = c.configure(s, step)
+	}
+	if err != nil {
+		return "", err
+	}
+	status, err := s.Query()
+	if err != nil {
+		return "", fmt.Errorf("impossibile leggere stato servizio %s: %w", name, err)
+	}
+	return stateName(status.State), nil
+}
+
+func (c *serviceController) start(s serviceHandle, name string) error {
+	status, err := s.Query()
+	if err != nil {
+		return fmt.Errorf("impossibile leggere stato servizio %s: %w", name, err)
+	}
+	if status.State == svc.StopPending {
+		if status, err = c.wait(s, name, svc.Stopped); err != nil {
+			return err
+		}
+	}
+	switch status.State {
+	case svc.Running:
+		logger.Info("Servizio %s gia' in esecuzione", name)
+		return nil
+	case svc.Stopped:
+		if err := s.Start(); err != nil && !errors.Is(err, windows.ERROR_SERVICE_ALREADY_RUNNING) {
+			return fmt.Errorf("avvio servizio %s fallito: %w", name, err)
+		}
+	case svc.Paused, svc.PausePending:
+		if _, err := s.Control(svc.Continue); err != nil {
+			return fmt.Errorf("ripresa servizio %s fallita: %w", name, err)
+		}
+	}
+	if _, err := c.wait(s, name, svc.Running); err != nil {
+		return err
+	}
+	logger.Info("Servizio %s avviato", name)
+	return nil
+}
+
+func (c *serviceController) stop(s serviceHandle, name string) error {
+	status, err := s.Query()
+	if err != nil {
+		return fmt.Errorf("impossibile leggere stato servizio %s: %w", name, err)
+	}
+	if status.State == svc.StartPending || status.State == svc.ContinuePending {
+		// Un servizio in avvio non accetta l'arresto: si attende che termini.
+		status, err = c.wait(s, name, svc.Running)
+		if err != nil && status.State != svc.Stopped {
+			return err
+		}
+	}
+	switch status.State {
+	case svc.Stopped:
+		logger.Info("Servizio %s gia' arrestato", name)
+		return nil
+	case svc.StopPending:
+	default:
+		if _, err := s.Control(svc.Stop); err != nil {
+			switch {
+			case errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE):
+				return nil
+			case errors.Is(err, windows.ERROR_DEPENDENT_SERVICES_RUNNING):
+				return fmt.Errorf("servizio %s non arrestato: altri servizi in esecuzione dipendono da esso", name)
+			}
+			return fmt.Errorf("arresto servizio %s fallito: %w", name, err)
+		}
+	}
+	if _, err := c.wait(s, name, svc.Stopped); err != nil {
+		return err
+	}
+	logger.Info("Servizio %s arrestato", name)
+	return nil
+}
+
+// wait interroga il servizio finche' raggiunge want o scade il timeout. Un
+// servizio che si arresta mentre si attende l'avvio e' un errore immediato.
+func (c *serviceController) wait(s serviceHandle, name string, want svc.State) (svc.Status, error) {
+	deadline := c.now().Add(c.timeout)
+	for {
+		status, err := s.Query()
+		if err != nil {
+			return status, fmt.Errorf("impossibile leggere stato servizio %s: %w", name, err)
+		}
+		if status.State == want {
+			return status, nil
+		}
+		if want == svc.Running && status.State == svc.Stopped {
+			return status, fmt.Errorf("servizio %s terminato durante l'avvio (codice %d)", name, exitCode(status))
+		}
+		if !c.now().Before(deadline) {
+			return status, fmt.Errorf("timeout dopo %s: servizio %s in stato %s invece di %s",
+				c.timeout, name, stateName(status.State), stateName(want))
+		}
+		c.sleep(pollInterval(status.WaitHint))
+	}
+}
+
+// pollInterval segue l'indicazione del servizio (WaitHint, in ms) come
+// suggerito da Microsoft: un decimo dell'attesa, tra 250 ms e 2 s.
+func pollInterval(waitHint uint32) time.Duration {
+	d := time.Duration(waitHint) * time.Millisecond / 10
+	return min(max(d, 250*time.Millisecond), 2*time.Second)
+}
+
+func exitCode(status svc.Status) uint32 {
+	if status.Win32ExitCode == uint32(windows.ERROR_SERVICE_SPECIFIC_ERROR) {
+		return status.ServiceSpecificExitCode
+	}
+	return status.Win32ExitCode
+}
+
+func stateName(state svc.State) string {
+	switch state {
+	case svc.Stopped:
+		return "stopped"
+	case svc.StartPending:
+		return "start-pending"
+	case svc.StopPending:
+		return "stop-pending"
+	case svc.Running:
+		return "running"
+	case svc.ContinuePending:
+		return "continue-pending"
+	case svc.PausePending:
+		return "pause-pending"
+	case svc.Paused:
+		return "paused"
+	}
+	return fmt.Sprintf("stato %d", state)
+}
+
+// create installa il servizio o, se esiste gia', ne aggiorna la configurazione.
+func (c *serviceController) create(step module.Step) (string, error) {
+	name, cfg := step.Value, step.Service
+	s, err := c.scm.OpenService(name)
+	switch {
+	case err == nil:
+		defer s.Close()
+		if err := c.configure(s, step); err != nil {
+			return "", err
+		}
+	case errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST):
+		config := mgr.Config{
+			DisplayName:      cfg.DisplayName,
+			Description:      cfg.Description,
+			ServiceStartName: cfg.Account,
+			Password:         cfg.Password,
+			Dependencies:     cfg.Dependencies,
+		}
+		config.StartType, config.DelayedAutoStart = startType(cfg.StartType)
+		s, err = c.scm.CreateService(name, os.ExpandEnv(cfg.BinaryPath), config, parseArgs(step.Args)...)
+		if err != nil {
+			return "", fmt.Errorf("creazione servizio %s fallita: %w", name, err)
+		}
+		defer s.Close()
+		if err := setRecovery(s, cfg); err != nil {
+			return "", fmt.Errorf("servizio %s: %w", name, err)
+		}
+		logger.Info("Servizio %s creato", name)
+	default:
+		return "", fmt.Errorf("impossibile aprire servizio %s: %w", name, err)
+	}
+
+	status, err := s.Query()
+	if err != nil {
+		return "", fmt.Errorf("impossibile leggere stato servizio %s: %w", name, err)
+	}
+	return stateName(status.State), nil
+}
+
+// configure applica i campi valorizzati di step.Service alla configurazione
+// attuale del servizio.
+func (c *serviceController) configure(s serviceHandle, step module.Step) error {
+	name, cfg := step.Value, step.Service
+	config, err := s.Config()
+	if err != nil {
+		return fmt.Errorf("impossibile leggere configurazione servizio %s: %w", name, err)
+	}
+	if cfg.BinaryPath != "" {
+		cmdLine := syscall.EscapeArg(os.ExpandEnv(cfg.BinaryPath))
+		for _, arg := range parseArgs(step.Args) {
+			cmdLine += " " + syscall.EscapeArg(arg)
+		}
+		config.BinaryPathName = cmdLine
+	}
+	if cfg.StartType != "" {
+		config.StartType, config.DelayedAutoStart = startType(cfg.StartType)
+	}
+	if cfg.Account != "" {
+		config.ServiceStartName = cfg.Account
+		config.Password = cfg.Password
+	}
+	if cfg.DisplayName != "" {
+		config.DisplayName = cfg.DisplayName
+	}
+	if cfg.Description != "" {
+		config.Description = cfg.Description
+	}
+	if cfg.Dependencies != nil {
+		config.Dependencies = cfg.Dependencies
+	}
+	if err := s.UpdateConfig(config); err != nil {
+		return fmt.Errorf("configurazione servizio %s fallita: %w", name, err)
+	}
+	if err := setRecovery(s, cfg); err != nil {
+		return fmt.Errorf("servizio %s: %w", name, err)
+	}
+	logger.Info("Servizio %s configurato", name)
+	return nil
+}
+
+func startType(name string) (uint32, bool) {
+	switch name {
+	case module.StartAuto:
+		return mgr.StartAutomatic, false
+	case module.StartDelayedAuto:
+		return mgr.StartAutomatic, true
+	case module.StartDisabled:
+		return mgr.StartDisabled, false
+	}
+	return mgr.StartManual, false
+}
+
+func setRecovery(s serviceHandle, cfg *module.ServiceConfig) error {
+	if len(cfg.Recovery) == 0 {
+		return nil
+	}
+	if cfg.RecoveryCommand != "" {
+		if err := s.SetRecoveryCommand(os.ExpandEnv(cfg.RecoveryCommand)); err != nil {
+			return fmt.Errorf("impossibile impostare il comando di ripristino: %w", err)
+		}
+	}
+	actions := make([]mgr.RecoveryAction, len(cfg.Recovery))
+	for i, r := range cfg.Recovery {
+		actions[i].Delay = time.Duration(r.Delay) * time.Second
+		switch r.Action {
+		case module.RecoveryRestart:
+			actions[i].Type = mgr.ServiceRestart
+		case module.RecoveryReboot:
+			actions[i].Type = mgr.ComputerReboot
+		case module.RecoveryRunCommand:
+			actions[i].Type = mgr.RunCommand
+		default:
+			actions[i].Type = mgr.NoAction
+		}
+	}
+	if err := s.SetRecoveryActions(actions, uint32(cfg.ResetPeriod)); err != nil {
+		return fmt.Errorf("impossibile impostare le azioni di ripristino: %w", err)
+	}
+	return nil
+}
+
+// delete arresta ed elimina il servizio, attendendo che l'SCM lo rimuova.
+// Se un altro processo ne tiene aperto un handle (es. services.msc) resta
+// marcato per l'eliminazione, che avverra' alla chiusura o al riavvio.
+func (c *serviceController) delete(name string) (string, error) {
+	s, err := c.scm.OpenService(name)
+	if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+		logger.Info("Servizio %s non installato", name)
+		return "absent", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("impossibile aprire servizio %s: %w", name, err)
+	}
+	err = c.stop(s, name)
+	if err == nil {
+		if err = s.Delete(); errors.Is(err, windows.ERROR_SERVICE_MARKED_FOR_DELETE) {
+			err = nil
+		}
+	}
+	s.Close()
+	if err != nil {
+		return "", fmt.Errorf("eliminazione servizio %s fallita: %w", name, err)
+	}
+
+	deadline := c.now().Add(c.timeout)
+	for {
+		s, err := c.scm.OpenService(name)
+		if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+			logger.Info("Servizio %s eliminato", name)
+			return "absent", nil
+		}
+		if err == nil {
+			s.Close()
+		}
+		if !c.now().Before(deadline) {
+			logger.Warn("Servizio %s marcato per l'eliminazione: sara' rimosso alla chiusura degli handle aperti o al riavvio", name)
+			return "deleted", nil
+		}
+		c.sleep(500 * time.Millisecond)
+	}
+}
@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"WebGainInstaller/internal/module"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// fakeService simula un servizio: ogni Query restituisce il prossimo stato
+// della coda, poi resta sull'ultimo. Start e Stop accodano le transizioni
+// previste dal test.
+type fakeService struct {
+	status    svc.Status
+	queue     []svc.Status
+	onStart   []svc.Status
+	onStop    []svc.Status
+	deleteErr error
+	// held simula un handle aperto da un altro processo: il servizio
+	// eliminato resta visibile all'SCM.
+	held    bool
+	deleted bool
+	calls   []string
+}
+
+func (f *fakeService) Query() (svc.Status, error) {
+	if len(f.queue) > 0 {
+		f.status, f.queue = f.queue[0], f.queue[1:]
+	}
+	return f.status, nil
+}
+
+func (f *fakeService) Start(args ...string) error {
+	f.calls = append(f.calls, "start")
+	f.queue = append(f.queue, f.onStart...)
+	return nil
+}
+
+func (f *fakeService) Control(c svc.Cmd) (svc.Status, error) {
+	if c == svc.Stop {
+		f.calls = append(f.calls, "stop")
+		f.queue = append(f.queue, f.onStop...)
+	}
+	return f.status, nil
+}
+
+func (f *fakeService) Delete() error {
+	f.calls = append(f.calls, "delete")
+	f.deleted = true
+	return f.deleteErr
+}
+
+func (f *fakeService) Config() (mgr.Config, error)     { return mgr.Config{}, nil }
+func (f *fakeService) UpdateConfig(c mgr.Config) error { return nil }
+func (f *fakeService) SetRecoveryCommand(string) error { return nil }
+func (f *fakeService) Close() error                    { return nil }
+
+func (f *fakeService) SetRecoveryActions([]mgr.RecoveryAction, uint32) error { return nil }
+
+type fakeSCM struct {
+	services map[string]*fakeService
+}
+
+func (m *fakeSCM) OpenService(name string) (serviceHandle, error) {
+	s, ok := m.services[name]
+	if !ok || (s.deleted && !s.held) {
+		return nil, windows.ERROR_SERVICE_DOES_NOT_EXIST
+	}
+	return s, nil
+}
+
+func (m *fakeSCM) CreateService(name, exePath string, cfg mgr.Config, args ...string) (serviceHandle, error) {
+	s := &fakeService{status: svc.Status{State: svc.Stopped}}
+	m.services[name] = s
+	return s, nil
+}
+
+// newFakeController restituisce un controller con un orologio simulato:
+// sleep fa avanzare now senza attendere.
+func newFakeController(s *fakeService, timeout time.Duration) (*serviceController, *time.Duration) {
+	c := newServiceController(&fakeSCM{services: map[string]*fakeService{"demo": s}}, timeout)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var elapsed time.Duration
+	c.now = func() time.Time { return start.Add(elapsed) }
+	c.sleep = func(d time.Duration) { elapsed += d }
+	return c, &elapsed
+}
+
+func state(s svc.State) svc.Status {
+	return svc.Status{State: s}
+}
+
+func TestServiceRestartFromStopPending(t *testing.T) {
+	s := &fakeService{
+		status:  state(svc.StopPending),
+		queue:   []svc.Status{state(svc.StopPending), state(svc.StopPending), state(svc.Stopped)},
+		onStart: []svc.Status{state(svc.StartPending), state(svc.Running)},
+	}
+	c, _ := newFakeController(s, 30*time.Second)
+
+	got, err := c.run(module.Step{Type: "service", Value: "demo", Action: module.ServiceRestart})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "running" {
+		t.Errorf("stato = %q, atteso running", got)
+	}
+	// gia' in arresto: non va inviato un secondo Stop
+	if strings.Join(s.calls, ",") != "start" {
+		t.Errorf("chiamate = %v, attese [start]", s.calls)
+	}
+}
+
+func TestServiceRestartStopsRunning(t *testing.T) {
+	s := &fakeService{
+		status:  state(svc.Running),
+		onStop:  []svc.Status{state(svc.StopPending), state(svc.Stopped)},
+		onStart: []svc.Status{state(svc.StartPending), state(svc.Running)},
+	}
+	c, _ := newFakeController(s, 30*time.Second)
+
+	got, err := c.run(module.Step{Type: "service", Value: "demo", Action: module.ServiceRestart})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "running" || strings.Join(s.calls, ",") != "stop,start" {
+		t.Errorf("stato = %q, chiamate = %v", got, s.calls)
+	}
+}
+
+func TestServiceStartThenCrash(t *testing.T) {
+	s := &fakeService{
+		status: state(svc.Stopped),
+		onStart: []svc.Status{
+			state(svc.StartPending),
+			{State: svc.Stopped, Win32ExitCode: uint32(windows.ERROR_SERVICE_SPECIFIC_ERROR), ServiceSpecificExitCode: 42},
+		},
+	}
+	c, elapsed := newFakeController(s, 30*time.Second)
+
+	_, err := c.run(module.Step{Type: "service", Value: "demo", Action: module.ServiceStart})
+	if err == nil || !strings.Contains(err.Error(), "terminato durante l'avvio (codice 42)") {
+		t.Fatalf("errore = %v, atteso arresto durante l'avvio con codice 42", err)
+	}
+	if *elapsed >= 30*time.Second {
+		t.Errorf("attesi %s: l'arresto va segnalato senza attendere il timeout", *elapsed)
+	}
+}
+
+func TestServiceStartTimeout(t *testing.T) {
+	s := &fakeService{
+		status:  state(svc.Stopped),
+		onStart: []svc.Status{{State: svc.StartPending, WaitHint: 5000}},
+	}
+	c, elapsed := newFakeController(s, 30*time.Second)
+
+	_, err := c.run(module.Step{Type: "service", Value: "demo", Action: module.ServiceStart})
+	if err == nil || !strings.Contains(err.Error(), "timeout dopo 30s") || !strings.Contains(err.Error(), "start-pending") {
+		t.Fatalf("errore = %v, atteso timeout in start-pending", err)
+	}
+	if *elapsed < 30*time.Second || *elapsed > 31*time.Second {
+		t.Errorf("tempo simulato %s, atteso il timeout di 30s", *elapsed)
+	}
+}
+
+func TestServiceDelete(t *testing.T) {
+	s := &fakeService{
+		status: state(svc.Running),
+		onStop: []svc.Status{state(svc.StopPending), state(svc.Stopped)},
+	}
+	c, _ := newFakeController(s, 30*time.Second)
+
+	got, err := c.run(module.Step{Type: "service", Value: "demo", Action: module.ServiceDelete})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "absent" || strings.Join(s.calls, ",") != "stop,delete" {
+		t.Errorf("stato = %q, chiamate = %v", got, s.calls)
+	}
+}
+
+func TestServiceDeleteMarkedForDeletion(t *testing.T) {
+	s := &fakeService{
+		status:    state(svc.Stopped),
+		deleteErr: windows.ERROR_SERVICE_MARKED_FOR_DELETE,
+		held:      true,
+	}
+	c, elapsed := newFakeController(s, 10*time.Second)
+
+	got, err := c.run(module.Step{Type: "service", Value: "demo", Action: module.ServiceDelete})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "deleted" {
+		t.Errorf("stato = %q, atteso deleted", got)
+	}
+	if *elapsed < 10*time.Second {
+		t.Errorf("tempo simulato %s: la rimozione va attesa fino al timeout", *elapsed)
+	}
+}
+
+func TestServiceQueryAbsent(t *testing.T) {
+	c, _ := newFakeController(&fakeService{}, time.Second)
+	got, err := c.run(module.Step{Type: "service", Value: "altro", Action: module.ServiceQuery})
+	if err != nil || got != "absent" {
+		t.Errorf("stato = %q, errore = %v, atteso absent", got, err)
+	}
+}
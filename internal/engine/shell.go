@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"WebGainInstaller/internal/configedit"
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// configureShell scrive step.Content nel blocco gestito del modulo
+// (# >>> webgain:<cartella> >>>) nei file del target, sostituendo quello di
+// un'esecuzione precedente; con action remove elimina il blocco.
+func configureShell(step module.Step, folder string) error {
+	if err := step.ValidateShell(); err != nil {
+		return err
+	}
+	name := step.ShellBlockName(folder)
+	if step.Target == "cmd_autorun" {
+		return configureAutoRun(step, name)
+	}
+
+	paths, err := shellProfiles(step)
+	if err != nil {
+		return err
+	}
+	// I profili PowerShell sono file Windows, gli rc di bash e zsh no.
+	crlf := strings.HasSuffix(strings.ToLower(paths[0]), ".ps1")
+	for _, p := range paths {
+		if _, err := updateShellFile(p, step, name, module.ShellTargets[step.Target], "", crlf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shellProfiles restituisce i file da modificare per il target; dest, se
+// presente, sostituisce il percorso predefinito.
+func shellProfiles(step module.Step) ([]string, error) {
+	if step.Dest != "" {
+		return []string{os.ExpandEnv(step.Dest)}, nil
+	}
+	switch step.Target {
+	case "powershell_profile":
+		profileDir := filepath.Join(os.Getenv("ProgramFiles"), "PowerShell", "7")
+		if _, err := os.Stat(profileDir); os.IsNotExist(err) {
+			profileDir = filepath.Join(os.Getenv("WINDIR"), "System32", "WindowsPowerShell", "v1.0")
+		}
+		return []string{filepath.Join(profileDir, "profile.ps1")}, nil
+	case "powershell_user", "windows_powershell_user", "pwsh_user":
+		docs, err := windows.KnownFolderPath(windows.FOLDERID_Documents, 0)
+		if err != nil {
+			return nil, fmt.Errorf("impossibile trovare la cartella Documenti: %w", err)
+		}
+		windowsPS := filepath.Join(docs, "WindowsPowerShell", "profile.ps1")
+		pwsh := filepath.Join(docs, "PowerShell", "profile.ps1")
+		switch step.Target {
+		case "windows_powershell_user":
+			return []string{windowsPS}, nil
+		case "pwsh_user":
+			return []string{pwsh}, nil
+		}
+		return []string{windowsPS, pwsh}, nil
+	case "bash_rc", "zsh_rc":
+		// Git Bash usa HOME se definita, altrimenti il profilo utente.
+		home := os.Getenv("HOME")
+		if home == "" {
+			var err error
+			if home, err = os.UserHomeDir(); err != nil {
+				return nil, err
+			}
+		}
+		return []string{filepath.Join(home, rcFile(step.Target))}, nil
+	case "wsl_bash_rc", "wsl_zsh_rc":
+		home, err := wslHome()
+		if err != nil {
+			return nil, err
+		}
+		return []string{filepath.Join(home, rcFile(step.Target))}, nil
+	}
+	return nil, fmt.Errorf("target shell sconosciuto: %s", step.Target)
+}
+
+func rcFile(target string) string {
+	if strings.HasSuffix(target, "zsh_rc") {
+		return ".zshrc"
+	}
+	return ".bashrc"
+}
+
+// wslHome restituisce la home della distribuzione WSL predefinita come
+// percorso Windows (\\wsl.localhost\<distro>\home\<utente>).
+func wslHome() (string, error) {
+	out, err := exec.Command("wsl.exe", "-e", "sh", "-c", `wslpath -w "$HOME"`).Output()
+	home := strings.TrimSpace(string(out))
+	if err != nil || home == "" {
+		return "", fmt.Errorf("WSL non disponibile o senza distribuzione predefinita: %v", err)
+	}
+	return home, nil
+}
+
+// updateShellFile applica lo step al file p e ne restituisce il nuovo
+// contenuto. header e' la prima riga dei file creati.
+func updateShellFile(p string, step module.Step, name, comment, header string, crlf bool) (string, error) {
+	data, err := os.ReadFile(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("impossibile leggere profilo shell %s: %w", p, err)
+	}
+	existing := string(data)
+
+	if step.Action == module.ShellActionRemove {
+		updated, removed, err := configedit.RemoveBlock(existing, name, comment)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", p, err)
+		}
+		if !removed {
+			return existing, nil
+		}
+		if err := writeFileAtomic(p, []byte(updated)); err != nil {
+			return "", err
+		}
+		logger.Info("Blocco webgain:%s rimosso da %s", name, p)
+		return updated, nil
+	}
+
+	text := existing
+	if text == "" && header != "" {
+		text = header + "\n"
+	}
+	updated, err := configedit.SetBlock(text, name, comment, step.Content, step.Legacy)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", p, err)
+	}
+	if existing == "" && crlf {
+		updated = strings.ReplaceAll(updated, "\n", "\r\n")
+	}
+	if updated == existing {
+		logger.Info("Blocco webgain:%s gia' aggiornato in %s", name, p)
+		return updated, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", fmt.Errorf("impossibile creare directory profilo: %w", err)
+	}
+	if err := writeFileAtomic(p, []byte(updated)); err != nil {
+		return "", err
+	}
+	logger.Info("Blocco webgain:%s scritto in %s", name, p)
+	return updated, nil
+}
+
+// configureAutoRun gestisce i blocchi in WebGain\autorun.cmd e lo collega al
+// valore AutoRun del Command Processor, che cmd esegue all'avvio. Quando non
+// restano blocchi il collegamento e lo script vengono rimossi.
+func configureAutoRun(step module.Step, name string) error {
+	root, dir := registry.LOCAL_MACHINE, os.Getenv("ProgramData")
+	if step.Scope == "user" {
+		root, dir = registry.CURRENT_USER, os.Getenv("LOCALAPPDATA")
+	}
+	script := filepath.Join(dir, "WebGain", "autorun.cmd")
+	text, err := updateShellFile(script, step, name, "REM", "@echo off", true)
+	if err != nil {
+		return err
+	}
+
+	key, _, err := registry.CreateKey(root, `Software\Microsoft\Command Processor`, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("impossibile aprire chiave Command Processor: %w", err)
+	}
+	defer key.Close()
+	current, _, err := key.GetStringValue("AutoRun")
+	if err != nil && err != registry.ErrNotExist {
+		return fmt.Errorf("impossibile leggere AutoRun: %w", err)
+	}
+
+	call := `if exist "` + script + `" call "` + script + `"`
+	if configedit.HasBlocks(text, "REM") {
+		if strings.Contains(current, call) {
+			return nil
+		}
+		if current != "" {
+			call = current + " & " + call
+		}
+		if err := key.SetStringValue("AutoRun", call); err != nil {
+			return fmt.Errorf("impossibile impostare AutoRun: %w", err)
+		}
+		logger.Info("AutoRun di cmd collegato a %s", script)
+		return nil
+	}
+
+	if text == "" || strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "@echo off")) == "" {
+		os.Remove(script)
+	}
+	if !strings.Contains(current, call) {
+		return nil
+	}
+	updated := strings.TrimSpace(strings.NewReplacer(" & "+call, "", call+" & ", "", call, "").Replace(current))
+	if updated == "" {
+		err = key.DeleteValue("AutoRun")
+	} else {
+		err = key.SetStringValue("AutoRun", updated)
+	}
+	if err != nil {
+		return fmt.Errorf("impossibile aggiornare AutoRun: %w", err)
+	}
+	logger.Info("AutoRun di cmd scollegato da %s", script)
+	return nil
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+	"WebGainInstaller/internal/shelllink"
+
+	"golang.org/x/sys/windows"
+)
+
+// shortcutFolders sono le cartelle dei target per tutti gli utenti e per
+// l'utente corrente.
+var shortcutFolders = map[string][2]*windows.KNOWNFOLDERID{
+	module.ShortcutStartMenu: {windows.FOLDERID_CommonPrograms, windows.FOLDERID_Programs},
+	module.ShortcutDesktop:   {windows.FOLDERID_PublicDesktop, windows.FOLDERID_Desktop},
+	module.ShortcutStartup:   {windows.FOLDERID_CommonStartup, windows.FOLDERID_Startup},
+}
+
+// manageShortcut crea o elimina il collegamento .lnk dello step, scritto
+// direttamente nel formato Shell Link senza WScript.
+func manageShortcut(step module.Step) error {
+	if err := step.ValidateShortcut(); err != nil {
+		return err
+	}
+	root, lnk, err := shortcutPath(step)
+	if err != nil {
+		return err
+	}
+
+	if step.Action == module.ShortcutDelete {
+		if err := os.Remove(lnk); errors.Is(err, fs.ErrNotExist) {
+			logger.Info("Collegamento %s gia' assente", lnk)
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("impossibile eliminare collegamento %s: %w", lnk, err)
+		}
+		// Le sottocartelle create per il collegamento (es. nel menu Start)
+		// vengono rimosse se restano vuote.
+		for dir := filepath.Dir(lnk); root != "" && dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+		logger.Info("Collegamento %s eliminato", lnk)
+		return nil
+	}
+
+	cfg := step.Shortcut
+	target := filepath.Clean(os.ExpandEnv(cfg.Target))
+	link := shelllink.Link{
+		Target:       target,
+		Arguments:    expandVars(step.Args),
+		WorkingDir:   os.ExpandEnv(cfg.WorkingDir),
+		Description:  cfg.Description,
+		IconLocation: os.ExpandEnv(cfg.Icon),
+		IconIndex:    int32(cfg.IconIndex),
+		RunAsAdmin:   cfg.RunAsAdmin,
+	}
+	switch cfg.Window {
+	case "maximized":
+		link.ShowCommand = shelllink.ShowMaximized
+	case "minimized":
+		link.ShowCommand = shelllink.ShowMinimized
+	}
+	if info, err := os.Stat(target); err == nil {
+		link.TargetIsDir = info.IsDir()
+	} else {
+		logger.Warn("Collegamento %s: target %s non trovato", lnk, target)
+	}
+	if link.WorkingDir == "" && !link.TargetIsDir {
+		link.WorkingDir = filepath.Dir(target)
+	}
+
+	data, err := link.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("collegamento %s: %w", lnk, err)
+	}
+	if existing, err := os.ReadFile(lnk); err == nil && bytes.Equal(existing, data) {
+		logger.Info("Collegamento %s gia' aggiornato", lnk)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(lnk), 0755); err != nil {
+		return fmt.Errorf("impossibile creare cartella collegamento: %w", err)
+	}
+	if err := writeFileAtomic(lnk, data); err != nil {
+		return err
+	}
+	logger.Info("Collegamento %s -> %s creato", lnk, target)
+	return nil
+}
+
+// shortcutPath restituisce la cartella del target (vuota con dest) e il
+// percorso del file .lnk.
+func shortcutPath(step module.Step) (string, string, error) {
+	if step.Dest != "" {
+		lnk := filepath.Clean(os.ExpandEnv(step.Dest))
+		if filepath.Ext(lnk) == "" {
+			lnk += ".lnk"
+		}
+		return "", lnk, nil
+	}
+	folders := shortcutFolders[step.Target]
+	folder := folders[0]
+	if step.Scope == "user" {
+		folder = folders[1]
+	}
+	root, err := windows.KnownFolderPath(folder, 0)
+	if err != nil {
+		return "", "", fmt.Errorf("impossibile trovare la cartella %s: %w", step.Target, err)
+	}
+	return root, filepath.Join(root, step.ShortcutFile()), nil
+}
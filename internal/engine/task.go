@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+	"WebGainInstaller/internal/taskxml"
+)
+
+// scheduleTask crea, aggiorna o elimina l'attivita' pianificata dello step.
+// La definizione viene convertita in XML e registrata con schtasks /XML, che
+// sostituisce un'attivita' esistente con lo stesso nome; con logonType
+// password la registrazione passa da registerTaskWithPassword.
+func scheduleTask(step module.Step) (string, error) {
+	if err := step.ValidateTask(); err != nil {
+		return "", err
+	}
+	name := step.TaskName()
+	exists := taskExists(name)
+
+	switch step.Action {
+	case module.TaskDelete:
+		if !exists {
+			logger.Info("Attivita' %s gia' assente", name)
+			return "", nil
+		}
+		out, err := exec.Command("schtasks.exe", "/Delete", "/TN", name, "/F").CombinedOutput()
+		if err != nil {
+			return string(out), fmt.Errorf("eliminazione attivita' %s fallita: %w\nOutput: %s", name, err, string(out))
+		}
+		logger.Info("Attivita' %s eliminata", name)
+		return string(out), nil
+	case module.TaskUpdate:
+		if !exists {
+			return "", fmt.Errorf("attivita' %s non registrata", name)
+		}
+	}
+
+	task := *step.Task
+	task.Command = os.ExpandEnv(task.Command)
+	task.Arguments = expandVars(task.Arguments)
+	task.WorkingDirectory = os.ExpandEnv(task.WorkingDirectory)
+	if task.Author == "" {
+		task.Author = "WebGain Installer"
+	}
+	doc, err := taskxml.Marshal(name, task)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp("", "webgain-task-*.xml")
+	if err != nil {
+		return "", fmt.Errorf("impossibile creare XML attivita': %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(taskxml.Encode(doc))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("impossibile scrivere XML attivita': %w", err)
+	}
+
+	var out []byte
+	if p := task.Principal; p.Password != "" {
+		logger.AddSecret(p.Password)
+		out, err = registerTaskWithPassword(name, tmp.Name(), p.User, p.Password)
+	} else {
+		out, err = exec.Command("schtasks.exe", "/Create", "/TN", name, "/XML", filepath.Clean(tmp.Name()), "/F").CombinedOutput()
+	}
+	if err != nil {
+		logger.Debug("XML attivita' %s:\n%s", name, doc)
+		return string(out), fmt.Errorf("registrazione attivita' %s fallita: %w\nOutput: %s", name, err, string(out))
+	}
+	if exists {
+		logger.Info("Attivita' %s aggiornata", name)
+	} else {
+		logger.Info("Attivita' %s creata", name)
+	}
+	return string(out), nil
+}
+
+// taskExists indica se l'attivita' e' registrata; schtasks /Query termina
+// con errore quando non la trova.
+func taskExists(name string) bool {
+	return exec.Command("schtasks.exe", "/Query", "/TN", name).Run() == nil
+}
+
+// registerTaskScript registra l'XML con Register-ScheduledTask, che usa
+// RegisterTaskDefinition dell'Utilita' di pianificazione. Percorsi e account
+// arrivano dall'ambiente, la password dallo standard input.
+const registerTaskScript = `$ErrorActionPreference = 'Stop'
+$password = [Console]::In.ReadLine()
+$xml = [IO.File]::ReadAllText($env:WEBGAIN_TASK_XML)
+Register-ScheduledTask -TaskPath $env:WEBGAIN_TASK_PATH -TaskName $env:WEBGAIN_TASK_NAME -Xml $xml -User $env:WEBGAIN_TASK_USER -Password $password -Force | Out-Null`
+
+// registerTaskWithPassword registra un'attivita' con logonType password senza
+// schtasks /RP, che esporrebbe la password nella riga di comando a qualunque
+// utente possa elencare i processi.
+func registerTaskWithPassword(name, xmlPath, user, password string) ([]byte, error) {
+	i := strings.LastIndex(name, `\`)
+	// lo script, senza dati sensibili, va in -EncodedCommand (UTF-16LE in
+	// base64), cosi' lo standard input contiene solo la password
+	units := utf16.Encode([]rune(registerTaskScript))
+	script := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		script = append(script, byte(u), byte(u>>8))
+	}
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+		"-EncodedCommand", base64.StdEncoding.EncodeToString(script))
+	cmd.Env = append(os.Environ(),
+		"WEBGAIN_TASK_XML="+filepath.Clean(xmlPath),
+		"WEBGAIN_TASK_PATH="+name[:i+1],
+		"WEBGAIN_TASK_NAME="+name[i+1:],
+		"WEBGAIN_TASK_USER="+user,
+	)
+	cmd.Stdin = strings.NewReader(password + "\n")
+	return cmd.CombinedOutput()
+}
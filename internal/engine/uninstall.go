@@ -0,0 +1,281 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+	"WebGainInstaller/internal/setup"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// installerName e' il nome della copia dell'installer usata da UninstallString.
+const installerName = "WebGainInstaller.exe"
+
+// uninstallDir e' la cartella in cui restano la definizione del modulo e i
+// file degli step onUninstall, necessari anche dopo la pulizia di WEBGAINROOT.
+// E' riservata ad amministratori e SYSTEM: Uninstall ne esegue il contenuto
+// con privilegi elevati.
+func uninstallDir(folder string) (string, error) {
+	base, err := setup.SecureDir("uninstall")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, folder), nil
+}
+
+// registerUninstall salva quanto serve alla disinstallazione del modulo e ne
+// registra la voce in App installate, sostituendo quella di un'installazione
+// precedente.
+func registerUninstall(mod *module.Module, workDir string) error {
+	entry := mod.Command.Uninstall
+	dir, err := uninstallDir(mod.FolderName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("impossibile creare cartella %s: %w", dir, err)
+	}
+	// Si conservano solo gli step onUninstall: gli altri, con gli eventuali
+	// segreti, non servono piu'.
+	saved := mod.Command
+	saved.Steps = nil
+	for _, step := range mod.Command.Steps {
+		if step.OnUninstall {
+			saved.Steps = append(saved.Steps, withoutUnusedPasswords(step))
+		}
+	}
+	data, err := json.MarshalIndent(saved, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "command.json"), data); err != nil {
+		return err
+	}
+	for _, step := range saved.Steps {
+		if step.File == "" {
+			continue
+		}
+		src := filepath.Join(workDir, filepath.FromSlash(step.File))
+		if info, err := os.Stat(src); err != nil || !info.Mode().IsRegular() {
+			logger.Warn("Modulo %s: %s non conservato per la disinstallazione, non e' un file", mod.FolderName, step.File)
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(step.File))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := copyContent(src, target); err != nil {
+			return err
+		}
+	}
+
+	exe, err := persistInstaller()
+	if err != nil {
+		return err
+	}
+
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, module.UninstallKeyPrefix+mod.FolderName, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("impossibile creare voce di disinstallazione: %w", err)
+	}
+	defer key.Close()
+
+	name := entry.DisplayName
+	if name == "" {
+		name = mod.Command.Name
+	}
+	location := os.ExpandEnv(entry.InstallLocation)
+	size := uint64(entry.EstimatedSize)
+	if size == 0 && location != "" {
+		size = dirSizeKB(location)
+	}
+	uninstall := fmt.Sprintf(`"%s" -uninstall="%s"`, exe, mod.FolderName)
+	strs := map[string]string{
+		"DisplayName":          name,
+		"DisplayVersion":       mod.Command.Version,
+		"Publisher":            entry.Publisher,
+		"DisplayIcon":          os.ExpandEnv(entry.Icon),
+		"InstallLocation":      location,
+		"InstallDate":          time.Now().Format("20060102"),
+		"Comments":             mod.Command.Description,
+		"UninstallString":      uninstall,
+		"QuietUninstallString": uninstall + " -quiet",
+	}
+	for valueName, value := range strs {
+		if value == "" {
+			key.DeleteValue(valueName)
+			continue
+		}
+		if err := key.SetStringValue(valueName, value); err != nil {
+			return fmt.Errorf("impossibile impostare %s: %w", valueName, err)
+		}
+	}
+	dwords := map[string]uint32{"NoModify": 1, "NoRepair": 1, "EstimatedSize": uint32(min(size, 0xFFFFFFFF))}
+	for valueName, value := range dwords {
+		if err := key.SetDWordValue(valueName, value); err != nil {
+			return fmt.Errorf("impossibile impostare %s: %w", valueName, err)
+		}
+	}
+	logger.Info("Modulo %s registrato in App installate come %s", mod.FolderName, name)
+	return nil
+}
+
+var (
+	installerOnce sync.Once
+	installerPath string
+	installerErr  error
+)
+
+// persistInstaller copia l'eseguibile in esecuzione nella cartella di
+// disinstallazione, se non e' gia' quella copia, e ne restituisce il percorso.
+// La copia avviene una sola volta per esecuzione, non per ogni modulo.
+func persistInstaller() (string, error) {
+	installerOnce.Do(func() {
+		installerPath, installerErr = copyInstaller()
+	})
+	return installerPath, installerErr
+}
+
+func copyInstaller() (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("impossibile trovare l'eseguibile dell'installer: %w", err)
+	}
+	base, err := setup.SecureDir("uninstall")
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(base, installerName)
+	if same, _ := sameFile(self, target); same {
+		return target, nil
+	}
+	if err := copyContent(self, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// sameFile confronta il contenuto di due file, calcolando l'hash solo se
+// hanno la stessa dimensione.
+func sameFile(a, b string) (bool, error) {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if ia.Size() != ib.Size() {
+		return false, nil
+	}
+	ha, err := fileHash(a)
+	if err != nil {
+		return false, err
+	}
+	hb, err := fileHash(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ha, hb), nil
+}
+
+// dirSizeKB restituisce la dimensione dei file in dir, in KB.
+func dirSizeKB(dir string) uint64 {
+	var total uint64
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				total += uint64(info.Size())
+			}
+		}
+		return nil
+	})
+	return (total + 1023) / 1024
+}
+
+// Uninstall disinstalla il modulo folder registrato in App installate:
+// esegue in ordine i suoi step onUninstall e, se riescono tutti, elimina la
+// voce e i file salvati. In caso di errore la voce resta, cosi' la
+// disinstallazione puo' essere ripetuta.
+func Uninstall(folder string) error {
+	if !fs.ValidPath(folder) || filepath.Base(folder) != folder {
+		return fmt.Errorf("nome modulo non valido: %q", folder)
+	}
+	dir, err := uninstallDir(folder)
+	if err != nil {
+		return err
+	}
+	cmdPath := filepath.Join(dir, "command.json")
+	if _, err := os.Stat(cmdPath); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("modulo %s non registrato per la disinstallazione", folder)
+	}
+	// la definizione e i file salvati vengono eseguiti con privilegi elevati:
+	// devono appartenere ad amministratori o SYSTEM, come l'installer stesso
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("impossibile trovare l'eseguibile dell'installer: %w", err)
+	}
+	for _, p := range []string{dir, cmdPath, self} {
+		if err := setup.CheckTrusted(p); err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(cmdPath)
+	if err != nil {
+		return fmt.Errorf("impossibile leggere definizione del modulo %s: %w", folder, err)
+	}
+	var cmd module.Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return fmt.Errorf("definizione del modulo %s non valida: %w", folder, err)
+	}
+
+	registerStepSecrets(cmd.Steps)
+	logger.Info("Disinstallazione modulo %s", cmd.Name)
+	for i, step := range cmd.Steps {
+		if !step.OnUninstall {
+			continue
+		}
+		logger.Info("Step di disinstallazione %d (%s)", i+1, step.Type)
+		if _, err := executeStep(step, dir, folder); err != nil {
+			return fmt.Errorf("disinstallazione modulo %s, step %d (%s): %w", cmd.Name, i+1, step.Type, err)
+		}
+	}
+
+	err = registry.DeleteKey(registry.LOCAL_MACHINE, module.UninstallKeyPrefix+folder)
+	if err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return fmt.Errorf("impossibile eliminare voce di disinstallazione: %w", err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		logger.Warn("Impossibile eliminare %s: %v", dir, err)
+	}
+	logger.Info("Modulo %s disinstallato", cmd.Name)
+	return nil
+}
+
+// withoutUnusedPasswords toglie dalla copia salvata dello step le password di
+// servizio e attivita', che servono solo a crearli o riconfigurarli.
+func withoutUnusedPasswords(step module.Step) module.Step {
+	if step.Service != nil && step.Service.Password != "" &&
+		step.Action != module.ServiceCreate && step.Action != module.ServiceConfigure {
+		service := *step.Service
+		service.Password = ""
+		step.Service = &service
+	}
+	if step.Task != nil && step.Task.Principal.Password != "" && step.Action == module.TaskDelete {
+		task := *step.Task
+		task.Principal.Password = ""
+		step.Task = &task
+	}
+	return step
+}
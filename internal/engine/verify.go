@@ -0,0 +1,295 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// CheckResult e' l'esito di un controllo dello step verify.
+type CheckResult struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// verifyInstall esegue lo step verify: con checks valuta ogni controllo e
+// fallisce se almeno uno non e' superato, altrimenti esegue command con cmd.exe.
+func verifyInstall(step module.Step) (string, []CheckResult, error) {
+	if err := step.ValidateVerify(); err != nil {
+		return "", nil, err
+	}
+	if len(step.Checks) == 0 {
+		cmd := exec.Command("cmd.exe", "/C", step.Command)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return string(output), nil, fmt.Errorf("verifica fallita (%s): %w\nOutput: %s", step.Command, err, string(output))
+		}
+		return string(output), nil, nil
+	}
+
+	results := make([]CheckResult, len(step.Checks))
+	var lines, failed []string
+	for i, c := range step.Checks {
+		detail, err := runCheck(c)
+		results[i] = CheckResult{Type: c.Type, Name: logger.Redact(c.Label()), Passed: err == nil, Detail: detail}
+		status := "OK"
+		if err != nil {
+			results[i].Detail = err.Error()
+			status = "KO"
+			failed = append(failed, results[i].Name)
+		}
+		results[i].Detail = logger.Redact(results[i].Detail)
+		lines = append(lines, fmt.Sprintf("[%s] %s %s: %s", status, c.Type, results[i].Name, results[i].Detail))
+		logger.Debug("Controllo %s %s: %s", c.Type, results[i].Name, results[i].Detail)
+	}
+	output := strings.Join(lines, "\n")
+	if len(failed) > 0 {
+		return output, results, fmt.Errorf("verifica fallita: %d controlli su %d non superati (%s)", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return output, results, nil
+}
+
+// runCheck esegue un controllo e ne restituisce il dettaglio; l'errore
+// descrive perche' il controllo non e' superato.
+func runCheck(c module.Check) (string, error) {
+	timeout := time.Duration(c.TimeoutSeconds()) * time.Second
+	switch c.Type {
+	case module.CheckFile, module.CheckDir:
+		return checkFile(c)
+	case module.CheckRegistry:
+		return checkRegistry(c)
+	case module.CheckCommand:
+		return checkCommand(c, timeout)
+	case module.CheckPath:
+		return checkExecutable(c, timeout)
+	case module.CheckPort:
+		addr := net.JoinHostPort(c.HostName(), strconv.Itoa(c.Port))
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return "", fmt.Errorf("porta %s non in ascolto: %w", addr, err)
+		}
+		conn.Close()
+		return "porta " + addr + " in ascolto", nil
+	case module.CheckHTTP:
+		return checkHTTP(c, timeout)
+	case module.CheckService:
+		return checkService(c)
+	}
+	return "", fmt.Errorf("tipo di controllo sconosciuto: %s", c.Type)
+}
+
+func checkFile(c module.Check) (string, error) {
+	p := os.ExpandEnv(c.Path)
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", fmt.Errorf("%s non trovato", p)
+	}
+	if c.Type == module.CheckDir {
+		if !info.IsDir() {
+			return "", fmt.Errorf("%s non e' una cartella", p)
+		}
+		return "cartella presente", nil
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s e' una cartella", p)
+	}
+	if c.SHA256 == "" {
+		return fmt.Sprintf("file presente (%d bytes)", info.Size()), nil
+	}
+	sum, err := fileHash(p)
+	if err != nil {
+		return "", fmt.Errorf("impossibile calcolare SHA-256 di %s: %w", p, err)
+	}
+	if got := hex.EncodeToString(sum); !strings.EqualFold(got, c.SHA256) {
+		return "", fmt.Errorf("SHA-256 %s, atteso %s", got, strings.ToLower(c.SHA256))
+	}
+	return "SHA-256 corrispondente", nil
+}
+
+// checkRegistry confronta il valore con il dato atteso secondo il suo tipo:
+// numeri decimali o esadecimali per DWORD e QWORD, byte esadecimali per
+// BINARY, uno degli elementi per MULTI_SZ.
+func checkRegistry(c module.Check) (string, error) {
+	root, path, release, err := openRegistryKey(c.Key)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	key, err := registry.OpenKey(root, path, registry.QUERY_VALUE|registryView(c.View))
+	if err != nil {
+		return "", fmt.Errorf("chiave %s non trovata", c.Key)
+	}
+	defer key.Close()
+
+	_, valType, err := key.GetValue(c.Variable, nil)
+	if err != nil {
+		return "", fmt.Errorf("valore %q non trovato in %s", c.Variable, c.Key)
+	}
+	var actual string
+	matches := false
+	expected := os.ExpandEnv(c.Value)
+	switch valType {
+	case registry.SZ, registry.EXPAND_SZ:
+		actual, _, err = key.GetStringValue(c.Variable)
+		matches = actual == expected
+	case registry.MULTI_SZ:
+		var values []string
+		values, _, err = key.GetStringsValue(c.Variable)
+		actual = strings.Join(values, "; ")
+		for _, v := range values {
+			matches = matches || v == expected
+		}
+	case registry.DWORD, registry.QWORD:
+		var n uint64
+		n, _, err = key.GetIntegerValue(c.Variable)
+		actual = strconv.FormatUint(n, 10)
+		want, perr := strconv.ParseUint(expected, 0, 64)
+		matches = perr == nil && want == n
+	default:
+		var data []byte
+		data, _, err = key.GetBinaryValue(c.Variable)
+		actual = hex.EncodeToString(data)
+		want, herr := hex.DecodeString(strings.NewReplacer(" ", "", ",", "").Replace(expected))
+		matches = herr == nil && bytes.Equal(want, data)
+	}
+	if err != nil {
+		return "", fmt.Errorf("impossibile leggere valore %q in %s: %w", c.Variable, c.Key, err)
+	}
+	if c.Value != "" && !matches {
+		return "", fmt.Errorf("valore %q, atteso %q", actual, expected)
+	}
+	return "valore " + actual, nil
+}
+
+func checkCommand(c module.Check, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "cmd.exe", "/C", expandVars(c.Command)).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("comando non terminato entro %s", timeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("comando fallito: %w: %s", err, excerptLine(output))
+	}
+	if c.Match != "" {
+		if !regexp.MustCompile(c.Match).MatchString(output) {
+			return "", fmt.Errorf("output %q non corrisponde a %s", excerptLine(output), c.Match)
+		}
+	}
+	return excerptLine(output), nil
+}
+
+// checkExecutable cerca l'eseguibile nel PATH e, con minVersion, ne confronta
+// la versione stampata da versionArgs.
+func checkExecutable(c module.Check, timeout time.Duration) (string, error) {
+	exe, err := exec.LookPath(os.ExpandEnv(c.Executable))
+	if err != nil {
+		return "", fmt.Errorf("%s non trovato nel PATH", c.Executable)
+	}
+	if c.MinVersion == "" {
+		return exe, nil
+	}
+
+	args := parseArgs(c.VersionArgs)
+	if c.VersionArgs == "" {
+		args = []string{"--version"}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, exe, args...).CombinedOutput()
+	if err != nil && ctx.Err() != nil {
+		return "", fmt.Errorf("%s non ha risposto entro %s", exe, timeout)
+	}
+	version := module.ParseVersion(string(out))
+	if version == nil {
+		return "", fmt.Errorf("versione non trovata nell'output di %s: %q", exe, excerptLine(string(out)))
+	}
+	found := formatVersion(version)
+	if module.CompareVersions(version, module.ParseVersion(c.MinVersion)) < 0 {
+		return "", fmt.Errorf("%s versione %s, richiesta almeno %s", exe, found, c.MinVersion)
+	}
+	return exe + " versione " + found, nil
+}
+
+func formatVersion(v []int) string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+func checkHTTP(c module.Check, timeout time.Duration) (string, error) {
+	u := os.ExpandEnv(c.URL)
+	client := &http.Client{
+		Timeout: timeout,
+		// Il controllo riguarda l'endpoint indicato, non la destinazione dei redirect.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	res, err := client.Get(u)
+	if err != nil {
+		return "", fmt.Errorf("richiesta a %s fallita: %w", u, err)
+	}
+	res.Body.Close()
+	if res.StatusCode != c.ExpectedStatus() {
+		return "", fmt.Errorf("status %d, atteso %d", res.StatusCode, c.ExpectedStatus())
+	}
+	return "status " + strconv.Itoa(res.StatusCode), nil
+}
+
+func checkService(c module.Check) (string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", fmt.Errorf("impossibile connettersi al Service Control Manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	state := "absent"
+	s, err := m.OpenService(c.Service)
+	switch {
+	case errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST):
+	case err != nil:
+		return "", fmt.Errorf("impossibile aprire servizio %s: %w", c.Service, err)
+	default:
+		status, err := s.Query()
+		s.Close()
+		if err != nil {
+			return "", fmt.Errorf("impossibile leggere stato servizio %s: %w", c.Service, err)
+		}
+		state = stateName(status.State)
+	}
+	if state != c.ExpectedState() {
+		return "", fmt.Errorf("servizio %s, atteso %s", state, c.ExpectedState())
+	}
+	return "servizio " + state, nil
+}
+
+// excerptLine riduce l'output di un controllo alla prima riga.
+func excerptLine(s string) string {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "\n")
+	s = strings.TrimSpace(s)
+	if len(s) > 200 {
+		s = s[:200] + "..."
+	}
+	return strings.ToValidUTF8(s, "?")
+}
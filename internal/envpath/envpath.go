@@ -0,0 +1,215 @@
+package envpath
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// MaxLength e' la dimensione massima di una variabile d'ambiente Windows.
+	MaxLength = 32767
+	// LegacyMaxLength e' il limite oltre il quale setx, l'editor delle variabili
+	// e molti installer troncano PATH.
+	LegacyMaxLength = 2047
+)
+
+const (
+	ActionAppend         = "append"
+	ActionPrepend        = "prepend"
+	ActionRemove         = "remove"
+	ActionEnsurePosition = "ensure-position"
+
+	PositionFirst = "first"
+	PositionLast  = "last"
+)
+
+// LookupFunc risolve una variabile d'ambiente, come os.LookupEnv.
+type LookupFunc func(name string) (string, bool)
+
+// Split divide PATH nelle sue voci, scartando quelle vuote. Le voci tra
+// virgolette possono contenere ';'.
+func Split(path string) []string {
+	var entries []string
+	var b strings.Builder
+	quoted := false
+	flush := func() {
+		if entry := strings.TrimSpace(b.String()); entry != "" {
+			entries = append(entries, entry)
+		}
+		b.Reset()
+	}
+	for _, r := range path {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			b.WriteRune(r)
+		case r == ';' && !quoted:
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+	return entries
+}
+
+// Join ricompone PATH, racchiudendo tra virgolette le voci che contengono ';'.
+func Join(entries []string) string {
+	out := make([]string, len(entries))
+	for i, entry := range entries {
+		if strings.Contains(entry, ";") && !strings.HasPrefix(entry, `"`) {
+			entry = `"` + entry + `"`
+		}
+		out[i] = entry
+	}
+	return strings.Join(out, ";")
+}
+
+// Normalize restituisce la forma canonica di una voce per il confronto:
+// senza virgolette, con le %VARIABILI% espanse, separatori '\', senza '\'
+// finale (tranne per la radice di un'unita') e in minuscolo.
+func Normalize(entry string, lookup LookupFunc) string {
+	entry = strings.TrimSpace(entry)
+	entry = strings.Trim(entry, `"`)
+	entry = ExpandPercent(entry, lookup)
+	entry = strings.ReplaceAll(entry, "/", `\`)
+	for len(entry) > 1 && strings.HasSuffix(entry, `\`) && !(len(entry) == 3 && entry[1] == ':') {
+		entry = entry[:len(entry)-1]
+	}
+	return strings.ToLower(entry)
+}
+
+// ExpandPercent espande i riferimenti %NOME% come fa Windows per REG_EXPAND_SZ;
+// quelli non definiti restano invariati.
+func ExpandPercent(s string, lookup LookupFunc) string {
+	if lookup == nil || !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(s, '%')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start+1:], '%')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+		name := s[start+1 : end]
+		if value, ok := lookup(name); ok && name != "" {
+			b.WriteString(s[:start])
+			b.WriteString(value)
+			s = s[end+1:]
+			continue
+		}
+		b.WriteString(s[:end])
+		s = s[end:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// Edit applica action alla voce entry di current e restituisce il nuovo PATH
+// e se e' cambiato. Le voci sono confrontate esattamente dopo Normalize e i
+// duplicati vengono rimossi mantenendo la prima occorrenza. position vale
+// first (predefinito) o last ed e' usato solo da ensure-position.
+func Edit(current, entry, action, position string, lookup LookupFunc) (string, bool, error) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" || strings.Trim(entry, `"`) == "" {
+		return "", false, fmt.Errorf("voce PATH vuota")
+	}
+	if action == "" {
+		action = ActionAppend
+	}
+	if position == "" {
+		position = PositionFirst
+	}
+	target := Normalize(entry, lookup)
+
+	var entries []string
+	seen := make(map[string]bool)
+	found := false
+	for _, e := range Split(current) {
+		key := Normalize(e, lookup)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if key == target {
+			found = true
+			if action == ActionRemove || action == ActionEnsurePosition {
+				continue
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	switch action {
+	case ActionAppend:
+		if !found {
+			entries = append(entries, entry)
+		}
+	case ActionPrepend:
+		if !found {
+			entries = append([]string{entry}, entries...)
+		}
+	case ActionRemove:
+	case ActionEnsurePosition:
+		switch position {
+		case PositionFirst:
+			entries = append([]string{entry}, entries...)
+		case PositionLast:
+			entries = append(entries, entry)
+		default:
+			return "", false, fmt.Errorf("posizione PATH sconosciuta: %s (ammesse: first, last)", position)
+		}
+	default:
+		return "", false, fmt.Errorf("azione PATH sconosciuta: %s (ammesse: append, prepend, remove, ensure-position)", action)
+	}
+
+	// Un PATH che differisce solo nella forma (voci vuote, '\' finali,
+	// maiuscole) non viene riscritto.
+	if sameEntries(Split(current), entries, lookup) {
+		return current, false, nil
+	}
+	updated := Join(entries)
+	if err := CheckLength(current, updated, lookup); err != nil {
+		return "", false, err
+	}
+	return updated, true, nil
+}
+
+// sameEntries indica se a e b contengono le stesse voci, nello stesso ordine,
+// dopo Normalize.
+func sameEntries(a, b []string, lookup LookupFunc) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if Normalize(a[i], lookup) != Normalize(b[i], lookup) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckLength rifiuta un PATH che, espanso, supera MaxLength, oppure che supera
+// LegacyMaxLength quando il valore precedente ne era entro. Un PATH gia' oltre
+// LegacyMaxLength resta modificabile.
+func CheckLength(previous, updated string, lookup LookupFunc) error {
+	length := charCount(ExpandPercent(updated, lookup))
+	if length > MaxLength {
+		return fmt.Errorf("PATH risultante di %d caratteri supera il limite di Windows di %d", length, MaxLength)
+	}
+	if length > LegacyMaxLength && charCount(ExpandPercent(previous, lookup)) <= LegacyMaxLength {
+		return fmt.Errorf("PATH risultante di %d caratteri supera il limite di %d oltre il quale setx e molti installer lo troncano", length, LegacyMaxLength)
+	}
+	return nil
+}
+
+// charCount conta i caratteri UTF-16, l'unita' dei limiti di Windows.
+func charCount(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
@@ -0,0 +1,148 @@
+package envpath
+
+import (
+	"strings"
+	"testing"
+)
+
+func testLookup(name string) (string, bool) {
+	vars := map[string]string{
+		"SYSTEMROOT":  `C:\Windows`,
+		"PROGRAMDATA": `C:\ProgramData`,
+		"LONG":        strings.Repeat("x", 100),
+	}
+	value, ok := vars[strings.ToUpper(name)]
+	return value, ok
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		entry, want string
+	}{
+		{`C:\Tools`, `c:\tools`},
+		{`C:\Tools\`, `c:\tools`},
+		{`C:\Tools\\`, `c:\tools`},
+		{`C:/Tools/bin/`, `c:\tools\bin`},
+		{`"C:\Program Files\Git\cmd"`, `c:\program files\git\cmd`},
+		{`  C:\Tools  `, `c:\tools`},
+		{`C:\`, `c:\`},
+		{`%SystemRoot%\System32`, `c:\windows\system32`},
+		{`%SYSTEMROOT%\system32\`, `c:\windows\system32`},
+		{`%UNDEFINED%\bin`, `%undefined%\bin`},
+		{`%%`, `%%`},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.entry, testLookup); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, atteso %q", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestSplitJoin(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{``, nil},
+		{`;;`, nil},
+		{`C:\a;;C:\b;`, []string{`C:\a`, `C:\b`}},
+		{` C:\a ; C:\b `, []string{`C:\a`, `C:\b`}},
+		{`"C:\a;b";C:\c`, []string{`"C:\a;b"`, `C:\c`}},
+	}
+	for _, tt := range tests {
+		got := Split(tt.path)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("Split(%q) = %q, atteso %q", tt.path, got, tt.want)
+		}
+	}
+	if got := Join([]string{`C:\a;b`, `C:\c`}); got != `"C:\a;b";C:\c` {
+		t.Errorf("Join = %q", got)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  string
+		entry    string
+		action   string
+		position string
+		want     string
+		changed  bool
+	}{
+		{"append nuova voce", `C:\a;C:\b`, `C:\c`, ActionAppend, "", `C:\a;C:\b;C:\c`, true},
+		{"append gia' presente", `C:\a;C:\b`, `C:\b`, ActionAppend, "", `C:\a;C:\b`, false},
+		{"append con voci vuote", `C:\a;;C:\b;`, `C:\b`, ActionAppend, "", `C:\a;;C:\b;`, false},
+		{"append con \\ finale", `C:\a;C:\b\`, `C:\b`, ActionAppend, "", `C:\a;C:\b\`, false},
+		{"append maiuscole diverse", `C:\Tools\Bin`, `c:\tools\bin`, ActionAppend, "", `C:\Tools\Bin`, false},
+		{"append espansa presente", `%SystemRoot%\system32`, `C:\Windows\System32`, ActionAppend, "", `%SystemRoot%\system32`, false},
+		{"append non espansa presente", `C:\Windows\System32`, `%SYSTEMROOT%\System32`, ActionAppend, "", `C:\Windows\System32`, false},
+		{"append sottocartella", `C:\tools`, `C:\tools\bin`, ActionAppend, "", `C:\tools;C:\tools\bin`, true},
+		{"append prefisso", `C:\tools`, `C:\tool`, ActionAppend, "", `C:\tools;C:\tool`, true},
+		{"append tra virgolette", `"C:\Program Files\x"`, `C:\Program Files\x`, ActionAppend, "", `"C:\Program Files\x"`, false},
+		{"prepend", `C:\a`, `C:\b`, ActionPrepend, "", `C:\b;C:\a`, true},
+		{"prepend gia' presente", `C:\a;C:\b`, `C:\b`, ActionPrepend, "", `C:\a;C:\b`, false},
+		{"remove", `C:\a;C:\b\;C:\c`, `c:\B`, ActionRemove, "", `C:\a;C:\c`, true},
+		{"remove non tocca sottocartelle", `C:\tools;C:\tools\bin`, `C:\tools`, ActionRemove, "", `C:\tools\bin`, true},
+		{"remove assente", `C:\a;C:\tools\bin`, `C:\tools`, ActionRemove, "", `C:\a;C:\tools\bin`, false},
+		{"remove duplicati", `C:\a;C:\b;c:\a\`, `C:\a`, ActionRemove, "", `C:\b`, true},
+		{"append rimuove duplicati", `C:\a;C:\b;C:\A`, `C:\b`, ActionAppend, "", `C:\a;C:\b`, true},
+		{"ensure-position first", `C:\a;C:\b`, `C:\b`, ActionEnsurePosition, "", `C:\b;C:\a`, true},
+		{"ensure-position first gia' prima", `C:\b\;C:\a`, `C:\b`, ActionEnsurePosition, PositionFirst, `C:\b\;C:\a`, false},
+		{"ensure-position last", `C:\b;C:\a`, `C:\b`, ActionEnsurePosition, PositionLast, `C:\a;C:\b`, true},
+		{"PATH vuoto", ``, `C:\a`, ActionAppend, "", `C:\a`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := Edit(tt.current, tt.entry, tt.action, tt.position, testLookup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || changed != tt.changed {
+				t.Errorf("Edit = %q, %v; atteso %q, %v", got, changed, tt.want, tt.changed)
+			}
+		})
+	}
+}
+
+func TestEditErrors(t *testing.T) {
+	tests := []struct {
+		name, entry, action, position string
+	}{
+		{"voce vuota", "  ", ActionAppend, ""},
+		{"solo virgolette", `""`, ActionAppend, ""},
+		{"azione sconosciuta", `C:\a`, "replace", ""},
+		{"posizione sconosciuta", `C:\a`, ActionEnsurePosition, "middle"},
+	}
+	for _, tt := range tests {
+		if _, _, err := Edit(`C:\b`, tt.entry, tt.action, tt.position, testLookup); err == nil {
+			t.Errorf("%s: errore atteso", tt.name)
+		}
+	}
+}
+
+func TestCheckLength(t *testing.T) {
+	short := `C:\a`
+	legacy := strings.Repeat("x", LegacyMaxLength+1)
+	huge := strings.Repeat("x", MaxLength+1)
+	if err := CheckLength(short, short+";"+`C:\b`, testLookup); err != nil {
+		t.Errorf("PATH corto rifiutato: %v", err)
+	}
+	if err := CheckLength(short, legacy, testLookup); err == nil {
+		t.Error("superamento del limite legacy non segnalato")
+	}
+	if err := CheckLength(legacy, legacy+";y", testLookup); err != nil {
+		t.Errorf("PATH gia' oltre il limite legacy rifiutato: %v", err)
+	}
+	if err := CheckLength(legacy, huge, testLookup); err == nil {
+		t.Error("superamento del limite di Windows non segnalato")
+	}
+	// la lunghezza si misura dopo l'espansione
+	expanded := strings.Repeat(`%LONG%;`, 25)
+	if len(expanded) > LegacyMaxLength {
+		t.Fatal("PATH di prova troppo lungo prima dell'espansione")
+	}
+	if err := CheckLength(short, expanded, testLookup); err == nil {
+		t.Error("lunghezza espansa non considerata")
+	}
+}
@@ -0,0 +1,79 @@
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// ToSlash converte i separatori Windows, anche su altre piattaforme: nei
+// pattern dei moduli '\' e' sempre un separatore, mai un escape.
+func ToSlash(pattern string) string {
+	return strings.ReplaceAll(pattern, `\`, "/")
+}
+
+// HasMeta indica se pattern contiene caratteri jolly.
+func HasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// Base restituisce la parte iniziale di pattern senza caratteri jolly, cioe'
+// la cartella da cui calcolare i percorsi relativi dei file trovati.
+// Es. config/**/*.json -> config.
+func Base(pattern string) string {
+	segments := strings.Split(ToSlash(pattern), "/")
+	for i, seg := range segments {
+		if HasMeta(seg) {
+			return path.Join(segments[:i]...)
+		}
+	}
+	return path.Dir(ToSlash(pattern))
+}
+
+// Match confronta name con pattern, entrambi con separatore '/'. Oltre alla
+// sintassi di path.Match, un segmento ** corrisponde a zero o piu' cartelle.
+// Il confronto non distingue maiuscole e minuscole, come il file system Windows.
+func Match(pattern, name string) (bool, error) {
+	pattern = ToSlash(pattern)
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return false, err
+	}
+	return matchSegments(strings.Split(strings.ToLower(pattern), "/"), strings.Split(strings.ToLower(name), "/"))
+}
+
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if ok, err := matchSegments(pattern[1:], name[i:]); ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if !ok || err != nil {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// Excluded indica se rel corrisponde a uno dei pattern, confrontati sia con il
+// percorso relativo che con il solo nome del file.
+func Excluded(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if ok, _ := Match(p, rel); ok {
+			return true
+		}
+		if !strings.Contains(ToSlash(p), "/") {
+			if ok, _ := Match(p, path.Base(rel)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
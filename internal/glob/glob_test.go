@@ -0,0 +1,119 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.json", "a.json", true},
+		{"*.json", "sub/a.json", false},
+		{"config/*.json", "config/a.json", true},
+		{"config/**/*.json", "config/a.json", true},
+		{"config/**/*.json", "config/x/y/a.json", true},
+		{"config/**/*.json", "other/x/a.json", false},
+		{"**/*.log", "a.log", true},
+		{"**/*.log", "x/y/a.log", true},
+		{"**", "x/y/z", true},
+		{"config/**", "config", true},
+		{"config/**", "config/a/b", true},
+		{"a/**/b/**/c", "a/b/c", true},
+		{"a/**/b/**/c", "a/x/b/y/z/c", true},
+		{"a/**/b/**/c", "a/x/c", false},
+		{"Config/*.JSON", "config/Settings.json", true},
+		{"bin/TOOL.exe", "BIN/tool.EXE", true},
+		{`config\**\*.json`, "config/x/a.json", true},
+		{`config\a.json`, "config/a.json", true},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file10.txt", false},
+		{"[ab].txt", "b.txt", true},
+		{"[ab].txt", "c.txt", false},
+	}
+	for _, tt := range tests {
+		got, err := Match(tt.pattern, tt.name)
+		if err != nil {
+			t.Errorf("Match(%q, %q): %v", tt.pattern, tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, atteso %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchInvalid(t *testing.T) {
+	for _, pattern := range []string{"[a", "config/[", `**/[z-a`} {
+		if _, err := Match(pattern, "x"); err == nil {
+			t.Errorf("Match(%q) senza errore", pattern)
+		}
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		include  string
+		exclude  []string
+		rel      string
+		selected bool
+	}{
+		{"**/*", nil, "a/b.txt", true},
+		// l'esclusione prevale sull'inclusione
+		{"**/*", []string{"*.tmp"}, "a/b.tmp", false},
+		{"**/*.tmp", []string{"*.tmp"}, "b.tmp", false},
+		// pattern senza separatore: confrontato anche con il solo nome
+		{"**/*", []string{"*.LOG"}, "logs/x/app.log", false},
+		{"**/*", []string{"cache"}, "a/cache", false},
+		// pattern con separatore: confrontato solo con il percorso relativo
+		{"**/*", []string{"logs/*.log"}, "logs/app.log", false},
+		{"**/*", []string{"logs/*.log"}, "old/logs/app.log", true},
+		{"**/*", []string{`logs\*.log`}, "logs/app.log", false},
+		{"**/*", []string{`logs\*.log`}, "app.log", true},
+		{"**/*", []string{"**/node_modules/**"}, "web/node_modules/x/index.js", false},
+		{"**/*", []string{"**/node_modules/**"}, "web/src/index.js", true},
+		// pattern non validi non escludono nulla
+		{"**/*", []string{"[", "*.bak"}, "a.txt", true},
+		{"**/*", []string{"[", "*.bak"}, "a.bak", false},
+	}
+	for _, tt := range tests {
+		included, err := Match(tt.include, tt.rel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := included && !Excluded(tt.exclude, tt.rel); got != tt.selected {
+			t.Errorf("%q con esclusioni %q su %q = %v, atteso %v", tt.include, tt.exclude, tt.rel, got, tt.selected)
+		}
+	}
+}
+
+func TestBase(t *testing.T) {
+	tests := map[string]string{
+		"config/**/*.json":  "config",
+		`config\sub\*.json`: "config/sub",
+		"*.json":            "",
+		"a/b/c.txt":         "a/b",
+		"c.txt":             ".",
+		"a/file?.txt":       "a",
+	}
+	for pattern, want := range tests {
+		if got := Base(pattern); got != want {
+			t.Errorf("Base(%q) = %q, atteso %q", pattern, got, want)
+		}
+	}
+}
+
+func TestHasMeta(t *testing.T) {
+	tests := map[string]bool{
+		"a/b.txt":   false,
+		`a\b.txt`:   false,
+		"*.txt":     true,
+		"file?.txt": true,
+		"[ab].txt":  true,
+		"a/**":      true,
+	}
+	for pattern, want := range tests {
+		if got := HasMeta(pattern); got != want {
+			t.Errorf("HasMeta(%q) = %v, atteso %v", pattern, got, want)
+		}
+	}
+}
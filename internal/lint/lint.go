@@ -0,0 +1,398 @@
+package lint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"WebGainInstaller/internal/glob"
+	"WebGainInstaller/internal/module"
+	"WebGainInstaller/internal/schema"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "errore"
+	SeverityWarning Severity = "avviso"
+)
+
+type Problem struct {
+	Severity Severity
+	Path     string
+	Message  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Path, p.Severity, p.Message)
+}
+
+// Options indica cosa analizzare. I percorsi sono su disco e usano
+// il separatore della piattaforma.
+type Options struct {
+	SetupFiles    []string
+	ModuleDir     string
+	RepoModuleDir string
+}
+
+// fileSteps sono i tipi di step il cui campo "file" e' relativo alla cartella del modulo.
+var fileSteps = map[string]bool{
+	"exe":               true,
+	"msi":               true,
+	"powershell_script": true,
+	"batch":             true,
+	"copy":              true,
+}
+
+// stepValidators controllano i campi specifici di ciascun tipo di step; gli
+// step *_config sono verificati a parte da ConfigEdit.
+var stepValidators = map[string]func(module.Step) error{
+	"service":        module.Step.ValidateService,
+	"shortcut":       module.Step.ValidateShortcut,
+	"scheduled_task": module.Step.ValidateTask,
+	"verify":         module.Step.ValidateVerify,
+	"shell_config":   module.Step.ValidateShell,
+	"registry":       module.Step.ValidateRegistry,
+	"copy":           module.Step.ValidateCopy,
+}
+
+type setupFile struct {
+	Modules []struct {
+		Name   string `json:"name"`
+		Active *bool  `json:"active,omitempty"`
+		Source string `json:"source,omitempty"`
+		Path   string `json:"path,omitempty"`
+	} `json:"modules"`
+}
+
+type linter struct {
+	opts       Options
+	problems   []Problem
+	referenced map[string]bool
+	commands   map[string]string
+	stepTypes  map[string]bool
+}
+
+// Run analizza setup.json, order.json e le cartelle modulo senza installare nulla.
+func Run(opts Options) []Problem {
+	l := &linter{
+		opts:       opts,
+		referenced: make(map[string]bool),
+		commands:   make(map[string]string),
+		stepTypes:  make(map[string]bool),
+	}
+	for _, t := range schema.StepTypes() {
+		l.stepTypes[t] = true
+	}
+
+	for _, setupPath := range opts.SetupFiles {
+		l.lintSetup(setupPath)
+	}
+
+	orderPath := filepath.Join(opts.ModuleDir, "order.json")
+	if _, err := os.Stat(orderPath); err == nil {
+		l.lintOrder(orderPath)
+	}
+
+	l.lintModuleDir(opts.ModuleDir, false)
+	if opts.RepoModuleDir != "" {
+		if _, err := os.Stat(opts.RepoModuleDir); err == nil {
+			l.lintModuleDir(opts.RepoModuleDir, true)
+		}
+	}
+
+	sort.SliceStable(l.problems, func(i, j int) bool { return l.problems[i].Path < l.problems[j].Path })
+	return l.problems
+}
+
+func HasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if p.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) errorf(path, format string, args ...interface{}) {
+	l.problems = append(l.problems, Problem{SeverityError, path, fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) warnf(path, format string, args ...interface{}) {
+	l.problems = append(l.problems, Problem{SeverityWarning, path, fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) lintSetup(setupPath string) {
+	data, err := os.ReadFile(setupPath)
+	if err != nil {
+		l.errorf(setupPath, "impossibile leggere: %v", err)
+		return
+	}
+	if l.schemaErrors(setupPath, schema.Setup, data) {
+		return
+	}
+
+	var cfg setupFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		l.errorf(setupPath, "JSON non valido: %v", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i, entry := range cfg.Modules {
+		name := strings.TrimSpace(entry.Name)
+		where := fmt.Sprintf("%s: modules[%d]", setupPath, i)
+		if seen[name] {
+			l.errorf(where, "modulo %q duplicato", name)
+			continue
+		}
+		seen[name] = true
+
+		if reason := invalidWindowsName(name); reason != "" {
+			l.errorf(where, "nome %q non valido su Windows: %s", name, reason)
+			continue
+		}
+
+		dir := filepath.Join(l.opts.ModuleDir, name)
+		if entry.Source == "repo" {
+			if entry.Path != "" {
+				l.referenced["repo:"+strings.TrimSuffix(path.Base(entry.Path), module.PackageExt)] = true
+				continue
+			}
+			dir = filepath.Join(l.opts.RepoModuleDir, name)
+			l.referenced["repo:"+name] = true
+		} else {
+			l.referenced[name] = true
+		}
+
+		if entry.Active != nil && !*entry.Active {
+			continue
+		}
+		if !moduleExists(dir) {
+			l.errorf(where, "modulo %q non presente in %s", name, filepath.Dir(dir))
+		}
+	}
+}
+
+func (l *linter) lintOrder(orderPath string) {
+	data, err := os.ReadFile(orderPath)
+	if err != nil {
+		l.errorf(orderPath, "impossibile leggere: %v", err)
+		return
+	}
+	if l.schemaErrors(orderPath, schema.Order, data) {
+		return
+	}
+
+	var order module.Order
+	if err := json.Unmarshal(data, &order); err != nil {
+		l.errorf(orderPath, "JSON non valido: %v", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i, folder := range order.Order {
+		where := fmt.Sprintf("%s: order[%d]", orderPath, i)
+		if seen[folder] {
+			l.errorf(where, "cartella %q duplicata", folder)
+			continue
+		}
+		seen[folder] = true
+		l.referenced[folder] = true
+
+		if !moduleExists(filepath.Join(l.opts.ModuleDir, folder)) {
+			l.errorf(where, "cartella modulo %q mancante", folder)
+		}
+	}
+}
+
+func (l *linter) lintModuleDir(dir string, repo bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		l.errorf(dir, "impossibile leggere cartella moduli: %v", err)
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		isPackage := !entry.IsDir() && strings.HasSuffix(name, module.PackageExt)
+		if !entry.IsDir() && !isPackage {
+			continue
+		}
+		key := strings.TrimSuffix(name, module.PackageExt)
+		if repo {
+			key = "repo:" + key
+		}
+		modulePath := filepath.Join(dir, name)
+		if !isPackage && fileExists(modulePath+module.PackageExt) {
+			// OpenModule usa il pacchetto: la cartella non viene installata.
+			l.warnf(modulePath, "ignorata: il pacchetto %s%s ha la precedenza", name, module.PackageExt)
+			continue
+		}
+		if !l.referenced[key] {
+			l.warnf(modulePath, "modulo non raggiungibile: non referenziato da setup.json ne' da order.json")
+		}
+
+		if !isPackage {
+			l.lintModule(modulePath, os.DirFS(modulePath))
+			continue
+		}
+		data, err := os.ReadFile(modulePath)
+		if err != nil {
+			l.errorf(modulePath, "impossibile leggere pacchetto: %v", err)
+			continue
+		}
+		pkg, _, err := module.OpenPackage(data)
+		if err != nil {
+			l.errorf(modulePath, "%v", err)
+			continue
+		}
+		l.lintModule(modulePath, pkg)
+	}
+}
+
+func (l *linter) lintModule(modulePath string, moduleFS fs.FS) {
+	fs.WalkDir(moduleFS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == "." {
+			return err
+		}
+		if reason := invalidWindowsPath(p); reason != "" {
+			l.errorf(filepath.Join(modulePath, filepath.FromSlash(p)), "percorso non valido su Windows: %s", reason)
+		}
+		return nil
+	})
+
+	if manifest, err := module.LoadManifest(moduleFS, "."); err == nil {
+		for _, failure := range manifest.VerifyFS(moduleFS) {
+			l.errorf(filepath.Join(modulePath, module.ManifestFileName), "%v", failure)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		l.errorf(modulePath, "%v", err)
+	}
+
+	cmdPath := filepath.Join(modulePath, "command.json")
+	data, err := fs.ReadFile(moduleFS, "command.json")
+	if err != nil {
+		l.errorf(modulePath, "command.json mancante")
+		return
+	}
+	if l.schemaErrors(cmdPath, schema.Command, data) {
+		return
+	}
+
+	var cmd module.Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		l.errorf(cmdPath, "JSON non valido: %v", err)
+		return
+	}
+
+	if other, ok := l.commands[cmd.Name]; ok {
+		l.errorf(cmdPath, "nome %q gia' usato da %s", cmd.Name, other)
+	} else {
+		l.commands[cmd.Name] = cmdPath
+	}
+	if err := cmd.ValidateUninstall(); err != nil {
+		l.errorf(cmdPath, "%v", err)
+	}
+	if cmd.Weight == 0 {
+		l.warnf(cmdPath, "weight pari a 0, il modulo non contribuisce all'avanzamento")
+	}
+
+	for i, step := range cmd.Steps {
+		where := fmt.Sprintf("%s: steps[%d]", cmdPath, i)
+		if !l.stepTypes[step.Type] {
+			l.errorf(where, "tipo di step sconosciuto %q", step.Type)
+			continue
+		}
+		if err := step.ValidateCapture(); err != nil {
+			l.errorf(where, "%v", err)
+		}
+		if _, ok := module.ConfigSteps[step.Type]; ok {
+			if _, _, err := step.ConfigEdit(); err != nil {
+				l.errorf(where, "%v", err)
+			}
+			continue
+		}
+		if validate, ok := stepValidators[step.Type]; ok {
+			if err := validate(step); err != nil {
+				l.errorf(where, "%v", err)
+				continue
+			}
+		}
+		if !fileSteps[step.Type] && !(step.Type == "registry" && step.File != "") {
+			continue
+		}
+		if step.File == "" {
+			l.errorf(where, "campo 'file' obbligatorio per step %s", step.Type)
+			continue
+		}
+		rel := glob.ToSlash(step.File)
+		if glob.HasMeta(rel) {
+			if reason := invalidWindowsPattern(rel); reason != "" {
+				l.errorf(where, "pattern %q non valido su Windows: %s", step.File, reason)
+				continue
+			}
+			if !globMatches(moduleFS, path.Clean(rel)) {
+				l.errorf(where, "nessun file del modulo corrisponde a %q", step.File)
+			}
+			continue
+		}
+		if reason := invalidWindowsPath(rel); reason != "" {
+			l.errorf(where, "file %q non valido su Windows: %s", step.File, reason)
+			continue
+		}
+		if _, err := fs.Stat(moduleFS, path.Clean(rel)); err != nil {
+			l.errorf(where, "file %q non presente nella cartella del modulo", step.File)
+		}
+	}
+}
+
+// globMatches indica se almeno un file del modulo corrisponde a pattern.
+func globMatches(moduleFS fs.FS, pattern string) bool {
+	found := false
+	fs.WalkDir(moduleFS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if ok, _ := glob.Match(pattern, p); ok {
+			found = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found
+}
+
+// moduleExists accetta sia la cartella del modulo che il pacchetto .wgm omonimo.
+func moduleExists(dir string) bool {
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return true
+	}
+	return fileExists(dir + module.PackageExt)
+}
+
+func fileExists(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && !info.IsDir()
+}
+
+func (l *linter) schemaErrors(filePath, schemaName string, data []byte) bool {
+	err := schema.Validate(schemaName, data)
+	if err == nil {
+		return false
+	}
+	if errs, ok := err.(schema.Errors); ok {
+		for _, e := range errs {
+			l.errorf(filePath, "%v", e)
+		}
+		return true
+	}
+	l.errorf(filePath, "%v", err)
+	return true
+}
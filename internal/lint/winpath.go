@@ -0,0 +1,95 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"WebGainInstaller/internal/glob"
+)
+
+// maxRelativePath lascia margine a %TEMP%\WebGainInstaller\<modulo>
+// rispetto al limite MAX_PATH di 260 caratteri.
+const maxRelativePath = 200
+
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// invalidWindowsName restituisce il motivo per cui name non e' un nome
+// di file o cartella valido su Windows, o stringa vuota se valido.
+func invalidWindowsName(name string) string {
+	if name == "" {
+		return "nome vuoto"
+	}
+	if name == "." || name == ".." {
+		return "componente relativo non ammesso"
+	}
+	for _, r := range name {
+		if r < 32 {
+			return "carattere di controllo"
+		}
+		if strings.ContainsRune(`<>:"/\|?*`, r) {
+			return fmt.Sprintf("carattere %q non ammesso", r)
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return "termina con punto o spazio"
+	}
+	base := strings.ToUpper(name)
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if reservedNames[strings.TrimSpace(base)] {
+		return fmt.Sprintf("nome riservato %s", base)
+	}
+	return ""
+}
+
+// invalidWindowsPath verifica un percorso relativo separato da "/".
+func invalidWindowsPath(p string) string {
+	if strings.HasPrefix(p, "/") || (len(p) >= 2 && p[1] == ':') {
+		return "percorso assoluto"
+	}
+	if len(p) > maxRelativePath {
+		return fmt.Sprintf("lunghezza %d oltre %d caratteri", len(p), maxRelativePath)
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if reason := invalidWindowsName(segment); reason != "" {
+			return fmt.Sprintf("%q: %s", segment, reason)
+		}
+	}
+	return ""
+}
+
+// invalidWindowsPattern verifica un pattern relativo separato da "/": i
+// segmenti senza caratteri jolly seguono le regole dei nomi, gli altri solo
+// quelle che non riguardano i caratteri jolly stessi.
+func invalidWindowsPattern(p string) string {
+	if strings.HasPrefix(p, "/") || (len(p) >= 2 && p[1] == ':') {
+		return "percorso assoluto"
+	}
+	if _, err := glob.Match(p, ""); err != nil {
+		return fmt.Sprintf("pattern non valido: %v", err)
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if !glob.HasMeta(segment) {
+			if reason := invalidWindowsName(segment); reason != "" {
+				return fmt.Sprintf("%q: %s", segment, reason)
+			}
+			continue
+		}
+		for _, r := range segment {
+			if r < 32 {
+				return fmt.Sprintf("%q: carattere di controllo", segment)
+			}
+			if strings.ContainsRune(`<>:"|`, r) {
+				return fmt.Sprintf("%q: carattere %q non ammesso", segment, r)
+			}
+		}
+	}
+	return ""
+}
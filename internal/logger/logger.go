@@ -1,9 +1,12 @@
 package logger
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -11,27 +14,155 @@ import (
 type Level string
 
 const (
+	DEBUG   Level = "DEBUG"
 	INFO    Level = "INFO"
 	WARNING Level = "WARNING"
 	ERROR   Level = "ERROR"
 )
 
+// Options configura il logger. Il log testuale e' sempre attivo; con JSON viene
+// scritto anche un file .jsonl, un record JSON per riga. I file vengono creati
+// in Dir con nome webgain_<timestamp>_<runID>, ruotati oltre MaxSize byte, e
+// solo le ultime Keep esecuzioni vengono conservate.
+type Options struct {
+	MinLevel Level
+	JSON     bool
+	Dir      string
+	MaxSize  int64
+	Keep     int
+}
+
+const (
+	filePrefix     = "webgain_"
+	defaultMaxSize = 10 << 20
+	defaultKeep    = 10
+	maxPending     = 1000
+)
+
+type pendingLine struct {
+	ts    time.Time
+	level Level
+	msg   string
+	attrs []slog.Attr
+}
+
 var (
-	file *os.File
-	mu   sync.Mutex
+	file     *rotatingFile
+	jsonFile *rotatingFile
+	jsonLog  *slog.Logger
+	runID    string
+	minLevel = INFO
+	pending  []pendingLine
+	mu       sync.Mutex
 )
 
-func Init(rootPath string) error {
+// ParseLevel converte un nome di livello (case-insensitive, "warn" ammesso).
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "DEBUG":
+		return DEBUG, nil
+	case "INFO", "":
+		return INFO, nil
+	case "WARN", "WARNING":
+		return WARNING, nil
+	case "ERROR":
+		return ERROR, nil
+	}
+	return INFO, fmt.Errorf("livello di log sconosciuto: %s", name)
+}
+
+func (l Level) rank() int {
+	switch l {
+	case DEBUG:
+		return 0
+	case WARNING:
+		return 2
+	case ERROR:
+		return 3
+	}
+	return 1
+}
+
+func (l Level) slogLevel() slog.Level {
+	switch l {
+	case DEBUG:
+		return slog.LevelDebug
+	case WARNING:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// Init apre il log dell'esecuzione. Il nome di rootPath (GUID di WEBGAINROOT)
+// e' usato come run ID; con rootPath vuoto, ad esempio se WEBGAINROOT non e'
+// stata creata, il run ID deriva dall'ora di avvio. Se opts.Dir e' vuoto i log
+// vengono scritti in rootPath. Le righe registrate prima di Init vengono
+// scritte in testa al file.
+func Init(rootPath string, opts Options) error {
 	mu.Lock()
 	defer mu.Unlock()
+
+	now := time.Now().UTC()
+	runID = filepath.Base(rootPath)
+	if rootPath == "" {
+		runID = fmt.Sprintf("%x", now.UnixNano())
+	}
+	if opts.MinLevel != "" {
+		minLevel = opts.MinLevel
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = defaultMaxSize
+	}
+	if opts.Keep == 0 {
+		opts.Keep = defaultKeep
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = rootPath
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("impossibile creare cartella log %s: %w", dir, err)
+	}
+
+	base := filePrefix + now.Format("20060102-150405") + "_" + runID
 	var err error
-	file, err = os.Create(filepath.Join(rootPath, "log.txt"))
+	file, err = openRotating(dir, base, ".log", opts.MaxSize)
 	if err != nil {
-		return fmt.Errorf("impossibile creare log.txt: %w", err)
+		return fmt.Errorf("impossibile creare log: %w", err)
 	}
+
+	if opts.JSON {
+		jsonFile, err = openRotating(dir, base, ".jsonl", opts.MaxSize)
+		if err != nil {
+			return fmt.Errorf("impossibile creare log JSON: %w", err)
+		}
+		handler := slog.NewJSONHandler(jsonFile, &slog.HandlerOptions{Level: slog.LevelDebug})
+		jsonLog = slog.New(handler).With(slog.String("run_id", runID))
+	}
+
+	for _, line := range pending {
+		emit(line)
+	}
+	pending = nil
+
+	pruneRuns(dir, opts.Keep)
 	return nil
 }
 
+// Path restituisce il file di log testuale corrente, o stringa vuota
+// se il logger non e' inizializzato.
+func Path() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if file == nil {
+		return ""
+	}
+	return file.Name()
+}
+
 func Close() {
 	mu.Lock()
 	defer mu.Unlock()
@@ -39,27 +170,103 @@ func Close() {
 		file.Close()
 		file = nil
 	}
+	if jsonFile != nil {
+		jsonFile.Close()
+		jsonFile = nil
+		jsonLog = nil
+	}
+	for _, line := range pending {
+		fmt.Fprintf(os.Stderr, "%s\n", formatLine(line))
+	}
+	pending = nil
 }
 
-func write(level Level, format string, args ...interface{}) {
+// RunID restituisce l'identificativo dell'esecuzione corrente.
+func RunID() string {
 	mu.Lock()
 	defer mu.Unlock()
+	return runID
+}
+
+func write(level Level, msg string, attrs []slog.Attr) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level.rank() < minLevel.rank() {
+		return
+	}
+	line := pendingLine{ts: time.Now().UTC(), level: level, msg: Redact(msg), attrs: redactAttrs(attrs)}
 	if file == nil {
+		if len(pending) < maxPending {
+			pending = append(pending, line)
+		}
 		return
 	}
-	ts := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
-	msg := fmt.Sprintf(format, args...)
-	fmt.Fprintf(file, "[%s](%s) %s\n", ts, level, msg)
+	emit(line)
+}
+
+func emit(line pendingLine) {
+	fmt.Fprintf(file, "%s\n", formatLine(line))
+	if jsonLog != nil {
+		record := slog.NewRecord(line.ts, line.level.slogLevel(), line.msg, 0)
+		record.AddAttrs(line.attrs...)
+		jsonLog.Handler().Handle(context.Background(), record)
+	}
+}
+
+func formatLine(line pendingLine) string {
+	ts := line.ts.Format("2006-01-02T15:04:05.000Z")
+	return fmt.Sprintf("[%s](%s) %s%s", ts, line.level, line.msg, formatAttrs(line.attrs))
+}
+
+func formatAttrs(attrs []slog.Attr) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, a := range attrs {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+	}
+	return b.String()
+}
+
+func Debug(format string, args ...interface{}) {
+	write(DEBUG, fmt.Sprintf(format, args...), nil)
 }
 
 func Info(format string, args ...interface{}) {
-	write(INFO, format, args...)
+	write(INFO, fmt.Sprintf(format, args...), nil)
 }
 
 func Warn(format string, args ...interface{}) {
-	write(WARNING, format, args...)
+	write(WARNING, fmt.Sprintf(format, args...), nil)
 }
 
 func Error(format string, args ...interface{}) {
-	write(ERROR, format, args...)
+	write(ERROR, fmt.Sprintf(format, args...), nil)
+}
+
+// Event registra un messaggio con campi strutturati, accodati come chiave=valore
+// in log.txt e come campi JSON in log.jsonl.
+func Event(level Level, msg string, attrs ...slog.Attr) {
+	write(level, msg, attrs)
+}
+
+func Module(name string) slog.Attr {
+	return slog.String("module", name)
+}
+
+func Step(index int) slog.Attr {
+	return slog.Int("step", index)
+}
+
+func StepType(stepType string) slog.Attr {
+	return slog.String("step_type", stepType)
+}
+
+func Duration(d time.Duration) slog.Attr {
+	return slog.Int64("duration_ms", d.Milliseconds())
+}
+
+func ExitCode(code int) slog.Attr {
+	return slog.Int("exit_code", code)
 }
@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// rotatingFile scrive su base+ext e, superata maxSize, prosegue su
+// base.1+ext, base.2+ext e cosi' via.
+type rotatingFile struct {
+	dir     string
+	base    string
+	ext     string
+	maxSize int64
+	part    int
+	size    int64
+	f       *os.File
+}
+
+func openRotating(dir, base, ext string, maxSize int64) (*rotatingFile, error) {
+	r := &rotatingFile{dir: dir, base: base, ext: ext, maxSize: maxSize}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	name := r.base + r.ext
+	if r.part > 0 {
+		name = fmt.Sprintf("%s.%d%s", r.base, r.part, r.ext)
+	}
+	f, err := os.Create(filepath.Join(r.dir, name))
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.size = 0
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		r.f.Close()
+		r.part++
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Name() string {
+	return r.f.Name()
+}
+
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
+
+// pruneRuns mantiene in dir solo i file delle ultime keep esecuzioni.
+// I file di una stessa esecuzione condividono il prefisso fino al primo punto
+// e il prefisso inizia con il timestamp, quindi l'ordine alfabetico e' cronologico.
+func pruneRuns(dir string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	groups := make(map[string][]string)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, filePrefix) {
+			continue
+		}
+		run, _, _ := strings.Cut(name, ".")
+		groups[run] = append(groups[run], name)
+	}
+	if len(groups) <= keep {
+		return
+	}
+
+	runs := make([]string, 0, len(groups))
+	for run := range groups {
+		runs = append(runs, run)
+	}
+	sort.Strings(runs)
+	for _, run := range runs[:len(runs)-keep] {
+		for _, name := range groups[run] {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// captureName e' il formato ammesso per i nomi di variabile di capture,
+// che diventano variabili d'ambiente per gli step successivi.
+var captureName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedCaptureNames sono le variabili di sistema (o dell'installer) che
+// capture non puo' sovrascrivere: sono usate da tutti i processi avviati dagli
+// step successivi. Il confronto ignora maiuscole e minuscole, come Windows.
+var reservedCaptureNames = map[string]bool{
+	"ALLUSERSPROFILE": true, "APPDATA": true, "COMMONPROGRAMFILES": true,
+	"COMPUTERNAME": true, "COMSPEC": true, "HOMEDRIVE": true, "HOMEPATH": true,
+	"LOCALAPPDATA": true, "NUMBER_OF_PROCESSORS": true, "OS": true, "PATH": true,
+	"PATHEXT": true, "PROCESSOR_ARCHITECTURE": true, "PROGRAMDATA": true,
+	"PROGRAMFILES": true, "PROGRAMW6432": true, "PSMODULEPATH": true,
+	"PUBLIC": true, "SYSTEMDRIVE": true, "SYSTEMROOT": true, "TEMP": true,
+	"TMP": true, "USERDOMAIN": true, "USERNAME": true, "USERPROFILE": true,
+	"WINDIR": true, "WEBGAINROOT": true,
+}
+
+// IsReservedCaptureName indica se name e' una variabile riservata.
+func IsReservedCaptureName(name string) bool {
+	upper := strings.ToUpper(name)
+	return reservedCaptureNames[upper] || strings.HasPrefix(upper, "WEBGAIN_")
+}
+
+// CaptureSteps sono i tipi di step che producono un output catturabile.
+var CaptureSteps = map[string]bool{
+	"exe":               true,
+	"msi":               true,
+	"powershell":        true,
+	"powershell_script": true,
+	"powershell_module": true,
+	"batch":             true,
+	"service":           true,
+	"verify":            true,
+}
+
+// ValidateCapture controlla nome, regex e JSON path di capture senza eseguire lo step.
+func (s Step) ValidateCapture() error {
+	if s.Capture == "" {
+		if s.CaptureRegex != "" || s.CaptureJSONPath != "" {
+			return fmt.Errorf("captureRegex e captureJsonPath richiedono capture")
+		}
+		return nil
+	}
+	if !CaptureSteps[s.Type] {
+		return fmt.Errorf("capture non supportato per step %s", s.Type)
+	}
+	if !captureName.MatchString(s.Capture) {
+		return fmt.Errorf("nome variabile capture non valido: %q", s.Capture)
+	}
+	if IsReservedCaptureName(s.Capture) {
+		return fmt.Errorf("capture non puo' usare la variabile di sistema %s", s.Capture)
+	}
+	if s.CaptureRegex != "" && s.CaptureJSONPath != "" {
+		return fmt.Errorf("captureRegex e captureJsonPath sono alternativi")
+	}
+	if s.CaptureRegex != "" {
+		if _, err := regexp.Compile(s.CaptureRegex); err != nil {
+			return fmt.Errorf("captureRegex non valida: %w", err)
+		}
+	}
+	if s.CaptureJSONPath != "" {
+		if _, err := parseJSONPath(s.CaptureJSONPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CaptureValue estrae dall'output dello step il valore da assegnare a Capture:
+// il primo gruppo (o l'intera corrispondenza) di CaptureRegex, il valore in
+// CaptureJSONPath, oppure l'output senza spazi iniziali e finali.
+func (s Step) CaptureValue(output string) (string, error) {
+	if err := s.ValidateCapture(); err != nil {
+		return "", err
+	}
+	switch {
+	case s.CaptureRegex != "":
+		match := regexp.MustCompile(s.CaptureRegex).FindStringSubmatch(output)
+		if match == nil {
+			return "", fmt.Errorf("capture %s: nessuna corrispondenza per %q", s.Capture, s.CaptureRegex)
+		}
+		if len(match) > 1 {
+			return strings.TrimSpace(match[1]), nil
+		}
+		return strings.TrimSpace(match[0]), nil
+
+	case s.CaptureJSONPath != "":
+		dec := json.NewDecoder(strings.NewReader(strings.TrimSpace(output)))
+		dec.UseNumber()
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return "", fmt.Errorf("capture %s: output non JSON: %w", s.Capture, err)
+		}
+		value, err := lookupJSONPath(doc, s.CaptureJSONPath)
+		if err != nil {
+			return "", fmt.Errorf("capture %s: %w", s.Capture, err)
+		}
+		return value, nil
+	}
+	return strings.TrimSpace(output), nil
+}
+
+type pathSegment struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// parseJSONPath accetta percorsi semplici come $.node.version, items[0].name
+// o $["chiave con spazi"].
+func parseJSONPath(p string) ([]pathSegment, error) {
+	invalid := func() ([]pathSegment, error) {
+		return nil, fmt.Errorf("captureJsonPath non valido: %q", p)
+	}
+	rest := strings.TrimPrefix(strings.TrimSpace(p), "$")
+	var segments []pathSegment
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return invalid()
+			}
+			segments = append(segments, pathSegment{key: rest[:end], isKey: true})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return invalid()
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if unquoted, err := strconv.Unquote(inner); err == nil {
+				segments = append(segments, pathSegment{key: unquoted, isKey: true})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return invalid()
+			}
+			segments = append(segments, pathSegment{index: index})
+		default:
+			if len(segments) > 0 {
+				return invalid()
+			}
+			rest = "." + rest
+		}
+	}
+	if len(segments) == 0 {
+		return invalid()
+	}
+	return segments, nil
+}
+
+func lookupJSONPath(doc interface{}, p string) (string, error) {
+	segments, err := parseJSONPath(p)
+	if err != nil {
+		return "", err
+	}
+	current := doc
+	for _, seg := range segments {
+		if seg.isKey {
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("%s: %q non e' un oggetto", p, seg.key)
+			}
+			if current, ok = obj[seg.key]; !ok {
+				return "", fmt.Errorf("%s: chiave %q assente", p, seg.key)
+			}
+			continue
+		}
+		arr, ok := current.([]interface{})
+		if !ok || seg.index >= len(arr) {
+			return "", fmt.Errorf("%s: indice %d non presente", p, seg.index)
+		}
+		current = arr[seg.index]
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data), nil
+	}
+	return fmt.Sprint(current), nil
+}
@@ -0,0 +1,42 @@
+package module
+
+import (
+	"fmt"
+
+	"WebGainInstaller/internal/configedit"
+)
+
+// ConfigSteps associa i tipi di step che modificano un file di configurazione
+// al formato del file.
+var ConfigSteps = map[string]string{
+	"json_config": configedit.JSON,
+	"ini_config":  configedit.INI,
+	"xml_config":  configedit.XML,
+	"yaml_config": configedit.YAML,
+}
+
+// ConfigEdit restituisce formato e modifica di uno step *_config, gia' validati:
+// target e' il file da modificare, path il percorso (JSON/YAML o XPath),
+// section e key la chiave INI, value il valore come stringa e content un
+// valore letterale JSON o YAML.
+func (s Step) ConfigEdit() (string, configedit.Edit, error) {
+	format, ok := ConfigSteps[s.Type]
+	if !ok {
+		return "", configedit.Edit{}, fmt.Errorf("step %s non modifica file di configurazione", s.Type)
+	}
+	if s.Target == "" {
+		return "", configedit.Edit{}, fmt.Errorf("campo 'target' obbligatorio per step %s", s.Type)
+	}
+	edit := configedit.Edit{
+		Action:  s.Action,
+		Path:    s.Path,
+		Section: s.Section,
+		Key:     s.Key,
+		Value:   s.Value,
+		Raw:     s.Content,
+	}
+	if err := configedit.Validate(format, edit); err != nil {
+		return "", configedit.Edit{}, err
+	}
+	return format, edit, nil
+}
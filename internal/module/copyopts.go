@@ -0,0 +1,34 @@
+package module
+
+import (
+	"fmt"
+
+	"WebGainInstaller/internal/glob"
+)
+
+// Modalita' di sovrascrittura dello step copy (always se vuota).
+const (
+	OverwriteAlways      = "always"
+	OverwriteNever       = "never"
+	OverwriteIfNewer     = "if-newer"
+	OverwriteIfDifferent = "if-different"
+)
+
+// ValidateCopy controlla sorgente, destinazione, esclusioni e modalita' di
+// sovrascrittura di uno step copy.
+func (s Step) ValidateCopy() error {
+	if s.File == "" || s.Dest == "" {
+		return fmt.Errorf("campi 'file' e 'dest' obbligatori per step copy")
+	}
+	switch s.Overwrite {
+	case "", OverwriteAlways, OverwriteNever, OverwriteIfNewer, OverwriteIfDifferent:
+	default:
+		return fmt.Errorf("overwrite sconosciuto: %s (ammessi: always, never, if-newer, if-different)", s.Overwrite)
+	}
+	for _, pattern := range append([]string{s.File}, s.Exclude...) {
+		if _, err := glob.Match(pattern, ""); err != nil {
+			return fmt.Errorf("pattern non valido %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
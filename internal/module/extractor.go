@@ -5,6 +5,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 const tempBase = "WebGainInstaller"
@@ -15,26 +16,47 @@ func ExtractModule(moduleFS fs.FS, folderName string) (string, error) {
 		return "", fmt.Errorf("impossibile creare cartella temp %s: %w", tempDir, err)
 	}
 
-	err := fs.WalkDir(moduleFS, folderName, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+	src, err := OpenModule(moduleFS, folderName)
+	if err != nil {
+		return "", fmt.Errorf("impossibile aprire modulo %s: %w", folderName, err)
+	}
+
+	// Le date originali vengono dal manifest: i file incorporati hanno data
+	// zero e le voci dei pacchetti quella registrata dal manifest stesso.
+	modified := make(map[string]time.Time)
+	if manifest, err := LoadManifest(src, "."); err == nil {
+		for _, f := range manifest.Files {
+			modified[f.Path] = f.Modified
 		}
+	}
 
-		relPath, err := filepath.Rel(folderName, path)
+	err = fs.WalkDir(src, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		destPath := filepath.Join(tempDir, relPath)
+
+		destPath := filepath.Join(tempDir, filepath.FromSlash(path))
 
 		if d.IsDir() {
 			return os.MkdirAll(destPath, 0755)
 		}
 
-		data, err := fs.ReadFile(moduleFS, path)
+		data, err := fs.ReadFile(src, path)
 		if err != nil {
 			return fmt.Errorf("impossibile leggere %s: %w", path, err)
 		}
-		return os.WriteFile(destPath, data, 0644)
+		if err := os.WriteFile(destPath, data, 0644); err != nil {
+			return err
+		}
+		// Mantiene le date originali, usate dallo step copy con overwrite if-newer.
+		mtime := modified[path]
+		if info, err := d.Info(); mtime.IsZero() && err == nil {
+			mtime = info.ModTime()
+		}
+		if !mtime.IsZero() {
+			os.Chtimes(destPath, mtime, mtime)
+		}
+		return nil
 	})
 
 	if err != nil {
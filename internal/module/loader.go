@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/fs"
+
+	"WebGainInstaller/internal/schema"
 )
 
 func LoadOrder(moduleFS fs.FS) (*Order, error) {
@@ -11,6 +13,9 @@ func LoadOrder(moduleFS fs.FS) (*Order, error) {
 	if err != nil {
 		return nil, fmt.Errorf("impossibile leggere order.json: %w", err)
 	}
+	if err := schema.Validate(schema.Order, data); err != nil {
+		return nil, fmt.Errorf("order.json non valido: %w", err)
+	}
 	var order Order
 	if err := json.Unmarshal(data, &order); err != nil {
 		return nil, fmt.Errorf("impossibile parsare order.json: %w", err)
@@ -23,10 +28,17 @@ func LoadModules(moduleFS fs.FS, order *Order) ([]*Module, error) {
 
 	for _, folder := range order.Order {
 		cmdPath := folder + "/command.json"
-		data, err := fs.ReadFile(moduleFS, cmdPath)
+		src, err := OpenModule(moduleFS, folder)
+		if err != nil {
+			return nil, fmt.Errorf("impossibile aprire modulo %s: %w", folder, err)
+		}
+		data, err := fs.ReadFile(src, "command.json")
 		if err != nil {
 			return nil, fmt.Errorf("impossibile leggere %s: %w", cmdPath, err)
 		}
+		if err := schema.Validate(schema.Command, data); err != nil {
+			return nil, fmt.Errorf("%s non valido: %w", cmdPath, err)
+		}
 
 		var cmd Command
 		if err := json.Unmarshal(data, &cmd); err != nil {
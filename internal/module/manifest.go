@@ -0,0 +1,157 @@
+package module
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const ManifestFileName = "manifest.json"
+
+// ManifestFile descrive un file del modulo. Modified e' la data di modifica
+// originale, conservata perche' i file incorporati e le voci dei pacchetti
+// non ne hanno una propria.
+type ManifestFile struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
+	Modified time.Time `json:"modified,omitempty"`
+}
+
+// Manifest elenca i file di un modulo con dimensione e hash SHA-256.
+type Manifest struct {
+	Name    string         `json:"name"`
+	Version string         `json:"version"`
+	Files   []ManifestFile `json:"files"`
+}
+
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("manifest non valido: %w", err)
+	}
+	if strings.TrimSpace(m.Name) == "" {
+		return nil, fmt.Errorf("manifest: 'name' mancante")
+	}
+
+	seen := make(map[string]bool)
+	for i, f := range m.Files {
+		if !fs.ValidPath(f.Path) || f.Path == "." || strings.Contains(f.Path, `\`) {
+			return nil, fmt.Errorf("manifest: files[%d].path non valido: %q", i, f.Path)
+		}
+		if seen[f.Path] {
+			return nil, fmt.Errorf("manifest: files[%d].path duplicato: %q", i, f.Path)
+		}
+		seen[f.Path] = true
+		if _, err := hex.DecodeString(f.SHA256); err != nil || len(f.SHA256) != sha256.Size*2 {
+			return nil, fmt.Errorf("manifest: files[%d].sha256 non valido: %q", i, f.SHA256)
+		}
+	}
+	return &m, nil
+}
+
+// ErrIntegrity segnala un file del modulo assente o diverso dal manifest.
+var ErrIntegrity = errors.New("integrita' modulo compromessa")
+
+func LoadManifest(moduleFS fs.FS, folder string) (*Manifest, error) {
+	manifestPath := path.Join(folder, ManifestFileName)
+	data, err := fs.ReadFile(moduleFS, manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("impossibile leggere %s: %w", manifestPath, err)
+	}
+	m, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestPath, err)
+	}
+	return m, nil
+}
+
+// BuildManifest calcola il manifest dei file presenti in src, escludendo
+// manifest.json stesso ed eventuali pacchetti .wgm.
+func BuildManifest(src fs.FS, name, version string) (*Manifest, error) {
+	manifest := &Manifest{Name: name, Version: version}
+	err := fs.WalkDir(src, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path == ManifestFileName || strings.HasSuffix(path, PackageExt) {
+			return nil
+		}
+		data, err := fs.ReadFile(src, path)
+		if err != nil {
+			return fmt.Errorf("impossibile leggere %s: %w", path, err)
+		}
+		file := ManifestFile{
+			Path:   path,
+			Size:   int64(len(data)),
+			SHA256: HashBytes(data),
+		}
+		if info, err := d.Info(); err == nil && !info.ModTime().IsZero() {
+			file.Modified = info.ModTime().UTC().Truncate(time.Second)
+		}
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParseManifest(data); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// VerifyFS confronta i file di fsys con il manifest e restituisce, per percorso,
+// gli errori dei file mancanti o alterati. Una mappa vuota indica integrita' completa.
+func (m *Manifest) VerifyFS(fsys fs.FS) map[string]error {
+	failures := make(map[string]error)
+	for _, f := range m.Files {
+		data, err := fs.ReadFile(fsys, f.Path)
+		if err != nil {
+			failures[f.Path] = fmt.Errorf("%s: file mancante: %w", f.Path, err)
+			continue
+		}
+		if err := f.Verify(data); err != nil {
+			failures[f.Path] = err
+		}
+	}
+	return failures
+}
+
+func (m *Manifest) Has(path string) bool {
+	for _, f := range m.Files {
+		if f.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify controlla dimensione e hash di data rispetto alla voce del manifest.
+func (f ManifestFile) Verify(data []byte) error {
+	if int64(len(data)) != f.Size {
+		return fmt.Errorf("%s: dimensione %d, attesa %d", f.Path, len(data), f.Size)
+	}
+	if sum := HashBytes(data); !strings.EqualFold(sum, f.SHA256) {
+		return fmt.Errorf("%s: SHA-256 %s, atteso %s", f.Path, sum, f.SHA256)
+	}
+	return nil
+}
+
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
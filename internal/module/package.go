@@ -0,0 +1,128 @@
+package module
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// PackageExt e' l'estensione dei pacchetti modulo: zip con manifest.json
+// alla radice e i file del modulo elencati con il loro SHA-256.
+const PackageExt = ".wgm"
+
+// OpenModule restituisce il contenuto del modulo folder: il pacchetto
+// folder.wgm se presente in moduleFS, altrimenti la cartella omonima.
+func OpenModule(moduleFS fs.FS, folder string) (fs.FS, error) {
+	pkgPath := folder + PackageExt
+	data, err := fs.ReadFile(moduleFS, pkgPath)
+	if err == nil {
+		pkg, _, err := OpenPackage(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pkgPath, err)
+		}
+		return pkg, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("impossibile leggere %s: %w", pkgPath, err)
+	}
+	return fs.Sub(moduleFS, folder)
+}
+
+// OpenPackage apre un pacchetto in memoria verificando che contenga
+// esattamente i file del manifest, con dimensione e SHA-256 corretti.
+func OpenPackage(data []byte) (fs.FS, *Manifest, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("pacchetto non valido: %w", err)
+	}
+
+	manifestData, err := fs.ReadFile(zr, ManifestFileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pacchetto senza %s: %w", ManifestFileName, err)
+	}
+	manifest, err := ParseManifest(manifestData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listed := make(map[string]bool, len(manifest.Files))
+	for _, f := range manifest.Files {
+		listed[f.Path] = true
+		content, err := fs.ReadFile(zr, f.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("file %s mancante nel pacchetto", f.Path)
+		}
+		if err := f.Verify(content); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() || zf.Name == ManifestFileName {
+			continue
+		}
+		if !listed[zf.Name] {
+			return nil, nil, fmt.Errorf("file %s non elencato nel manifest", zf.Name)
+		}
+	}
+
+	return zr, manifest, nil
+}
+
+// Pack crea in w il pacchetto del modulo contenuto in src. Il manifest viene
+// rigenerato; eventuali manifest.json e pacchetti presenti in src sono esclusi.
+func Pack(src fs.FS, name, version string, w io.Writer) (*Manifest, error) {
+	manifest, err := BuildManifest(src, name, version)
+	if err != nil {
+		return nil, err
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	zw := zip.NewWriter(w)
+	if err := writeZipEntry(zw, ManifestFileName, manifestData, packageTime); err != nil {
+		return nil, err
+	}
+	for _, f := range manifest.Files {
+		data, err := fs.ReadFile(src, f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("impossibile leggere %s: %w", f.Path, err)
+		}
+		if err := f.Verify(data); err != nil {
+			return nil, fmt.Errorf("file modificato durante la creazione del pacchetto: %w", err)
+		}
+		modified := f.Modified
+		if modified.IsZero() {
+			modified = packageTime
+		}
+		if err := writeZipEntry(zw, f.Path, data, modified); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("impossibile chiudere pacchetto: %w", err)
+	}
+	return manifest, nil
+}
+
+// packageTime e' la data delle voci zip senza data nel manifest. Le date
+// vengono solo dal manifest, cosi' lo stesso contenuto produce sempre un
+// pacchetto con lo stesso SHA-256.
+var packageTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func writeZipEntry(zw *zip.Writer, name string, data []byte, modified time.Time) error {
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return fmt.Errorf("impossibile aggiungere %s al pacchetto: %w", name, err)
+	}
+	if _, err := fw.Write(data); err != nil {
+		return fmt.Errorf("impossibile scrivere %s nel pacchetto: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package module
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tipi di valore del registro accettati da valueType (REG_SZ se vuoto).
+const (
+	RegString       = "REG_SZ"
+	RegExpandString = "REG_EXPAND_SZ"
+	RegMultiString  = "REG_MULTI_SZ"
+	RegDWord        = "REG_DWORD"
+	RegQWord        = "REG_QWORD"
+	RegBinary       = "REG_BINARY"
+)
+
+// Azioni dello step registry (set se vuota).
+const (
+	RegActionSet          = "set"
+	RegActionDelete       = "delete"
+	RegActionEnsureAbsent = "ensure-absent"
+)
+
+// DefaultUserKey e' la sottochiave di HKU che indica il profilo predefinito
+// (Users\Default\NTUSER.DAT), copiato nel profilo di ogni nuovo utente: lo
+// step carica il file come hive temporaneo, lo modifica e lo scarica. Non va
+// confuso con HKU\.DEFAULT, che e' il profilo di LocalSystem.
+const DefaultUserKey = "DefaultUser"
+
+// minDeleteDepth e' il numero minimo di sottochiavi sotto la radice (HKU
+// esclusa la sottochiave dell'utente) per eliminare una chiave intera, cosi'
+// che una key come HKLM\SOFTWARE non cancelli un ramo di sistema.
+const minDeleteDepth = 2
+
+// RegistryValue e' il dato di uno step registry convertito nel suo tipo.
+type RegistryValue struct {
+	Type    string
+	String  string
+	Strings []string
+	Integer uint64
+	Binary  []byte
+}
+
+// RegistryValue interpreta value/values secondo valueType: numeri decimali o
+// esadecimali (0x...) per DWORD e QWORD, byte esadecimali separati da spazi,
+// virgole o nulla per BINARY, values (o value come unico elemento) per MULTI_SZ.
+func (s Step) RegistryValue() (RegistryValue, error) {
+	v := RegistryValue{Type: strings.ToUpper(s.ValueType)}
+	if v.Type == "" {
+		v.Type = RegString
+	}
+	if len(s.Values) > 0 && v.Type != RegMultiString {
+		return v, fmt.Errorf("values ammesso solo con valueType %s", RegMultiString)
+	}
+
+	switch v.Type {
+	case RegString, RegExpandString:
+		v.String = s.Value
+	case RegMultiString:
+		v.Strings = s.Values
+		if len(v.Strings) == 0 && s.Value != "" {
+			v.Strings = []string{s.Value}
+		}
+	case RegDWord, RegQWord:
+		bits := 32
+		if v.Type == RegQWord {
+			bits = 64
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(s.Value), 0, bits)
+		if err != nil {
+			return v, fmt.Errorf("valore %s non valido: %q", v.Type, s.Value)
+		}
+		v.Integer = n
+	case RegBinary:
+		digits := strings.NewReplacer(" ", "", ",", "", "\t", "", "\n", "", "\r", "").Replace(s.Value)
+		data, err := hex.DecodeString(digits)
+		if err != nil {
+			return v, fmt.Errorf("valore %s non valido: %q", v.Type, s.Value)
+		}
+		v.Binary = data
+	default:
+		return v, fmt.Errorf("valueType sconosciuto: %s", s.ValueType)
+	}
+	return v, nil
+}
+
+// ValidateRegistry controlla azione, vista e valore di uno step registry
+// senza accedere al registro.
+func (s Step) ValidateRegistry() error {
+	if s.File != "" {
+		if s.Key != "" || s.Variable != "" || s.Value != "" || len(s.Values) > 0 {
+			return fmt.Errorf("file .reg alternativo a key, variable, value e values")
+		}
+		return validateRegistryView(s.View)
+	}
+	if s.Key == "" {
+		return fmt.Errorf("campo 'key' obbligatorio per step registry")
+	}
+	if err := validateRegistryView(s.View); err != nil {
+		return err
+	}
+	switch s.Action {
+	case "", RegActionSet:
+		_, err := s.RegistryValue()
+		return err
+	case RegActionDelete, RegActionEnsureAbsent:
+		if s.Variable == "" && registryKeyDepth(s.Key) < minDeleteDepth {
+			return fmt.Errorf("chiave %s troppo generica da eliminare: servono almeno %d livelli sotto la radice", s.Key, minDeleteDepth)
+		}
+		return nil
+	}
+	return fmt.Errorf("azione registro sconosciuta: %s (ammesse: set, delete, ensure-absent)", s.Action)
+}
+
+// registryKeyDepth conta le sottochiavi di key sotto la radice; per HKU non
+// conta quella dell'utente (SID o DefaultUser).
+func registryKeyDepth(key string) int {
+	var parts []string
+	for _, p := range strings.Split(key, `\`) {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	depth := len(parts) - 1
+	if len(parts) > 0 {
+		switch strings.ToUpper(parts[0]) {
+		case "HKU", "HKEY_USERS":
+			depth--
+		}
+	}
+	return depth
+}
+
+func validateRegistryView(view string) error {
+	switch view {
+	case "", "32", "64":
+		return nil
+	}
+	return fmt.Errorf("vista registro sconosciuta: %s (ammesse: 32, 64)", view)
+}
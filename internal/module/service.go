@@ -0,0 +1,120 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Azioni dello step service.
+const (
+	ServiceStart     = "start"
+	ServiceStop      = "stop"
+	ServiceRestart   = "restart"
+	ServiceCreate    = "create"
+	ServiceConfigure = "configure"
+	ServiceDelete    = "delete"
+	ServiceQuery     = "query"
+)
+
+// Tipi di avvio di un servizio.
+const (
+	StartAuto        = "auto"
+	StartDelayedAuto = "delayed-auto"
+	StartManual      = "manual"
+	StartDisabled    = "disabled"
+)
+
+// Azioni di ripristino in caso di errore del servizio.
+const (
+	RecoveryNone       = "none"
+	RecoveryRestart    = "restart"
+	RecoveryReboot     = "reboot"
+	RecoveryRunCommand = "run-command"
+)
+
+// DefaultServiceTimeout e' l'attesa predefinita, in secondi, dei cambi di stato.
+const DefaultServiceTimeout = 30
+
+// ServiceConfig descrive il servizio per le azioni create e configure; i campi
+// vuoti restano invariati con configure. BinaryPath e' seguito dagli args dello step.
+type ServiceConfig struct {
+	DisplayName     string            `json:"displayName,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	BinaryPath      string            `json:"binaryPath,omitempty"`
+	StartType       string            `json:"startType,omitempty"`
+	Account         string            `json:"account,omitempty"`
+	Password        string            `json:"password,omitempty"`
+	Dependencies    []string          `json:"dependencies,omitempty"`
+	Recovery        []ServiceRecovery `json:"recovery,omitempty"`
+	RecoveryCommand string            `json:"recoveryCommand,omitempty"`
+	ResetPeriod     int               `json:"resetPeriod,omitempty"`
+	Timeout         int               `json:"timeout,omitempty"`
+}
+
+// ServiceRecovery e' l'azione eseguita dopo un errore del servizio, con
+// ritardo in secondi. La prima voce vale per il primo errore, e cosi' via.
+type ServiceRecovery struct {
+	Action string `json:"action"`
+	Delay  int    `json:"delay,omitempty"`
+}
+
+// ServiceTimeout restituisce l'attesa dei cambi di stato in secondi.
+func (s Step) ServiceTimeout() int {
+	if s.Service != nil && s.Service.Timeout > 0 {
+		return s.Service.Timeout
+	}
+	return DefaultServiceTimeout
+}
+
+// ValidateService controlla azione e configurazione di uno step service;
+// value e' il nome del servizio.
+func (s Step) ValidateService() error {
+	if strings.TrimSpace(s.Value) == "" {
+		return fmt.Errorf("campo 'value' (nome del servizio) obbligatorio per step service")
+	}
+	switch s.Action {
+	case ServiceStart, ServiceStop, ServiceRestart, ServiceDelete, ServiceQuery:
+		return nil
+	case ServiceCreate:
+		if s.Service == nil || s.Service.BinaryPath == "" {
+			return fmt.Errorf("service.binaryPath obbligatorio per creare il servizio %s", s.Value)
+		}
+	case ServiceConfigure:
+		if s.Service == nil {
+			return fmt.Errorf("campo 'service' obbligatorio per configurare il servizio %s", s.Value)
+		}
+	default:
+		return fmt.Errorf("azione servizio sconosciuta: %s (ammesse: start, stop, restart, create, configure, delete, query)", s.Action)
+	}
+
+	cfg := s.Service
+	switch cfg.StartType {
+	case "", StartAuto, StartDelayedAuto, StartManual, StartDisabled:
+	default:
+		return fmt.Errorf("startType sconosciuto: %s (ammessi: auto, delayed-auto, manual, disabled)", cfg.StartType)
+	}
+	if cfg.Password != "" && cfg.Account == "" {
+		return fmt.Errorf("service.password richiede service.account")
+	}
+	if len(cfg.Recovery) > 3 {
+		return fmt.Errorf("service.recovery ammette al massimo 3 azioni")
+	}
+	for _, r := range cfg.Recovery {
+		switch r.Action {
+		case RecoveryNone, RecoveryRestart, RecoveryReboot:
+		case RecoveryRunCommand:
+			if cfg.RecoveryCommand == "" {
+				return fmt.Errorf("azione di ripristino run-command richiede service.recoveryCommand")
+			}
+		default:
+			return fmt.Errorf("azione di ripristino sconosciuta: %s (ammesse: none, restart, reboot, run-command)", r.Action)
+		}
+		if r.Delay < 0 {
+			return fmt.Errorf("ritardo di ripristino negativo")
+		}
+	}
+	if cfg.ResetPeriod < 0 || cfg.Timeout < 0 {
+		return fmt.Errorf("resetPeriod e timeout non possono essere negativi")
+	}
+	return nil
+}
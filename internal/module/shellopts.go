@@ -0,0 +1,71 @@
+package module
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ShellTargets sono i target dello step shell_config con il carattere di
+// commento usato per i marcatori del blocco gestito.
+var ShellTargets = map[string]string{
+	"powershell_profile":      "#",
+	"powershell_user":         "#",
+	"windows_powershell_user": "#",
+	"pwsh_user":               "#",
+	"cmd_autorun":             "REM",
+	"bash_rc":                 "#",
+	"zsh_rc":                  "#",
+	"wsl_bash_rc":             "#",
+	"wsl_zsh_rc":              "#",
+}
+
+// Azioni dello step shell_config (set se vuota).
+const (
+	ShellActionSet    = "set"
+	ShellActionRemove = "remove"
+)
+
+// ValidateShell controlla target, azione e contenuto di uno step shell_config.
+func (s Step) ValidateShell() error {
+	if _, ok := ShellTargets[s.Target]; !ok {
+		targets := make([]string, 0, len(ShellTargets))
+		for t := range ShellTargets {
+			targets = append(targets, t)
+		}
+		sort.Strings(targets)
+		return fmt.Errorf("target shell sconosciuto: %s (ammessi: %s)", s.Target, strings.Join(targets, ", "))
+	}
+	switch s.Action {
+	case "", ShellActionSet:
+		if strings.TrimSpace(s.Content) == "" {
+			return fmt.Errorf("campo 'content' obbligatorio per step shell_config")
+		}
+	case ShellActionRemove:
+		if s.Legacy != "" {
+			return fmt.Errorf("legacy non ammesso con action remove")
+		}
+	default:
+		return fmt.Errorf("azione shell_config sconosciuta: %s (ammesse: set, remove)", s.Action)
+	}
+	if s.Target == "cmd_autorun" && s.Dest != "" {
+		return fmt.Errorf("dest non ammesso per cmd_autorun")
+	}
+	switch s.Scope {
+	case "", "machine", "user":
+	default:
+		return fmt.Errorf("scope sconosciuto: %s", s.Scope)
+	}
+	return nil
+}
+
+// ShellBlockName e' il nome del blocco gestito di uno step shell_config:
+// la cartella del modulo, che a differenza del nome visualizzato non cambia
+// tra le versioni, seguita da key se lo stesso modulo scrive piu' blocchi
+// nello stesso file.
+func (s Step) ShellBlockName(folder string) string {
+	if s.Key != "" {
+		return folder + ":" + s.Key
+	}
+	return folder
+}
@@ -0,0 +1,92 @@
+package module
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Posizioni dello step shortcut (target), per tutti gli utenti o, con scope
+// user, per l'utente corrente.
+const (
+	ShortcutStartMenu = "start_menu"
+	ShortcutDesktop   = "desktop"
+	ShortcutStartup   = "startup"
+)
+
+// Azioni dello step shortcut (create se vuota).
+const (
+	ShortcutCreate = "create"
+	ShortcutDelete = "delete"
+)
+
+// ShortcutConfig descrive il collegamento; gli argomenti sono gli args dello step.
+type ShortcutConfig struct {
+	Target      string `json:"target"`
+	WorkingDir  string `json:"workingDir,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	IconIndex   int    `json:"iconIndex,omitempty"`
+	Description string `json:"description,omitempty"`
+	RunAsAdmin  bool   `json:"runAsAdmin,omitempty"`
+	// Window e' normal (predefinita), maximized o minimized.
+	Window string `json:"window,omitempty"`
+}
+
+// ShortcutFile restituisce il percorso del collegamento relativo alla
+// cartella del target: value, eventualmente con sottocartelle, con .lnk.
+func (s Step) ShortcutFile() string {
+	name := filepath.FromSlash(strings.Trim(s.Value, `\/`))
+	if !strings.EqualFold(filepath.Ext(name), ".lnk") {
+		name += ".lnk"
+	}
+	return name
+}
+
+// ValidateShortcut controlla uno step shortcut; value e' il nome del
+// collegamento (es. WebGain\Strumento), dest ne sostituisce il percorso.
+func (s Step) ValidateShortcut() error {
+	if s.Dest == "" {
+		switch s.Target {
+		case ShortcutStartMenu, ShortcutDesktop, ShortcutStartup:
+		default:
+			return fmt.Errorf("target shortcut sconosciuto: %q (ammessi: start_menu, desktop, startup) o dest obbligatorio", s.Target)
+		}
+		name := strings.Trim(s.Value, `\/`)
+		if name == "" {
+			return fmt.Errorf("campo 'value' (nome del collegamento) obbligatorio per step shortcut")
+		}
+		for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '\\' || r == '/' }) {
+			if part == "." || part == ".." || strings.ContainsAny(part, `:*?"<>|`) {
+				return fmt.Errorf("nome collegamento non valido: %s", s.Value)
+			}
+		}
+	} else if s.Target != "" || s.Value != "" {
+		return fmt.Errorf("dest e' alternativo a target e value")
+	}
+	switch s.Scope {
+	case "", "machine", "user":
+	default:
+		return fmt.Errorf("scope sconosciuto: %s", s.Scope)
+	}
+
+	switch s.Action {
+	case "", ShortcutCreate:
+	case ShortcutDelete:
+		return nil
+	default:
+		return fmt.Errorf("azione shortcut sconosciuta: %s (ammesse: create, delete)", s.Action)
+	}
+	c := s.Shortcut
+	if c == nil || strings.TrimSpace(c.Target) == "" {
+		return fmt.Errorf("shortcut.target obbligatorio per creare un collegamento")
+	}
+	switch c.Window {
+	case "", "normal", "maximized", "minimized":
+	default:
+		return fmt.Errorf("window sconosciuta: %s (ammesse: normal, maximized, minimized)", c.Window)
+	}
+	if c.IconIndex != 0 && c.Icon == "" {
+		return fmt.Errorf("iconIndex richiede icon")
+	}
+	return nil
+}
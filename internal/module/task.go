@@ -0,0 +1,51 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Azioni dello step scheduled_task (create se vuota).
+const (
+	TaskCreate = "create"
+	TaskUpdate = "update"
+	TaskDelete = "delete"
+)
+
+// TaskFolder e' la cartella dell'Utilita' di pianificazione in cui vengono
+// registrate le attivita' indicate senza percorso.
+const TaskFolder = `\WebGain\`
+
+// TaskName restituisce il percorso completo dell'attivita': value, con la
+// cartella TaskFolder se non inizia con \.
+func (s Step) TaskName() string {
+	if strings.HasPrefix(s.Value, `\`) {
+		return s.Value
+	}
+	return TaskFolder + s.Value
+}
+
+// ValidateTask controlla uno step scheduled_task; value e' il nome
+// dell'attivita', task la definizione per create e update.
+func (s Step) ValidateTask() error {
+	name := strings.Trim(s.Value, `\`)
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("campo 'value' (nome dell'attivita') obbligatorio per step scheduled_task")
+	}
+	if strings.ContainsAny(s.Value, `/:*?"<>|`) {
+		return fmt.Errorf("nome attivita' non valido: %s", s.Value)
+	}
+	switch s.Action {
+	case "", TaskCreate, TaskUpdate:
+		if s.Task == nil {
+			return fmt.Errorf("campo 'task' obbligatorio per creare o aggiornare l'attivita' %s", s.Value)
+		}
+		if err := s.Task.Validate(); err != nil {
+			return fmt.Errorf("task: %w", err)
+		}
+	case TaskDelete:
+	default:
+		return fmt.Errorf("azione attivita' sconosciuta: %s (ammesse: create, update, delete)", s.Action)
+	}
+	return nil
+}
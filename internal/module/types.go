@@ -1,5 +1,7 @@
 package module
 
+import "WebGainInstaller/internal/taskxml"
+
 const (
 	StatusPending    = "pending"
 	StatusInstalling = "installing"
@@ -25,13 +27,69 @@ type Step struct {
 	Content  string `json:"content,omitempty"`
 	Key      string `json:"key,omitempty"`
 	Dest     string `json:"dest,omitempty"`
+	Secret   bool   `json:"secret,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+
+	// Legacy e' il testo scritto senza marcatori da versioni precedenti di uno
+	// step shell_config, sostituito dal blocco gestito alla prima esecuzione.
+	Legacy string `json:"legacy,omitempty"`
+
+	// ValueType e View configurano lo step registry; Values e' il contenuto di REG_MULTI_SZ.
+	ValueType string   `json:"valueType,omitempty"`
+	View      string   `json:"view,omitempty"`
+	Values    []string `json:"values,omitempty"`
+
+	// Exclude, Overwrite, Backup, PreserveTimestamps e ACL configurano lo step copy.
+	Exclude            []string `json:"exclude,omitempty"`
+	Overwrite          string   `json:"overwrite,omitempty"`
+	Backup             bool     `json:"backup,omitempty"`
+	PreserveTimestamps bool     `json:"preserveTimestamps,omitempty"`
+	ACL                string   `json:"acl,omitempty"`
+
+	// Service configura le azioni create e configure dello step service.
+	Service *ServiceConfig `json:"service,omitempty"`
+
+	// Task definisce l'attivita' dello step scheduled_task.
+	Task *taskxml.Task `json:"task,omitempty"`
+
+	// Shortcut descrive il collegamento dello step shortcut.
+	Shortcut *ShortcutConfig `json:"shortcut,omitempty"`
+
+	// Checks sono i controlli dichiarativi dello step verify, alternativi a command.
+	Checks []Check `json:"checks,omitempty"`
+
+	// Path e Section individuano il valore da modificare negli step *_config.
+	Path    string `json:"path,omitempty"`
+	Section string `json:"section,omitempty"`
+
+	// OnUninstall riserva lo step alla disinstallazione del modulo: viene
+	// saltato durante l'installazione.
+	OnUninstall bool `json:"onUninstall,omitempty"`
+
+	// Capture salva l'output dello step nella variabile d'ambiente indicata,
+	// visibile agli step successivi; CaptureRegex o CaptureJSONPath ne estraggono una parte.
+	Capture         string `json:"capture,omitempty"`
+	CaptureRegex    string `json:"captureRegex,omitempty"`
+	CaptureJSONPath string `json:"captureJsonPath,omitempty"`
+}
+
+// SecretValues restituisce i campi di uno step marcato secret, da mascherare
+// nei log e nei messaggi di errore.
+func (s Step) SecretValues() []string {
+	if !s.Secret {
+		return nil
+	}
+	return []string{s.Value, s.Args, s.Command, s.Content}
 }
 
 type Command struct {
 	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`
 	Description string `json:"description"`
 	Weight      int    `json:"weight"`
 	Steps       []Step `json:"steps"`
+	// Uninstall, se presente, registra il modulo in App installate.
+	Uninstall *UninstallEntry `json:"uninstall,omitempty"`
 }
 
 type Module struct {
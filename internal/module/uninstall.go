@@ -0,0 +1,47 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UninstallKeyPrefix e' la chiave, sotto HKLM, delle voci di App installate
+// registrate per i moduli: il nome completo e' WebGain.<cartella modulo>.
+const UninstallKeyPrefix = `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\WebGain.`
+
+// UninstallEntry registra il modulo in App installate (Installazione
+// applicazioni). La voce punta alla modalita' -uninstall dell'installer, che
+// esegue gli step del modulo marcati onUninstall e poi la rimuove.
+type UninstallEntry struct {
+	// DisplayName e' il nome mostrato, il name del modulo se vuoto.
+	DisplayName string `json:"displayName,omitempty"`
+	Publisher   string `json:"publisher,omitempty"`
+	// Icon e' il file dell'icona, eventualmente con indice (tool.exe,0).
+	Icon            string `json:"icon,omitempty"`
+	InstallLocation string `json:"installLocation,omitempty"`
+	// EstimatedSize e' la dimensione in KB; se assente viene calcolata
+	// dal contenuto di InstallLocation.
+	EstimatedSize int `json:"estimatedSize,omitempty"`
+}
+
+// ValidateUninstall controlla la voce di disinstallazione e gli step
+// onUninstall del modulo.
+func (c Command) ValidateUninstall() error {
+	hasSteps := false
+	for _, s := range c.Steps {
+		hasSteps = hasSteps || s.OnUninstall
+	}
+	if c.Uninstall == nil {
+		if hasSteps {
+			return fmt.Errorf("step onUninstall senza voce 'uninstall': non verrebbero mai eseguiti")
+		}
+		return nil
+	}
+	if c.Uninstall.EstimatedSize < 0 {
+		return fmt.Errorf("uninstall.estimatedSize non puo' essere negativo")
+	}
+	if strings.TrimSpace(c.Uninstall.DisplayName) == "" && strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("uninstall.displayName obbligatorio per moduli senza name")
+	}
+	return nil
+}
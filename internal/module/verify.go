@@ -0,0 +1,258 @@
+package module
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Tipi di controllo dello step verify.
+const (
+	CheckFile     = "file"
+	CheckDir      = "dir"
+	CheckRegistry = "registry"
+	CheckCommand  = "command"
+	CheckPath     = "path"
+	CheckPort     = "port"
+	CheckHTTP     = "http"
+	CheckService  = "service"
+)
+
+// DefaultCheckTimeout e' l'attesa predefinita, in secondi, dei controlli
+// command, port e http.
+const DefaultCheckTimeout = 10
+
+// Check e' un controllo dichiarativo dello step verify. I campi usati
+// dipendono da Type; Name, se presente, identifica il controllo nel report.
+type Check struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+
+	// file e dir: Path, con SHA256 opzionale per i file.
+	Path   string `json:"path,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+
+	// registry: Key e Variable (vuota per il valore predefinito); Value, se
+	// presente, e' il dato atteso, altrimenti basta che il valore esista.
+	Key      string `json:"key,omitempty"`
+	Variable string `json:"variable,omitempty"`
+	Value    string `json:"value,omitempty"`
+	View     string `json:"view,omitempty"`
+
+	// command: Command eseguito con cmd.exe, riuscito se termina con exit code
+	// 0 e, se presente, l'output corrisponde a Match.
+	Command string `json:"command,omitempty"`
+	Match   string `json:"match,omitempty"`
+
+	// path: Executable cercato nel PATH; con MinVersion la versione letta
+	// dall'output di VersionArgs (--version se vuoto) deve essere almeno quella.
+	Executable  string `json:"executable,omitempty"`
+	MinVersion  string `json:"minVersion,omitempty"`
+	VersionArgs string `json:"versionArgs,omitempty"`
+
+	// port: Host (localhost se vuoto) e Port in ascolto.
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port,omitempty"`
+
+	// http: URL che deve rispondere con Status (200 se assente).
+	URL    string `json:"url,omitempty"`
+	Status int    `json:"status,omitempty"`
+
+	// service: Service nello stato State (running se vuoto, absent se non
+	// deve essere installato).
+	Service string `json:"service,omitempty"`
+	State   string `json:"state,omitempty"`
+
+	Timeout int `json:"timeout,omitempty"`
+}
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// Label restituisce il nome del controllo, o una descrizione ricavata dai campi.
+func (c Check) Label() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	switch c.Type {
+	case CheckFile, CheckDir:
+		return c.Path
+	case CheckRegistry:
+		return c.Key + `\` + c.Variable
+	case CheckCommand:
+		return c.Command
+	case CheckPath:
+		if c.MinVersion != "" {
+			return c.Executable + " >= " + c.MinVersion
+		}
+		return c.Executable
+	case CheckPort:
+		return fmt.Sprintf("%s:%d", c.HostName(), c.Port)
+	case CheckHTTP:
+		return c.URL
+	case CheckService:
+		return c.Service
+	}
+	return c.Type
+}
+
+// HostName restituisce l'host del controllo port.
+func (c Check) HostName() string {
+	if c.Host == "" {
+		return "localhost"
+	}
+	return c.Host
+}
+
+// ExpectedStatus restituisce lo status HTTP atteso.
+func (c Check) ExpectedStatus() int {
+	if c.Status == 0 {
+		return 200
+	}
+	return c.Status
+}
+
+// ExpectedState restituisce lo stato del servizio atteso.
+func (c Check) ExpectedState() string {
+	if c.State == "" {
+		return "running"
+	}
+	return c.State
+}
+
+// TimeoutSeconds restituisce l'attesa massima del controllo in secondi.
+func (c Check) TimeoutSeconds() int {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultCheckTimeout
+}
+
+// Validate controlla i campi richiesti dal tipo di controllo.
+func (c Check) Validate() error {
+	switch c.Type {
+	case CheckFile, CheckDir:
+		if c.Path == "" {
+			return fmt.Errorf("path obbligatorio")
+		}
+		if c.SHA256 != "" && (c.Type == CheckDir || !sha256Hex.MatchString(c.SHA256)) {
+			return fmt.Errorf("sha256 ammesso solo per file, come 64 cifre esadecimali")
+		}
+	case CheckRegistry:
+		if c.Key == "" {
+			return fmt.Errorf("key obbligatoria")
+		}
+		if c.View != "" && c.View != "32" && c.View != "64" {
+			return fmt.Errorf("view non valida: %s (ammesse: 32, 64)", c.View)
+		}
+	case CheckCommand:
+		if c.Command == "" {
+			return fmt.Errorf("command obbligatorio")
+		}
+	case CheckPath:
+		if c.Executable == "" {
+			return fmt.Errorf("executable obbligatorio")
+		}
+		if c.MinVersion != "" && ParseVersion(c.MinVersion) == nil {
+			return fmt.Errorf("minVersion non valida: %s", c.MinVersion)
+		}
+	case CheckPort:
+		if c.Port < 1 || c.Port > 65535 {
+			return fmt.Errorf("port deve essere tra 1 e 65535")
+		}
+	case CheckHTTP:
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url non valido: %q", c.URL)
+		}
+	case CheckService:
+		if c.Service == "" {
+			return fmt.Errorf("service obbligatorio")
+		}
+		switch c.ExpectedState() {
+		case "running", "stopped", "absent":
+		default:
+			return fmt.Errorf("state non valido: %s (ammessi: running, stopped, absent)", c.State)
+		}
+	default:
+		return fmt.Errorf("tipo di controllo sconosciuto: %s", c.Type)
+	}
+	if c.Match != "" {
+		if c.Type != CheckCommand {
+			return fmt.Errorf("match ammesso solo per controlli command")
+		}
+		if _, err := regexp.Compile(c.Match); err != nil {
+			return fmt.Errorf("match non valida: %w", err)
+		}
+	}
+	return nil
+}
+
+// ValidateVerify controlla uno step verify: command (il controllo storico
+// con cmd.exe) oppure checks.
+func (s Step) ValidateVerify() error {
+	if len(s.Checks) == 0 {
+		if strings.TrimSpace(s.Command) == "" {
+			return fmt.Errorf("step verify richiede command o checks")
+		}
+		return nil
+	}
+	if s.Command != "" {
+		return fmt.Errorf("command e checks sono alternativi nello step verify")
+	}
+	for i, c := range s.Checks {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("checks[%d] (%s): %w", i, c.Type, err)
+		}
+	}
+	return nil
+}
+
+var (
+	dottedVersion = regexp.MustCompile(`\d+\.\d+(?:\.\d+)*`)
+	bareVersion   = regexp.MustCompile(`\d+`)
+)
+
+// ParseVersion estrae la prima versione numerica (es. 20.11.1 da
+// "node v20.11.1") e ne restituisce i componenti, nil se assente. Una versione
+// con il punto ha la precedenza su un numero isolato: "7-Zip 23.01" da' 23.01.
+func ParseVersion(s string) []int {
+	match := dottedVersion.FindString(s)
+	if match == "" {
+		match = bareVersion.FindString(s)
+	}
+	if match == "" {
+		return nil
+	}
+	var parts []int
+	for _, p := range strings.Split(match, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// CompareVersions confronta due versioni componente per componente; i
+// componenti mancanti valgono 0, quindi 1.2 e 1.2.0 sono uguali.
+func CompareVersions(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,288 @@
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//go:embed *.schema.json
+var files embed.FS
+
+const (
+	Setup   = "setup.schema.json"
+	Command = "command.schema.json"
+	Order   = "order.schema.json"
+
+	// Collector documenta il payload inviato al collettore dei report.
+	Collector = "collector.schema.json"
+)
+
+// Schema e' il sottoinsieme di JSON Schema (draft-07) usato dai file di configurazione.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Error e' una violazione dello schema qualificata dal percorso JSON,
+// es. steps[4].type: valore sconosciuto "msix".
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e Error) Error() string {
+	if e.Path == "" {
+		return "(radice): " + e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+type Errors []Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Files espone gli schemi embedded, ad esempio per pubblicarli agli editor.
+func Files() fs.FS {
+	return files
+}
+
+var (
+	loadMu sync.Mutex
+	loaded = make(map[string]*Schema)
+)
+
+// Load restituisce lo schema name, letto e compilato una sola volta. Il
+// risultato e' condiviso e non va modificato.
+func Load(name string) (*Schema, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	if s, ok := loaded[name]; ok {
+		return s, nil
+	}
+	data, err := fs.ReadFile(files, name)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s non disponibile: %w", name, err)
+	}
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("schema %s non valido: %w", name, err)
+	}
+	if err := s.compile(""); err != nil {
+		return nil, fmt.Errorf("schema %s non valido: %w", name, err)
+	}
+	loaded[name] = &s
+	return &s, nil
+}
+
+// compile prepara le espressioni regolari dei pattern, segnalando quelle non
+// valide invece di ignorarle in validazione.
+func (s *Schema) compile(path string) error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: pattern %q non valido: %w", path, s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for key, prop := range s.Properties {
+		if err := prop.compile(joinPath(path, key)); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(path + "[]")
+	}
+	return nil
+}
+
+// Validate verifica data rispetto allo schema name. In caso di violazioni
+// restituisce Errors ordinati per percorso.
+//
+// Sono supportate solo le parole chiave di Schema: senza oneOf, anyOf e $ref
+// i campi che dipendono dal tipo di step non vengono controllati qui ma dai
+// metodi Validate* del package module, richiamati dal lint.
+func Validate(name string, data []byte) error {
+	s, err := Load(name)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("JSON non valido: %w", err)
+	}
+
+	var errs Errors
+	s.validate("", doc, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return errs
+}
+
+func (s *Schema) validate(path string, value interface{}, errs *Errors) {
+	add := func(format string, args ...interface{}) {
+		*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !matchesType(s.Type, value) {
+		add("tipo %s, atteso %s", typeName(value), s.Type)
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, req := range s.Required {
+			if _, ok := v[req]; !ok {
+				add("proprieta' obbligatoria %q mancante", req)
+			}
+		}
+		for key, child := range v {
+			childPath := joinPath(path, key)
+			if prop, ok := s.Properties[key]; ok {
+				prop.validate(childPath, child, errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*errs = append(*errs, Error{Path: childPath, Message: "proprieta' sconosciuta"})
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			add("almeno %d elementi richiesti, trovati %d", *s.MinItems, len(v))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			add("al massimo %d elementi ammessi, trovati %d", *s.MaxItems, len(v))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(path+"["+strconv.Itoa(i)+"]", item, errs)
+			}
+		}
+	case string:
+		if len(s.Enum) > 0 && !contains(s.Enum, v) {
+			add("valore sconosciuto %q (ammessi: %s)", v, strings.Join(s.Enum, ", "))
+		}
+		if s.MinLength != nil && utf8.RuneCountInString(v) < *s.MinLength {
+			add("lunghezza minima %d", *s.MinLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			add("valore %q non conforme al formato %s", v, s.Pattern)
+		}
+	case json.Number:
+		if s.Minimum != nil {
+			if f, err := v.Float64(); err == nil && f < *s.Minimum {
+				add("valore %s inferiore al minimo %v", v, *s.Minimum)
+			}
+		}
+	}
+}
+
+func matchesType(t string, value interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	}
+	return true
+}
+
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// StepTypes restituisce i tipi di step ammessi da command.schema.json.
+func StepTypes() []string {
+	s, err := Load(Command)
+	if err != nil {
+		return nil
+	}
+	steps, ok := s.Properties["steps"]
+	if !ok || steps.Items == nil {
+		return nil
+	}
+	if t, ok := steps.Items.Properties["type"]; ok {
+		return t.Enum
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package setup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"WebGainInstaller/internal/logger"
+)
+
+const (
+	defaultCacheMaxAge = 7 * 24 * time.Hour
+	cacheSetupName     = "setup.json"
+	cacheMetaName      = "setup.meta.json"
+)
+
+// Source indica da quale livello della catena di fallback proviene setup.json.
+type Source string
+
+const (
+	SourceOnline   Source = "online"
+	SourceCache    Source = "cache"
+	SourceEmbedded Source = "embedded"
+)
+
+type cacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	SavedAt      time.Time `json:"savedAt"`
+}
+
+type cachedSetup struct {
+	meta cacheMeta
+	data []byte
+}
+
+// PersistentDir restituisce una cartella che sopravvive alla pulizia di %TEMP%
+// (ProgramData\WebGain\<sub> su Windows).
+func PersistentDir(sub string) string {
+	base := os.Getenv("ProgramData")
+	if base == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			base = dir
+		} else {
+			base = os.TempDir()
+		}
+	}
+	return filepath.Join(base, "WebGain", sub)
+}
+
+// cacheDir restituisce la cartella della cache, riservata agli amministratori:
+// setup.json decide sorgenti e hash dei moduli installati con privilegi elevati.
+func cacheDir() (string, error) {
+	return SecureDir("cache")
+}
+
+func cacheMaxAge(configFS fs.FS) time.Duration {
+	cfg, err := loadOnlineConfig(configFS)
+	if err != nil || cfg.CacheMaxAge == "" {
+		return defaultCacheMaxAge
+	}
+	maxAge, err := time.ParseDuration(cfg.CacheMaxAge)
+	if err != nil || maxAge <= 0 {
+		logger.Warn("cacheMaxAge non valido in online.json: %q, uso default %s", cfg.CacheMaxAge, defaultCacheMaxAge)
+		return defaultCacheMaxAge
+	}
+	return maxAge
+}
+
+func readCacheMeta(path string) (*cacheMeta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("metadati cache non validi: %w", err)
+	}
+	return &meta, nil
+}
+
+func writeCacheMeta(path string, meta cacheMeta) error {
+	data, err := json.MarshalIndent(meta, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// loadCachedSetup restituisce l'ultima configurazione remota salvata per url,
+// o nil se assente o relativa a un altro URL.
+func loadCachedSetup(url string) *cachedSetup {
+	dir, err := cacheDir()
+	if err != nil {
+		logger.Warn("Cache setup.json non attendibile, ignorata: %v", err)
+		return nil
+	}
+	for _, name := range []string{cacheMetaName, cacheSetupName} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := CheckTrusted(path); err != nil {
+			logger.Warn("Cache setup.json non attendibile, ignorata: %v", err)
+			return nil
+		}
+	}
+	meta, err := readCacheMeta(filepath.Join(dir, cacheMetaName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("Lettura metadati cache fallita: %v", err)
+		}
+		return nil
+	}
+	if meta.URL != url {
+		logger.Info("Cache setup.json relativa ad altro URL (%s), ignorata", meta.URL)
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, cacheSetupName))
+	if err != nil {
+		logger.Warn("Lettura setup.json in cache fallita: %v", err)
+		return nil
+	}
+	return &cachedSetup{meta: *meta, data: data}
+}
+
+// readLastKnownGood restituisce la configurazione in cache se non piu' vecchia
+// di cacheMaxAge rispetto all'ultima conferma del server.
+func readLastKnownGood(configFS fs.FS, url string) ([]byte, bool) {
+	cached := loadCachedSetup(url)
+	if cached == nil {
+		logger.Info("Nessuna ultima configurazione valida in cache")
+		return nil, false
+	}
+
+	age := time.Since(cached.meta.SavedAt)
+	maxAge := cacheMaxAge(configFS)
+	if age > maxAge {
+		logger.Warn("Ultima configurazione valida troppo vecchia (%s, massimo %s), ignorata", age.Round(time.Minute), maxAge)
+		return nil, false
+	}
+	if !isValidJSON(cached.data) {
+		logger.Warn("setup.json in cache non e' un JSON valido, ignorato")
+		return nil, false
+	}
+
+	logger.Info("Ultima configurazione valida in cache: %d bytes, salvata %s fa", len(cached.data), age.Round(time.Minute))
+	return cached.data, true
+}
+
+// storeLastKnownGood promuove in cache il setup.json online appena validato,
+// insieme a ETag/Last-Modified registrati durante il download.
+func storeLastKnownGood(webgainRoot string) {
+	meta, err := readCacheMeta(filepath.Join(webgainRoot, cacheMetaName))
+	if err != nil {
+		logger.Warn("Metadati download non disponibili, cache non aggiornata: %v", err)
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(webgainRoot, "setup.json"))
+	if err != nil {
+		logger.Warn("Lettura setup.json per cache fallita: %v", err)
+		return
+	}
+
+	dir, err := cacheDir()
+	if err != nil {
+		logger.Warn("Cartella cache non utilizzabile: %v", err)
+		return
+	}
+	// I file vengono ricreati, cosi' appartengono sempre all'installer.
+	os.Remove(filepath.Join(dir, cacheSetupName))
+	os.Remove(filepath.Join(dir, cacheMetaName))
+	if err := os.WriteFile(filepath.Join(dir, cacheSetupName), data, 0644); err != nil {
+		logger.Warn("Scrittura setup.json in cache fallita: %v", err)
+		return
+	}
+	meta.SavedAt = time.Now().UTC()
+	if err := writeCacheMeta(filepath.Join(dir, cacheMetaName), *meta); err != nil {
+		logger.Warn("Scrittura metadati cache fallita: %v", err)
+		return
+	}
+	logger.Info("Ultima configurazione valida aggiornata in %s", dir)
+}
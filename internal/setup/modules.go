@@ -0,0 +1,200 @@
+package setup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+)
+
+const defaultRepoModulePath = "repo/module"
+
+// PrepareModules raccoglie in WEBGAINROOT\modules i moduli attivi: quelli con
+// source "repo" vengono scaricati e verificati tramite manifest.json (o come
+// pacchetto .wgm se path lo indica), gli altri copiati dall'embedded.
+// Genera order.json secondo l'ordine di setup.json e restituisce l'fs.FS
+// da passare all'engine.
+func PrepareModules(configFS fs.FS, embeddedFS fs.FS, webgainRoot string, modules []Module) (fs.FS, error) {
+	root := filepath.Join(webgainRoot, "modules")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("impossibile creare cartella moduli: %w", err)
+	}
+
+	var client *http.Client
+	var baseURL string
+	order := module.Order{Name: "WebGain Installer"}
+
+	for _, m := range modules {
+		if !fs.ValidPath(m.Name) || strings.ContainsAny(m.Name, `/\:`) {
+			return nil, fmt.Errorf("nome modulo non valido: %q", m.Name)
+		}
+		destDir := filepath.Join(root, m.Name)
+
+		switch m.Source {
+		case ModuleSourceRepo:
+			if client == nil {
+				cfg, err := loadOnlineConfig(configFS)
+				if err != nil {
+					return nil, err
+				}
+				if cfg.GitHub == "" {
+					return nil, fmt.Errorf("online.json: 'github' mancante, impossibile scaricare moduli dal repo")
+				}
+				baseURL = toRawBaseURL(cfg.GitHub)
+				if client, err = NewHTTPClient(configFS, 5*time.Minute); err != nil {
+					return nil, fmt.Errorf("configurazione client HTTP fallita: %w", err)
+				}
+			}
+			if err := fetchRepoModule(client, baseURL, m, destDir); err != nil {
+				logger.Error("Modulo '%s': recupero dal repo fallito: %v", m.Name, err)
+				return nil, fmt.Errorf("modulo '%s': %w", m.Name, err)
+			}
+		default:
+			logger.Info("Modulo '%s': copia da embedded in %s", m.Name, destDir)
+			if err := copyEmbeddedModule(embeddedFS, m.Name, destDir); err != nil {
+				logger.Error("Modulo '%s': copia da embedded fallita: %v", m.Name, err)
+				return nil, fmt.Errorf("modulo '%s': %w", m.Name, err)
+			}
+		}
+
+		order.Order = append(order.Order, m.Name)
+	}
+
+	data, err := json.MarshalIndent(order, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(root, "order.json"), data, 0644); err != nil {
+		return nil, fmt.Errorf("impossibile scrivere order.json: %w", err)
+	}
+
+	logger.Info("Moduli pronti in %s: %d", root, len(order.Order))
+	return os.DirFS(root), nil
+}
+
+// fetchRepoModule scarica manifest.json del modulo e ogni file elencato,
+// verificando dimensione e SHA-256 prima di scriverli in destDir.
+func fetchRepoModule(client *http.Client, baseURL string, m Module, destDir string) error {
+	modulePath := strings.Trim(m.Path, "/")
+	if modulePath == "" {
+		modulePath = defaultRepoModulePath + "/" + m.Name
+	}
+	if strings.HasSuffix(modulePath, module.PackageExt) {
+		return fetchRepoPackage(client, baseURL+escapePath(modulePath), m, destDir+module.PackageExt)
+	}
+
+	moduleURL := baseURL + escapePath(modulePath) + "/"
+	logger.Info("Modulo '%s': download da %s", m.Name, moduleURL)
+
+	res, err := downloadWithRetry(client, moduleURL+module.ManifestFileName, 3, nil)
+	if err != nil {
+		return fmt.Errorf("download %s fallito: %w", module.ManifestFileName, err)
+	}
+	if m.SHA256 != "" {
+		if sum := module.HashBytes(res.data); !strings.EqualFold(sum, m.SHA256) {
+			return fmt.Errorf("%s: SHA-256 %s, atteso %s", module.ManifestFileName, sum, m.SHA256)
+		}
+	}
+	manifest, err := module.ParseManifest(res.data)
+	if err != nil {
+		return err
+	}
+	if manifest.Name != m.Name {
+		return fmt.Errorf("manifest relativo al modulo '%s'", manifest.Name)
+	}
+	logger.Info("Modulo '%s': manifest versione %s, %d file", m.Name, manifest.Version, len(manifest.Files))
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(destDir, module.ManifestFileName), res.data, 0644); err != nil {
+		return err
+	}
+
+	for _, f := range manifest.Files {
+		res, err := downloadWithRetry(client, moduleURL+escapePath(f.Path), 3, nil)
+		if err != nil {
+			return fmt.Errorf("download %s fallito: %w", f.Path, err)
+		}
+		if err := f.Verify(res.data); err != nil {
+			return fmt.Errorf("verifica integrita' fallita: %w", err)
+		}
+
+		dest := filepath.Join(destDir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dest, res.data, 0644); err != nil {
+			return fmt.Errorf("impossibile scrivere %s: %w", dest, err)
+		}
+		logger.Info("Modulo '%s': %s verificato (%d bytes)", m.Name, f.Path, len(res.data))
+	}
+	return nil
+}
+
+// fetchRepoPackage scarica un pacchetto modulo, ne verifica l'hash se indicato
+// in setup.json e il contenuto rispetto al manifest interno.
+func fetchRepoPackage(client *http.Client, packageURL string, m Module, destPath string) error {
+	logger.Info("Modulo '%s': download pacchetto da %s", m.Name, packageURL)
+	res, err := downloadWithRetry(client, packageURL, 3, nil)
+	if err != nil {
+		return fmt.Errorf("download pacchetto fallito: %w", err)
+	}
+	if m.SHA256 != "" {
+		if sum := module.HashBytes(res.data); !strings.EqualFold(sum, m.SHA256) {
+			return fmt.Errorf("pacchetto: SHA-256 %s, atteso %s", sum, m.SHA256)
+		}
+	}
+	_, manifest, err := module.OpenPackage(res.data)
+	if err != nil {
+		return err
+	}
+	if manifest.Name != m.Name {
+		return fmt.Errorf("pacchetto relativo al modulo '%s'", manifest.Name)
+	}
+	if err := os.WriteFile(destPath, res.data, 0644); err != nil {
+		return fmt.Errorf("impossibile scrivere %s: %w", destPath, err)
+	}
+	logger.Info("Modulo '%s': pacchetto versione %s verificato (%d file)", m.Name, manifest.Version, len(manifest.Files))
+	return nil
+}
+
+func copyEmbeddedModule(embeddedFS fs.FS, name, destDir string) error {
+	if embeddedFS == nil {
+		return fmt.Errorf("nessun modulo embedded disponibile")
+	}
+	if data, err := fs.ReadFile(embeddedFS, name+module.PackageExt); err == nil {
+		return os.WriteFile(destDir+module.PackageExt, data, 0644)
+	}
+	return fs.WalkDir(embeddedFS, name, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(destDir, filepath.FromSlash(strings.TrimPrefix(p, name)))
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+		data, err := fs.ReadFile(embeddedFS, p)
+		if err != nil {
+			return fmt.Errorf("impossibile leggere %s: %w", p, err)
+		}
+		return os.WriteFile(dest, data, 0644)
+	})
+}
+
+func escapePath(p string) string {
+	segments := strings.Split(path.Clean(p), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
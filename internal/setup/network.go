@@ -0,0 +1,279 @@
+package setup
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"WebGainInstaller/internal/logger"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+type proxyConfig struct {
+	URL      string `json:"url,omitempty"`
+	NoProxy  string `json:"noProxy,omitempty"`
+	PAC      string `json:"pac,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type proxyFunc func(*url.URL) (*url.URL, error)
+
+// NewHTTPClient costruisce il client per le richieste online applicando
+// proxy, autenticazione proxy e CA aggiuntiva definiti in online.json.
+func NewHTTPClient(configFS fs.FS, timeout time.Duration) (*http.Client, error) {
+	cfg, err := loadOnlineConfig(configFS)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxy, err := resolveProxy(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if proxy != nil {
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxy(req.URL)
+		}
+	} else {
+		transport.Proxy = nil
+	}
+
+	if cfg.CABundle != "" {
+		pool, err := loadCABundle(configFS, cfg.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// RegisterSecrets registra nel logger tutte le credenziali di online.json
+// (password del proxy, token dell'API e del collettore, anche da variabile
+// d'ambiente), per le modalita' che leggono o esportano i log senza passare da
+// NewHTTPClient, LoadAPIConfig o LoadCollectorConfig.
+func RegisterSecrets(configFS fs.FS) {
+	if cfg, err := loadOnlineConfig(configFS); err == nil && cfg.Proxy != nil {
+		logger.AddSecret(cfg.Proxy.Password)
+	}
+	LoadAPIConfig(configFS)
+	LoadCollectorConfig(configFS)
+}
+
+// resolveProxy sceglie il percorso proxy in ordine di priorita':
+// proxy esplicito in online.json, script PAC, variabili d'ambiente, connessione diretta.
+func resolveProxy(cfg *proxyConfig) (proxyFunc, error) {
+	if cfg == nil {
+		cfg = &proxyConfig{}
+	}
+	logger.AddSecret(cfg.Password)
+
+	if cfg.URL != "" {
+		proxyURL, err := url.Parse(cfg.URL)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("proxy.url non valido: %q", cfg.URL)
+		}
+		logger.Info("Proxy: configurazione esplicita da online.json %s (noProxy=%q)", withProxyAuth(proxyURL, cfg).Redacted(), cfg.NoProxy)
+		explicit := httpproxy.Config{
+			HTTPProxy:  proxyURL.String(),
+			HTTPSProxy: proxyURL.String(),
+			NoProxy:    cfg.NoProxy,
+		}
+		return authenticated(explicit.ProxyFunc(), cfg), nil
+	}
+
+	env := httpproxy.FromEnvironment()
+	var envProxy proxyFunc
+	if env.HTTPSProxy != "" || env.HTTPProxy != "" {
+		envProxy = authenticated(env.ProxyFunc(), cfg)
+	}
+
+	if cfg.PAC != "" {
+		logger.Info("Proxy: valutazione script PAC %s", cfg.PAC)
+		return newPACResolver(cfg, envProxy), nil
+	}
+
+	if envProxy != nil {
+		logger.Info("Proxy: da variabili d'ambiente HTTPS_PROXY=%s HTTP_PROXY=%s NO_PROXY=%q",
+			redactProxy(env.HTTPSProxy), redactProxy(env.HTTPProxy), env.NoProxy)
+		return envProxy, nil
+	}
+
+	logger.Info("Proxy: nessuno, connessione diretta")
+	return nil, nil
+}
+
+// pacFailureTTL e' per quanto tempo un host la cui valutazione PAC e' fallita
+// usa direttamente il fallback, senza ripetere la rilevazione.
+const pacFailureTTL = 5 * time.Minute
+
+// newPACResolver valuta lo script PAC per host, memorizzando il risultato.
+// Se la valutazione fallisce ricade sul proxy da ambiente o sulla connessione
+// diretta, e per pacFailureTTL non la ritenta per lo stesso host. Il lock non
+// viene tenuto durante la valutazione, cosi' le richieste verso altri host non
+// attendono la rilevazione WPAD.
+func newPACResolver(cfg *proxyConfig, fallback proxyFunc) proxyFunc {
+	var mu sync.Mutex
+	cache := make(map[string]*url.URL)
+	failed := make(map[string]time.Time)
+
+	pacFallback := func(target *url.URL) (*url.URL, error) {
+		if fallback != nil {
+			return fallback(target)
+		}
+		return nil, nil
+	}
+
+	return func(target *url.URL) (*url.URL, error) {
+		key := target.Scheme + "://" + target.Host
+		mu.Lock()
+		proxyURL, ok := cache[key]
+		retryAt, hasFailed := failed[key]
+		mu.Unlock()
+		if ok {
+			return proxyURL, nil
+		}
+		if hasFailed && time.Now().Before(retryAt) {
+			return pacFallback(target)
+		}
+
+		list, err := evaluatePAC(cfg.PAC, target.String())
+		if err != nil {
+			mu.Lock()
+			failed[key] = time.Now().Add(pacFailureTTL)
+			mu.Unlock()
+			if fallback != nil {
+				logger.Warn("Proxy: valutazione PAC fallita per %s: %v, uso variabili d'ambiente", target.Host, err)
+			} else {
+				logger.Warn("Proxy: valutazione PAC fallita per %s: %v, connessione diretta", target.Host, err)
+			}
+			return pacFallback(target)
+		}
+
+		proxyURL, err = parsePACResult(list, target.Scheme)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL == nil {
+			logger.Info("Proxy: PAC restituisce DIRECT per %s", target.Host)
+		} else {
+			proxyURL = withProxyAuth(proxyURL, cfg)
+			logger.Info("Proxy: PAC restituisce %s per %s", proxyURL.Redacted(), target.Host)
+		}
+		mu.Lock()
+		cache[key] = proxyURL
+		delete(failed, key)
+		mu.Unlock()
+		return proxyURL, nil
+	}
+}
+
+// parsePACResult interpreta la lista proxy restituita da WinHTTP
+// ("host:porta;host2:porta" oppure "http=host:porta;https=host:porta") o nella
+// sintassi PAC ("PROXY host:porta; DIRECT"). Usa la prima voce utilizzabile:
+// restituisce nil per DIRECT o lista vuota, salta i proxy SOCKS.
+func parsePACResult(list, scheme string) (*url.URL, error) {
+	for _, part := range strings.Split(list, ";") {
+		fields := strings.Fields(part)
+		for i := 0; i < len(fields); i++ {
+			entry, prefix := fields[i], "http://"
+			switch strings.ToUpper(entry) {
+			case "DIRECT":
+				return nil, nil
+			case "PROXY", "HTTP", "HTTPS", "SOCKS", "SOCKS4", "SOCKS5":
+				if i+1 == len(fields) {
+					return nil, fmt.Errorf("proxy PAC non valido %q: indirizzo mancante", part)
+				}
+				i++
+				if strings.HasPrefix(strings.ToUpper(entry), "SOCKS") {
+					continue
+				}
+				if strings.EqualFold(entry, "HTTPS") {
+					prefix = "https://"
+				}
+				entry = fields[i]
+			}
+			if name, addr, ok := strings.Cut(entry, "="); ok {
+				if !strings.EqualFold(name, scheme) {
+					continue
+				}
+				entry = addr
+			}
+			if !strings.Contains(entry, "://") {
+				entry = prefix + entry
+			}
+			proxyURL, err := url.Parse(entry)
+			if err == nil && proxyURL.Hostname() == "" {
+				err = fmt.Errorf("host mancante")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("proxy PAC non valido %q: %w", entry, err)
+			}
+			return proxyURL, nil
+		}
+	}
+	return nil, nil
+}
+
+func authenticated(next func(*url.URL) (*url.URL, error), cfg *proxyConfig) proxyFunc {
+	return func(target *url.URL) (*url.URL, error) {
+		proxyURL, err := next(target)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+		return withProxyAuth(proxyURL, cfg), nil
+	}
+}
+
+// withProxyAuth applica le credenziali di online.json al proxy, salvo che
+// l'URL ne contenga gia' di proprie. Il Transport le invia come Proxy-Authorization.
+func withProxyAuth(proxyURL *url.URL, cfg *proxyConfig) *url.URL {
+	if cfg.Username == "" || proxyURL.User != nil {
+		return proxyURL
+	}
+	withAuth := *proxyURL
+	withAuth.User = url.UserPassword(cfg.Username, cfg.Password)
+	return &withAuth
+}
+
+func redactProxy(raw string) string {
+	if raw == "" {
+		return "-"
+	}
+	if u, err := url.Parse(raw); err == nil {
+		return u.Redacted()
+	}
+	return raw
+}
+
+// loadCABundle aggiunge ai certificati di sistema quelli PEM presenti in configFS,
+// necessari dietro proxy con ispezione TLS.
+func loadCABundle(configFS fs.FS, name string) (*x509.CertPool, error) {
+	data, err := fs.ReadFile(configFS, name)
+	if err != nil {
+		return nil, fmt.Errorf("impossibile leggere CA bundle %s: %w", name, err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		logger.Warn("Certificati di sistema non disponibili: %v, uso solo CA bundle", err)
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("CA bundle %s non contiene certificati PEM validi", name)
+	}
+
+	logger.Info("CA bundle aggiuntivo caricato: %s", name)
+	return pool, nil
+}
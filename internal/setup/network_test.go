@@ -0,0 +1,61 @@
+package setup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePACResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		list   string
+		scheme string
+		want   string // URL atteso, vuoto per connessione diretta
+		err    string
+	}{
+		{"vuota", "", "https", "", ""},
+		{"solo spazi", " ; ", "https", "", ""},
+		{"DIRECT", "DIRECT", "https", "", ""},
+		{"direct minuscolo", "direct", "https", "", ""},
+		{"host e porta", "proxy.local:8080", "https", "http://proxy.local:8080", ""},
+		{"lista WinHTTP", "a.local:8080;b.local:3128", "https", "http://a.local:8080", ""},
+		{"lista separata da spazi", "a.local:8080 b.local:3128", "https", "http://a.local:8080", ""},
+		{"PROXY a; PROXY b", "PROXY a.local:8080; PROXY b.local:3128", "https", "http://a.local:8080", ""},
+		{"PROXY poi DIRECT", "PROXY a.local:8080; DIRECT", "https", "http://a.local:8080", ""},
+		{"DIRECT poi PROXY", "DIRECT; PROXY a.local:8080", "https", "", ""},
+		{"maiuscole miste", "Proxy a.local:8080; dIrEcT", "https", "http://a.local:8080", ""},
+		{"HTTPS", "HTTPS a.local:443", "https", "https://a.local:443", ""},
+		{"SOCKS saltato", "SOCKS s.local:1080; PROXY a.local:8080", "https", "http://a.local:8080", ""},
+		{"solo SOCKS", "SOCKS5 s.local:1080", "https", "", ""},
+		{"per schema", "http=h.local:80;https=s.local:443", "https", "http://s.local:443", ""},
+		{"per schema maiuscolo", "HTTP=h.local:80;HTTPS=s.local:443", "http", "http://h.local:80", ""},
+		{"schema assente", "ftp=f.local:21", "https", "", ""},
+		{"URL completo", "PROXY http://utente@a.local:8080", "https", "http://utente@a.local:8080", ""},
+		{"PROXY senza indirizzo", "PROXY", "https", "", "indirizzo mancante"},
+		{"host non valido", "a.local:80%zz", "https", "", "proxy PAC non valido"},
+		{"senza host", "http://:8080", "https", "", "host mancante"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePACResult(tt.list, tt.scheme)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("errore = %v, atteso %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("proxy = %s, attesa connessione diretta", got)
+				}
+				return
+			}
+			if got == nil || got.String() != tt.want {
+				t.Errorf("proxy = %v, atteso %s", got, tt.want)
+			}
+		})
+	}
+}
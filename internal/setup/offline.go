@@ -0,0 +1,98 @@
+package setup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+)
+
+// OfflineModules prepara in WEBGAINROOT\modules i moduli per la verifica della
+// postazione senza accedere alla rete. setup.json e' l'ultima configurazione
+// in cache, qualunque eta' abbia, o quello embedded; le definizioni vengono
+// dall'embedded o, per i moduli del repo, dalla copia salvata per la
+// disinstallazione. I moduli senza definizione locale vengono saltati.
+func OfflineModules(configFS fs.FS, embeddedFS fs.FS, webgainRoot string) (fs.FS, error) {
+	source := SourceEmbedded
+	data, err := fs.ReadFile(configFS, "setup.json")
+	if url := buildInstallerURL(configFS); url != "" {
+		if cached := loadCachedSetup(url); cached != nil {
+			source, data, err = SourceCache, cached.data, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("setup.json non disponibile: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(webgainRoot, "setup.json"), data, 0644); err != nil {
+		return nil, err
+	}
+	modules, err := InitModules(configFS, webgainRoot, source)
+	if err != nil {
+		return nil, err
+	}
+
+	root := filepath.Join(webgainRoot, "modules")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("impossibile creare cartella moduli: %w", err)
+	}
+	order := module.Order{Name: "WebGain Installer"}
+	for _, m := range modules {
+		if !fs.ValidPath(m.Name) || filepath.Base(m.Name) != m.Name {
+			return nil, fmt.Errorf("nome modulo non valido: %q", m.Name)
+		}
+		destDir := filepath.Join(root, m.Name)
+		switch {
+		case m.Source != ModuleSourceRepo && embeddedFS != nil && embeddedModuleExists(embeddedFS, m.Name):
+			if err := copyEmbeddedModule(embeddedFS, m.Name, destDir); err != nil {
+				return nil, fmt.Errorf("modulo '%s': %w", m.Name, err)
+			}
+		default:
+			if err := copyUninstallDefinition(m.Name, destDir); err != nil {
+				logger.Warn("Modulo '%s': definizione non disponibile senza rete, saltato: %v", m.Name, err)
+				continue
+			}
+		}
+		order.Order = append(order.Order, m.Name)
+	}
+	if len(order.Order) == 0 {
+		return nil, fmt.Errorf("nessun modulo disponibile senza rete")
+	}
+
+	data, err = json.MarshalIndent(order, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(root, "order.json"), data, 0644); err != nil {
+		return nil, fmt.Errorf("impossibile scrivere order.json: %w", err)
+	}
+	return os.DirFS(root), nil
+}
+
+func embeddedModuleExists(embeddedFS fs.FS, name string) bool {
+	if _, err := fs.Stat(embeddedFS, name+module.PackageExt); err == nil {
+		return true
+	}
+	info, err := fs.Stat(embeddedFS, name)
+	return err == nil && info.IsDir()
+}
+
+// copyUninstallDefinition copia il command.json salvato alla registrazione
+// della disinstallazione, l'unica copia locale dei moduli scaricati dal repo.
+func copyUninstallDefinition(name, destDir string) error {
+	src := filepath.Join(PersistentDir("uninstall"), name, "command.json")
+	if err := CheckTrusted(src); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(destDir, "command.json"), data, 0644)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package setup
+
+import "fmt"
+
+func evaluatePAC(pacURL, targetURL string) (string, error) {
+	return "", fmt.Errorf("valutazione PAC non supportata su questa piattaforma")
+}
@@ -0,0 +1,84 @@
+package setup
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	winhttpDll                = syscall.NewLazyDLL("winhttp.dll")
+	procWinHttpOpen           = winhttpDll.NewProc("WinHttpOpen")
+	procWinHttpGetProxyForUrl = winhttpDll.NewProc("WinHttpGetProxyForUrl")
+	procWinHttpCloseHandle    = winhttpDll.NewProc("WinHttpCloseHandle")
+	kernel32Dll               = syscall.NewLazyDLL("kernel32.dll")
+	procGlobalFree            = kernel32Dll.NewProc("GlobalFree")
+)
+
+const (
+	winhttpAccessTypeNoProxy   = 1
+	winhttpAutoproxyAutoDetect = 0x00000001
+	winhttpAutoproxyConfigURL  = 0x00000002
+	winhttpAutoDetectTypeDHCP  = 0x00000001
+	winhttpAutoDetectTypeDNSA  = 0x00000002
+)
+
+type winhttpAutoproxyOptions struct {
+	flags                 uint32
+	autoDetectFlags       uint32
+	autoConfigURL         *uint16
+	reserved              uintptr
+	reservedFlags         uint32
+	autoLogonIfChallenged int32
+}
+
+type winhttpProxyInfo struct {
+	accessType  uint32
+	proxy       *uint16
+	proxyBypass *uint16
+}
+
+// evaluatePAC delega a WinHTTP la valutazione dello script PAC indicato
+// (o della rilevazione WPAD se pacURL e' "auto") per targetURL.
+func evaluatePAC(pacURL, targetURL string) (string, error) {
+	agent, _ := syscall.UTF16PtrFromString("WebGainInstaller")
+	session, _, callErr := procWinHttpOpen.Call(uintptr(unsafe.Pointer(agent)), winhttpAccessTypeNoProxy, 0, 0, 0)
+	if session == 0 {
+		return "", fmt.Errorf("WinHttpOpen: %w", callErr)
+	}
+	defer procWinHttpCloseHandle.Call(session)
+
+	opts := winhttpAutoproxyOptions{autoLogonIfChallenged: 1}
+	if strings.EqualFold(pacURL, "auto") {
+		opts.flags = winhttpAutoproxyAutoDetect
+		opts.autoDetectFlags = winhttpAutoDetectTypeDHCP | winhttpAutoDetectTypeDNSA
+	} else {
+		opts.flags = winhttpAutoproxyConfigURL
+		opts.autoConfigURL, _ = syscall.UTF16PtrFromString(pacURL)
+	}
+
+	target, _ := syscall.UTF16PtrFromString(targetURL)
+	var info winhttpProxyInfo
+	ret, _, callErr := procWinHttpGetProxyForUrl.Call(
+		session,
+		uintptr(unsafe.Pointer(target)),
+		uintptr(unsafe.Pointer(&opts)),
+		uintptr(unsafe.Pointer(&info)),
+	)
+	if ret == 0 {
+		return "", fmt.Errorf("WinHttpGetProxyForUrl: %w", callErr)
+	}
+
+	var list string
+	if info.proxy != nil {
+		list = windows.UTF16PtrToString(info.proxy)
+		procGlobalFree.Call(uintptr(unsafe.Pointer(info.proxy)))
+	}
+	if info.proxyBypass != nil {
+		procGlobalFree.Call(uintptr(unsafe.Pointer(info.proxyBypass)))
+	}
+	return list, nil
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package setup
+
+import "os"
+
+func SecureDir(sub string) (string, error) {
+	dir := PersistentDir(sub)
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+func CheckTrusted(path string) error {
+	return nil
+}
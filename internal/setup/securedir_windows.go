@@ -0,0 +1,97 @@
+package setup
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// secureSDDL concede il controllo completo solo a SYSTEM e Administrators,
+// senza ereditare i permessi di ProgramData (dove gli utenti possono creare
+// cartelle e file).
+const secureSDDL = "O:BAD:P(A;OICI;FA;;;SY)(A;OICI;FA;;;BA)"
+
+// SecureDir restituisce PersistentDir(sub) dopo averla creata con permessi
+// riservati a SYSTEM e Administrators. La cartella e ProgramData\WebGain, se
+// gia' esistenti, devono appartenere a uno dei due: una cartella creata prima
+// da un utente non amministratore viene rifiutata, perche' il suo contenuto
+// viene eseguito o considerato attendibile dall'installer elevato. I permessi
+// di ProgramData\WebGain restano quelli ereditati, cosi' log e report restano
+// leggibili dalle modalita' senza privilegi (-support-bundle, -audit).
+func SecureDir(sub string) (string, error) {
+	dir := PersistentDir(sub)
+	sd, err := windows.SecurityDescriptorFromString(secureSDDL)
+	if err != nil {
+		return "", fmt.Errorf("descrittore di sicurezza non valido: %w", err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return "", fmt.Errorf("descrittore di sicurezza non valido: %w", err)
+	}
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("impossibile creare cartella %s: %w", parent, err)
+	}
+	if info, err := os.Lstat(parent); err != nil || info.Mode().Type() != fs.ModeDir {
+		return "", fmt.Errorf("%s non e' una cartella", parent)
+	}
+	if err := CheckTrusted(parent); err != nil {
+		return "", err
+	}
+	if err := secureDir(dir, sd, dacl); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func secureDir(dir string, sd *windows.SECURITY_DESCRIPTOR, dacl *windows.ACL) error {
+	info, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		p, err := windows.UTF16PtrFromString(dir)
+		if err != nil {
+			return err
+		}
+		sa := windows.SecurityAttributes{SecurityDescriptor: sd}
+		sa.Length = uint32(unsafe.Sizeof(sa))
+		if err := windows.CreateDirectory(p, &sa); err != nil && err != windows.ERROR_ALREADY_EXISTS {
+			return fmt.Errorf("impossibile creare cartella %s: %w", dir, err)
+		}
+		info, err = os.Lstat(dir)
+	}
+	if err != nil {
+		return fmt.Errorf("impossibile leggere cartella %s: %w", dir, err)
+	}
+	if info.Mode().Type() != fs.ModeDir {
+		return fmt.Errorf("%s non e' una cartella", dir)
+	}
+	if err := CheckTrusted(dir); err != nil {
+		return err
+	}
+	err = windows.SetNamedSecurityInfo(dir, windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, dacl, nil)
+	if err != nil {
+		return fmt.Errorf("impossibile impostare i permessi di %s: %w", dir, err)
+	}
+	return nil
+}
+
+// CheckTrusted verifica che path appartenga a SYSTEM o Administrators, cosi'
+// che un file piazzato da un utente non venga usato dall'installer elevato.
+func CheckTrusted(path string) error {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.OWNER_SECURITY_INFORMATION)
+	if err != nil {
+		return fmt.Errorf("impossibile leggere il proprietario di %s: %w", path, err)
+	}
+	owner, _, err := sd.Owner()
+	if err != nil || owner == nil {
+		return fmt.Errorf("impossibile leggere il proprietario di %s: %v", path, err)
+	}
+	if !owner.IsWellKnown(windows.WinLocalSystemSid) && !owner.IsWellKnown(windows.WinBuiltinAdministratorsSid) {
+		return fmt.Errorf("%s appartiene a %s e non a SYSTEM o Administrators, non attendibile", path, owner.String())
+	}
+	return nil
+}
@@ -12,26 +12,66 @@ import (
 	"time"
 
 	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/schema"
 
 	"github.com/google/uuid"
 )
 
 type onlineConfig struct {
-	GitHub    string `json:"github"`
-	Installer string `json:"installer"`
+	GitHub      string       `json:"github"`
+	Installer   string       `json:"installer"`
+	Proxy       *proxyConfig `json:"proxy,omitempty"`
+	CABundle    string       `json:"caBundle,omitempty"`
+	CacheMaxAge string       `json:"cacheMaxAge,omitempty"`
+	Logging     *struct {
+		Level string `json:"level,omitempty"`
+		JSON  bool   `json:"json,omitempty"`
+	} `json:"logging,omitempty"`
+	API       *APIConfig       `json:"api,omitempty"`
+	Collector *CollectorConfig `json:"collector,omitempty"`
 }
 
+// APIConfig configura il server HTTP locale di stato e controllo.
+type APIConfig struct {
+	Enabled bool   `json:"enabled"`
+	Bind    string `json:"bind,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+const defaultAPIBind = "127.0.0.1:8765"
+
+// CollectorConfig configura l'invio del report di installazione, e opzionalmente
+// degli eventi intermedi, a un collettore esterno.
+type CollectorConfig struct {
+	URL    string `json:"url"`
+	Token  string `json:"token,omitempty"`
+	Events bool   `json:"events,omitempty"`
+}
+
+const (
+	ModuleSourceEmbedded = "embedded"
+	ModuleSourceRepo     = "repo"
+)
+
 type moduleEntry struct {
 	Name   string `json:"name"`
 	Active *bool  `json:"active,omitempty"`
+	Source string `json:"source,omitempty"`
+	Path   string `json:"path,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 type setupConfig struct {
 	Modules []moduleEntry `json:"modules"`
 }
 
+// Module e' un modulo attivo di setup.json. Source indica se il modulo e' compilato
+// nell'eseguibile o va scaricato dal repo; Path e SHA256 valgono solo per "repo".
 type Module struct {
-	Name string
+	Name   string
+	Source string
+	Path   string
+	SHA256 string
 }
 
 func PrepareRoot() (string, error) {
@@ -44,62 +84,110 @@ func PrepareRoot() (string, error) {
 }
 
 // VerifyModules scarica o usa l'embedded setup.json.
-// Restituisce true se il file proviene da download online.
-func VerifyModules(configFS fs.FS, webgainRoot string) (bool, error) {
+// La catena di fallback e' online, ultima configurazione valida in cache, embedded;
+// restituisce il livello da cui proviene il file.
+func VerifyModules(configFS fs.FS, webgainRoot string) (Source, error) {
 	destPath := filepath.Join(webgainRoot, "setup.json")
 
 	downloadURL := buildInstallerURL(configFS)
+	var client *http.Client
 	if downloadURL != "" {
+		var err error
+		client, err = NewHTTPClient(configFS, 30*time.Second)
+		if err != nil {
+			logger.Warn("Configurazione client HTTP fallita: %v, download online saltato", err)
+		}
+	}
+	if downloadURL != "" && client != nil {
 		logger.Info("URL installer composto: %s", downloadURL)
 		logger.Info("Tentativo download setup.json online...")
-		if data, err := downloadWithRetry(downloadURL, 3, 30*time.Second); err == nil {
+		cached := loadCachedSetup(downloadURL)
+		var conditional *cacheMeta
+		if cached != nil {
+			conditional = &cached.meta
+		}
+		if res, err := downloadWithRetry(client, downloadURL, 3, conditional); err == nil {
+			data := res.data
+			meta := cacheMeta{URL: downloadURL, ETag: res.etag, LastModified: res.lastModified}
+			if res.notModified && cached != nil {
+				logger.Info("setup.json non modificato sul server (HTTP 304), uso copia in cache")
+				data = cached.data
+				meta.ETag, meta.LastModified = cached.meta.ETag, cached.meta.LastModified
+			}
 			if isValidJSON(data) {
 				logger.Info("Download riuscito, JSON valido (%d bytes), salvataggio in %s", len(data), destPath)
-				return true, os.WriteFile(destPath, data, 0644)
+				if err := writeCacheMeta(filepath.Join(webgainRoot, cacheMetaName), meta); err != nil {
+					logger.Warn("Scrittura metadati download fallita: %v", err)
+				}
+				return SourceOnline, os.WriteFile(destPath, data, 0644)
 			}
-			logger.Warn("Download riuscito ma JSON non valido (%d bytes), passaggio a fallback embedded", len(data))
+			logger.Warn("Download riuscito ma JSON non valido (%d bytes), passaggio a ultima configurazione valida", len(data))
 		} else {
-			logger.Warn("Download fallito: %v, passaggio a fallback embedded", err)
+			logger.Warn("Download fallito: %v, passaggio a ultima configurazione valida", err)
 		}
+
+		if data, ok := readLastKnownGood(configFS, downloadURL); ok {
+			logger.Info("Uso ultima configurazione valida in cache, salvataggio in %s", destPath)
+			return SourceCache, os.WriteFile(destPath, data, 0644)
+		}
+		logger.Warn("Ultima configurazione valida non disponibile, passaggio a fallback embedded")
 	} else {
-		logger.Warn("Impossibile comporre URL installer, passaggio diretto a fallback embedded")
+		logger.Warn("Download online non disponibile, passaggio diretto a fallback embedded")
 	}
 
 	logger.Info("Lettura setup.json embedded...")
 	embeddedData, err := fs.ReadFile(configFS, "setup.json")
 	if err != nil {
 		logger.Error("Lettura setup.json embedded fallita: %v", err)
-		return false, fmt.Errorf("setup.json non valido")
+		return SourceEmbedded, fmt.Errorf("setup.json non valido")
 	}
 
 	if isValidJSON(embeddedData) {
 		logger.Info("Setup.json embedded valido (%d bytes), salvataggio in %s", len(embeddedData), destPath)
-		return false, os.WriteFile(destPath, embeddedData, 0644)
+		return SourceEmbedded, os.WriteFile(destPath, embeddedData, 0644)
 	}
 
 	logger.Error("Setup.json embedded non e' un JSON valido (%d bytes)", len(embeddedData))
-	return false, fmt.Errorf("setup.json non valido")
+	return SourceEmbedded, fmt.Errorf("setup.json non valido")
 }
 
 // InitModules valida il setup.json in WEBGAINROOT.
-// Se webgainOnline è true e la validazione fallisce, ritenta con l'embedded.
-func InitModules(configFS fs.FS, webgainRoot string, webgainOnline bool) ([]Module, error) {
+// Se la validazione fallisce ritenta con i livelli successivi della catena:
+// da online passa alla cache, da online o cache passa all'embedded.
+func InitModules(configFS fs.FS, webgainRoot string, source Source) ([]Module, error) {
 	destPath := filepath.Join(webgainRoot, "setup.json")
-	logger.Info("Inizializzazione moduli da %s (online=%v)", destPath, webgainOnline)
+	logger.Info("Inizializzazione moduli da %s (origine=%s)", destPath, source)
 
 	modules, err := parseAndValidateSetup(destPath)
 	if err == nil {
 		logger.Info("Validazione setup.json riuscita: %d moduli attivi", len(modules))
+		if source == SourceOnline {
+			storeLastKnownGood(webgainRoot)
+		}
 		return modules, nil
 	}
 	logger.Warn("Validazione setup.json fallita: %v", err)
 
-	if !webgainOnline {
+	if source == SourceEmbedded {
 		logger.Error("File proveniente da embedded, nessun fallback disponibile")
 		return nil, err
 	}
 
-	logger.Info("File proveniente da online, tentativo fallback con embedded...")
+	if source == SourceOnline {
+		logger.Info("File proveniente da online, tentativo fallback con ultima configurazione valida...")
+		if meta, metaErr := readCacheMeta(filepath.Join(webgainRoot, cacheMetaName)); metaErr == nil {
+			if cachedData, ok := readLastKnownGood(configFS, meta.URL); ok {
+				modules, err := replaceAndValidate(destPath, cachedData)
+				if err == nil {
+					logger.Info("Fallback cache valido: %d moduli attivi", len(modules))
+					return modules, nil
+				}
+				logger.Warn("Validazione fallback cache fallita: %v", err)
+			}
+		}
+	}
+
+	logger.Info("Tentativo fallback con embedded...")
 	embeddedData, readErr := fs.ReadFile(configFS, "setup.json")
 	if readErr != nil {
 		logger.Error("Lettura setup.json embedded fallita: %v", readErr)
@@ -112,12 +200,7 @@ func InitModules(configFS fs.FS, webgainRoot string, webgainOnline bool) ([]Modu
 	}
 
 	logger.Info("Setup.json embedded JSON valido, sostituzione in WEBGAINROOT...")
-	if writeErr := os.WriteFile(destPath, embeddedData, 0644); writeErr != nil {
-		logger.Error("Scrittura fallback embedded fallita: %v", writeErr)
-		return nil, fmt.Errorf("impossibile scrivere fallback: %w", writeErr)
-	}
-
-	modules, err = parseAndValidateSetup(destPath)
+	modules, err = replaceAndValidate(destPath, embeddedData)
 	if err != nil {
 		logger.Error("Validazione fallback embedded fallita: %v", err)
 		return nil, err
@@ -127,6 +210,14 @@ func InitModules(configFS fs.FS, webgainRoot string, webgainOnline bool) ([]Modu
 	return modules, nil
 }
 
+func replaceAndValidate(destPath string, data []byte) ([]Module, error) {
+	if err := os.WriteFile(destPath, data, 0644); err != nil {
+		logger.Error("Scrittura fallback fallita: %v", err)
+		return nil, fmt.Errorf("impossibile scrivere fallback: %w", err)
+	}
+	return parseAndValidateSetup(destPath)
+}
+
 func parseAndValidateSetup(path string) ([]Module, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -135,6 +226,15 @@ func parseAndValidateSetup(path string) ([]Module, error) {
 
 	logger.Info("Parsing setup.json (%d bytes)...", len(data))
 
+	if err := schema.Validate(schema.Setup, data); err != nil {
+		if errs, ok := err.(schema.Errors); ok {
+			for _, e := range errs {
+				logger.Error("setup.json non conforme allo schema: %v", e)
+			}
+		}
+		return nil, fmt.Errorf("setup.json non conforme allo schema: %w", err)
+	}
+
 	var cfg setupConfig
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("JSON non valido: %w", err)
@@ -173,8 +273,17 @@ func parseAndValidateSetup(path string) ([]Module, error) {
 		}
 		seen[name] = true
 
-		active = append(active, Module{Name: name})
-		logger.Info("Modulo [%d] '%s': attivo", i, name)
+		source := entry.Source
+		if source == "" {
+			source = ModuleSourceEmbedded
+		}
+		if source != ModuleSourceEmbedded && source != ModuleSourceRepo {
+			logger.Error("Modulo [%d] '%s': source sconosciuta '%s'", i, name, source)
+			return nil, fmt.Errorf("modulo '%s': source sconosciuta '%s'", name, source)
+		}
+
+		active = append(active, Module{Name: name, Source: source, Path: entry.Path, SHA256: entry.SHA256})
+		logger.Info("Modulo [%d] '%s': attivo (source=%s)", i, name, source)
 	}
 
 	if len(active) == 0 {
@@ -186,16 +295,75 @@ func parseAndValidateSetup(path string) ([]Module, error) {
 	return active, nil
 }
 
-func buildInstallerURL(configFS fs.FS) string {
+func loadOnlineConfig(configFS fs.FS) (*onlineConfig, error) {
 	data, err := fs.ReadFile(configFS, "online.json")
 	if err != nil {
-		logger.Warn("Impossibile leggere online.json: %v", err)
-		return ""
+		return nil, fmt.Errorf("impossibile leggere online.json: %w", err)
 	}
 
 	var cfg onlineConfig
 	if err := json.Unmarshal(data, &cfg); err != nil {
-		logger.Warn("online.json non e' un JSON valido: %v", err)
+		return nil, fmt.Errorf("online.json non e' un JSON valido: %w", err)
+	}
+	return &cfg, nil
+}
+
+// LoggingOptions legge la sezione logging di online.json.
+// WEBGAIN_LOG_LEVEL e WEBGAIN_LOG_JSON hanno la precedenza.
+func LoggingOptions(configFS fs.FS) logger.Options {
+	opts := logger.Options{MinLevel: logger.INFO}
+	if cfg, err := loadOnlineConfig(configFS); err == nil && cfg.Logging != nil {
+		if level, err := logger.ParseLevel(cfg.Logging.Level); err == nil {
+			opts.MinLevel = level
+		}
+		opts.JSON = cfg.Logging.JSON
+	}
+	if env := os.Getenv("WEBGAIN_LOG_LEVEL"); env != "" {
+		if level, err := logger.ParseLevel(env); err == nil {
+			opts.MinLevel = level
+		}
+	}
+	if env := os.Getenv("WEBGAIN_LOG_JSON"); env != "" {
+		opts.JSON = env == "1" || strings.EqualFold(env, "true")
+	}
+	return opts
+}
+
+// LoadAPIConfig legge la sezione api di online.json. WEBGAIN_API_TOKEN
+// ha la precedenza sul token configurato.
+func LoadAPIConfig(configFS fs.FS) APIConfig {
+	var cfg APIConfig
+	if online, err := loadOnlineConfig(configFS); err == nil && online.API != nil {
+		cfg = *online.API
+	}
+	if env := os.Getenv("WEBGAIN_API_TOKEN"); env != "" {
+		cfg.Token = env
+	}
+	if cfg.Bind == "" {
+		cfg.Bind = defaultAPIBind
+	}
+	logger.AddSecret(cfg.Token)
+	return cfg
+}
+
+// LoadCollectorConfig legge la sezione collector di online.json. Senza url
+// l'invio e' disattivato. WEBGAIN_COLLECTOR_TOKEN ha la precedenza sul token.
+func LoadCollectorConfig(configFS fs.FS) CollectorConfig {
+	var cfg CollectorConfig
+	if online, err := loadOnlineConfig(configFS); err == nil && online.Collector != nil {
+		cfg = *online.Collector
+	}
+	if env := os.Getenv("WEBGAIN_COLLECTOR_TOKEN"); env != "" {
+		cfg.Token = env
+	}
+	logger.AddSecret(cfg.Token)
+	return cfg
+}
+
+func buildInstallerURL(configFS fs.FS) string {
+	cfg, err := loadOnlineConfig(configFS)
+	if err != nil {
+		logger.Warn("%v", err)
 		return ""
 	}
 
@@ -243,8 +411,16 @@ func ToRawURL(url string) string {
 	return url
 }
 
-func downloadWithRetry(url string, maxRetries int, timeout time.Duration) ([]byte, error) {
-	client := &http.Client{Timeout: timeout}
+type downloadResult struct {
+	data         []byte
+	notModified  bool
+	etag         string
+	lastModified string
+}
+
+// downloadWithRetry esegue il GET con retry. Se cached e' valorizzato la richiesta
+// e' condizionale (If-None-Match / If-Modified-Since) e un 304 e' considerato riuscito.
+func downloadWithRetry(client *http.Client, url string, maxRetries int, cached *cacheMeta) (*downloadResult, error) {
 	var lastErr error
 
 	for i := 0; i < maxRetries; i++ {
@@ -255,8 +431,19 @@ func downloadWithRetry(url string, maxRetries int, timeout time.Duration) ([]byt
 			logger.Warn("Tentativo %d/%d fallito (creazione request): %v", i+1, maxRetries, reqErr)
 			continue
 		}
-		req.Header.Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		req.Header.Set("Pragma", "no-cache")
+		// Con una richiesta condizionale il server deve poter rispondere 304:
+		// no-cache serve solo senza validatori.
+		if cached == nil || (cached.ETag == "" && cached.LastModified == "") {
+			req.Header.Set("Cache-Control", "no-cache")
+		}
+		if cached != nil {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
 		resp, err := client.Do(req)
 		if err != nil {
 			lastErr = err
@@ -270,9 +457,17 @@ func downloadWithRetry(url string, maxRetries int, timeout time.Duration) ([]byt
 			logger.Warn("Tentativo %d/%d fallito (lettura body): %v", i+1, maxRetries, err)
 			continue
 		}
+		if resp.StatusCode == http.StatusNotModified && cached != nil {
+			logger.Info("Tentativo %d/%d riuscito: HTTP 304, contenuto invariato", i+1, maxRetries)
+			return &downloadResult{notModified: true}, nil
+		}
 		if resp.StatusCode == http.StatusOK {
 			logger.Info("Tentativo %d/%d riuscito: HTTP %d, %d bytes ricevuti", i+1, maxRetries, resp.StatusCode, len(body))
-			return body, nil
+			return &downloadResult{
+				data:         body,
+				etag:         resp.Header.Get("ETag"),
+				lastModified: resp.Header.Get("Last-Modified"),
+			}, nil
 		}
 		lastErr = fmt.Errorf("HTTP %d", resp.StatusCode)
 		logger.Warn("Tentativo %d/%d fallito: HTTP %d", i+1, maxRetries, resp.StatusCode)
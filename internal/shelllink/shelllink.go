@@ -0,0 +1,258 @@
+// Package shelllink scrive collegamenti .lnk di Windows nel formato Shell
+// Link binario ([MS-SHLLINK]) senza usare WScript o COM, cosi' il risultato
+// e' deterministico e verificabile anche fuori da Windows.
+package shelllink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// Modalita' della finestra all'avvio (ShowCommand).
+const (
+	ShowNormal    = 1
+	ShowMaximized = 3
+	ShowMinimized = 7
+)
+
+// Link descrive un collegamento a un file o a una cartella locale.
+type Link struct {
+	// Target e' il percorso assoluto su unita' locale (C:\...), gia' espanso.
+	Target      string
+	TargetIsDir bool
+	Arguments   string
+	WorkingDir  string
+	Description string
+	// IconLocation e IconIndex indicano l'icona; vuota usa quella del target.
+	IconLocation string
+	IconIndex    int32
+	ShowCommand  uint32
+	// RunAsAdmin corrisponde a "Esegui come amministratore" nelle proprieta'.
+	RunAsAdmin bool
+}
+
+// Flag di LinkFlags.
+const (
+	hasLinkTargetIDList = 0x00000001
+	hasLinkInfo         = 0x00000002
+	hasName             = 0x00000004
+	hasWorkingDir       = 0x00000010
+	hasArguments        = 0x00000020
+	hasIconLocation     = 0x00000040
+	isUnicode           = 0x00000080
+	runAsUser           = 0x00002000
+)
+
+const (
+	fileAttributeDirectory = 0x10
+	fileAttributeArchive   = 0x20
+	driveFixed             = 3
+	// maxStringChars e' il limite di CountCharacters nelle stringhe di StringData.
+	maxStringChars = 0xFFFF
+)
+
+var (
+	linkCLSID       = []byte{0x01, 0x14, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
+	myComputerCLSID = []byte{0xE0, 0x4F, 0xD0, 0x20, 0xEA, 0x3A, 0x69, 0x10, 0xA2, 0xD8, 0x08, 0x00, 0x2B, 0x30, 0x30, 0x9D}
+	localPath       = regexp.MustCompile(`^[A-Za-z]:\\`)
+)
+
+// Validate controlla che il collegamento sia rappresentabile.
+func (l Link) Validate() error {
+	if !localPath.MatchString(l.Target) {
+		return fmt.Errorf("target deve essere un percorso assoluto su unita' locale: %q", l.Target)
+	}
+	for _, part := range strings.Split(strings.TrimRight(l.Target[3:], `\`), `\`) {
+		if l.Target[3:] != "" && part == "" {
+			return fmt.Errorf("target non valido: %q", l.Target)
+		}
+	}
+	for _, s := range []string{l.Arguments, l.WorkingDir, l.Description, l.IconLocation} {
+		if len(utf16.Encode([]rune(s))) > maxStringChars {
+			return fmt.Errorf("stringa troppo lunga per un collegamento")
+		}
+	}
+	switch l.ShowCommand {
+	case 0, ShowNormal, ShowMaximized, ShowMinimized:
+	default:
+		return fmt.Errorf("ShowCommand non valido: %d", l.ShowCommand)
+	}
+	return nil
+}
+
+// MarshalBinary restituisce il contenuto del file .lnk: intestazione,
+// IDList del target (Computer, unita', una voce per componente del percorso),
+// LinkInfo con il percorso locale in ANSI e Unicode, stringhe Unicode e
+// blocco terminale di ExtraData.
+func (l Link) MarshalBinary() ([]byte, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	flags := uint32(hasLinkTargetIDList | hasLinkInfo | isUnicode)
+	strs := []struct {
+		flag  uint32
+		value string
+	}{
+		{hasName, l.Description},
+		{hasWorkingDir, l.WorkingDir},
+		{hasArguments, l.Arguments},
+		{hasIconLocation, l.IconLocation},
+	}
+	for _, s := range strs {
+		if s.value != "" {
+			flags |= s.flag
+		}
+	}
+	if l.RunAsAdmin {
+		flags |= runAsUser
+	}
+	attributes := uint32(fileAttributeArchive)
+	if l.TargetIsDir {
+		attributes = fileAttributeDirectory
+	}
+	show := l.ShowCommand
+	if show == 0 {
+		show = ShowNormal
+	}
+
+	var b bytes.Buffer
+	le := func(v any) { binary.Write(&b, binary.LittleEndian, v) }
+	le(uint32(0x4C))
+	b.Write(linkCLSID)
+	le(flags)
+	le(attributes)
+	b.Write(make([]byte, 24)) // CreationTime, AccessTime, WriteTime
+	le(uint32(0))             // FileSize
+	le(l.IconIndex)
+	le(show)
+	le(uint16(0)) // HotKey
+	b.Write(make([]byte, 10))
+
+	b.Write(l.idList())
+	b.Write(l.linkInfo())
+	for _, s := range strs {
+		if s.value != "" {
+			units := utf16.Encode([]rune(s.value))
+			le(uint16(len(units)))
+			le(units)
+		}
+	}
+	le(uint32(0)) // TerminalBlock
+	return b.Bytes(), nil
+}
+
+// idList costruisce LinkTargetIDList come lo salva Explorer per un percorso
+// locale: voce Computer, voce unita' e una voce file o cartella per componente.
+func (l Link) idList() []byte {
+	var items bytes.Buffer
+	item := func(data []byte) {
+		binary.Write(&items, binary.LittleEndian, uint16(len(data)+2))
+		items.Write(data)
+	}
+	item(append([]byte{0x1F, 0x50}, myComputerCLSID...))
+	drive := append([]byte{0x2F}, strings.ToUpper(l.Target[:3])...)
+	item(append(drive, make([]byte, 19)...))
+
+	rest := strings.TrimRight(l.Target[3:], `\`)
+	if rest != "" {
+		parts := strings.Split(rest, `\`)
+		for i, part := range parts {
+			isDir := i < len(parts)-1 || l.TargetIsDir
+			item(fileEntry(part, isDir))
+		}
+	}
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint16(items.Len()+2))
+	b.Write(items.Bytes())
+	b.Write([]byte{0, 0}) // TerminalID
+	return b.Bytes()
+}
+
+// fileEntry e' la voce di un file o cartella: tipo (0x31 cartella, 0x32
+// file; con 0x04 il nome e' Unicode), dimensione, data e attributi a zero
+// ed il nome terminato da zero, allineato a 2 byte.
+func fileEntry(name string, isDir bool) []byte {
+	kind := byte(0x32)
+	attr := uint16(fileAttributeArchive)
+	if isDir {
+		kind, attr = 0x31, fileAttributeDirectory
+	}
+	var nameBytes []byte
+	if isASCII(name) {
+		nameBytes = append([]byte(name), 0)
+	} else {
+		kind |= 0x04
+		nameBytes = utf16z(name)
+	}
+	data := []byte{kind, 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(attr), byte(attr >> 8)}
+	data = append(data, nameBytes...)
+	if len(data)%2 != 0 {
+		data = append(data, 0)
+	}
+	return data
+}
+
+// linkInfo costruisce la struttura LinkInfo con VolumeID di un'unita' fissa e
+// LocalBasePath; l'intestazione di 0x24 byte include le versioni Unicode.
+func (l Link) linkInfo() []byte {
+	const headerSize = 0x24
+	volumeID := []byte{0x11, 0, 0, 0, driveFixed, 0, 0, 0, 0, 0, 0, 0, 0x10, 0, 0, 0, 0}
+	base := append(ansi(l.Target), 0)
+	suffix := []byte{0}
+	baseUnicode := utf16z(l.Target)
+	suffixUnicode := []byte{0, 0}
+
+	volumeOffset := uint32(headerSize)
+	baseOffset := volumeOffset + uint32(len(volumeID))
+	suffixOffset := baseOffset + uint32(len(base))
+	baseUnicodeOffset := suffixOffset + uint32(len(suffix))
+	suffixUnicodeOffset := baseUnicodeOffset + uint32(len(baseUnicode))
+	size := suffixUnicodeOffset + uint32(len(suffixUnicode))
+
+	var b bytes.Buffer
+	for _, v := range []uint32{size, headerSize, 0x1, volumeOffset, baseOffset, 0, suffixOffset, baseUnicodeOffset, suffixUnicodeOffset} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.Write(volumeID)
+	b.Write(base)
+	b.Write(suffix)
+	b.Write(baseUnicode)
+	b.Write(suffixUnicode)
+	return b.Bytes()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// ansi sostituisce con ? i caratteri non ASCII: la versione Unicode del
+// percorso ha la precedenza quando presente.
+func ansi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r >= 0x80 {
+			r = '?'
+		}
+		out = append(out, byte(r))
+	}
+	return out
+}
+
+func utf16z(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 0, 2*len(units)+2)
+	for _, u := range units {
+		out = append(out, byte(u), byte(u>>8))
+	}
+	return append(out, 0, 0)
+}
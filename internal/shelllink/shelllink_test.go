@@ -0,0 +1,235 @@
+package shelllink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// parsed e' il contenuto di un .lnk letto secondo [MS-SHLLINK].
+type parsed struct {
+	flags, attributes, show uint32
+	iconIndex               int32
+	items                   [][]byte
+	localBasePath           string
+	localBasePathUnicode    string
+	strings                 []string
+}
+
+// parse legge data verificando dimensioni e offset di ogni struttura.
+func parse(t *testing.T, data []byte) parsed {
+	t.Helper()
+	var p parsed
+	u16 := func(off int) int { return int(binary.LittleEndian.Uint16(data[off:])) }
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(data[off:]) }
+
+	if len(data) < 0x4C {
+		t.Fatalf("file di %d byte, intestazione incompleta", len(data))
+	}
+	if u32(0) != 0x4C {
+		t.Fatalf("HeaderSize = %#x, atteso 0x4C", u32(0))
+	}
+	if !bytes.Equal(data[4:20], linkCLSID) {
+		t.Fatalf("LinkCLSID = % x", data[4:20])
+	}
+	p.flags, p.attributes = u32(20), u32(24)
+	p.iconIndex, p.show = int32(u32(56)), u32(60)
+	off := 0x4C
+
+	if p.flags&hasLinkTargetIDList != 0 {
+		size := u16(off)
+		end := off + 2 + size
+		off += 2
+		for {
+			itemSize := u16(off)
+			if itemSize == 0 {
+				off += 2
+				break
+			}
+			if off+itemSize > end {
+				t.Fatalf("voce IDList di %d byte oltre la fine della lista", itemSize)
+			}
+			p.items = append(p.items, data[off+2:off+itemSize])
+			off += itemSize
+		}
+		if off != end {
+			t.Fatalf("IDListSize %d non corrisponde alle voci", size)
+		}
+	}
+
+	if p.flags&hasLinkInfo != 0 {
+		start := off
+		size, headerSize := int(u32(start)), u32(start+4)
+		if headerSize != 0x24 {
+			t.Fatalf("LinkInfoHeaderSize = %#x, atteso 0x24", headerSize)
+		}
+		if u32(start+8) != 0x1 {
+			t.Fatalf("LinkInfoFlags = %#x, atteso VolumeIDAndLocalBasePath", u32(start+8))
+		}
+		volume := start + int(u32(start+12))
+		if u32(volume) != 0x11 || u32(volume+4) != driveFixed {
+			t.Fatalf("VolumeID non valido: % x", data[volume:volume+17])
+		}
+		if u32(start+20) != 0 {
+			t.Fatalf("CommonNetworkRelativeLinkOffset = %d, atteso 0", u32(start+20))
+		}
+		p.localBasePath = cString(data[start+int(u32(start+16)):])
+		if suffix := cString(data[start+int(u32(start+24)):]); suffix != "" {
+			t.Fatalf("CommonPathSuffix = %q, atteso vuoto", suffix)
+		}
+		p.localBasePathUnicode = utf16String(data[start+int(u32(start+28)):])
+		if suffix := utf16String(data[start+int(u32(start+32)):]); suffix != "" {
+			t.Fatalf("CommonPathSuffixUnicode = %q, atteso vuoto", suffix)
+		}
+		if end := start + int(u32(start+32)) + 2; end != start+size {
+			t.Fatalf("LinkInfoSize %d, la struttura termina a %d", size, end-start)
+		}
+		off = start + size
+	}
+
+	for _, flag := range []uint32{hasName, hasWorkingDir, hasArguments, hasIconLocation} {
+		if p.flags&flag == 0 {
+			continue
+		}
+		n := u16(off)
+		units := make([]uint16, n)
+		for i := range units {
+			units[i] = uint16(u16(off + 2 + 2*i))
+		}
+		p.strings = append(p.strings, string(utf16.Decode(units)))
+		off += 2 + 2*n
+	}
+
+	if len(data)-off != 4 || u32(off) != 0 {
+		t.Fatalf("ExtraData: attesi 4 byte a zero dopo StringData, restano % x", data[off:])
+	}
+	return p
+}
+
+func cString(b []byte) string {
+	return string(b[:bytes.IndexByte(b, 0)])
+}
+
+func utf16String(b []byte) string {
+	var units []uint16
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+func TestMarshalBinary(t *testing.T) {
+	link := Link{
+		Target:       `C:\Program Files\Tool\tool.exe`,
+		Arguments:    `--config "C:\ProgramData\Tool\tool.ini"`,
+		WorkingDir:   `C:\Program Files\Tool`,
+		Description:  "Strumento",
+		IconLocation: `C:\Program Files\Tool\tool.ico`,
+		IconIndex:    2,
+		ShowCommand:  ShowMaximized,
+		RunAsAdmin:   true,
+	}
+	data, err := link.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parse(t, data)
+
+	want := uint32(hasLinkTargetIDList | hasLinkInfo | isUnicode | hasName | hasWorkingDir | hasArguments | hasIconLocation | runAsUser)
+	if p.flags != want {
+		t.Errorf("LinkFlags = %#x, atteso %#x", p.flags, want)
+	}
+	if p.flags&0x2000 == 0 {
+		t.Errorf("RunAsUser (0x2000) non impostato")
+	}
+	if p.attributes != fileAttributeArchive || p.iconIndex != 2 || p.show != ShowMaximized {
+		t.Errorf("attributi %#x, icona %d, finestra %d", p.attributes, p.iconIndex, p.show)
+	}
+
+	// Computer, unita' e una voce per Program Files, Tool e tool.exe
+	if len(p.items) != 5 {
+		t.Fatalf("%d voci IDList, attese 5", len(p.items))
+	}
+	if p.items[0][0] != 0x1F || !bytes.Equal(p.items[0][2:], myComputerCLSID) {
+		t.Errorf("voce Computer non valida: % x", p.items[0])
+	}
+	if p.items[1][0] != 0x2F || cString(p.items[1][1:]) != `C:\` || len(p.items[1]) != 23 {
+		t.Errorf("voce unita' non valida: % x", p.items[1])
+	}
+	for i, name := range []string{"Program Files", "Tool", "tool.exe"} {
+		item := p.items[i+2]
+		kind := byte(0x31)
+		if i == 2 {
+			kind = 0x32
+		}
+		if item[0] != kind || cString(item[12:]) != name {
+			t.Errorf("voce %d: tipo %#x nome %q, attesi %#x %q", i+2, item[0], cString(item[12:]), kind, name)
+		}
+		if len(item)%2 != 0 {
+			t.Errorf("voce %d di %d byte, non allineata a 2", i+2, len(item))
+		}
+	}
+
+	if p.localBasePath != link.Target || p.localBasePathUnicode != link.Target {
+		t.Errorf("LocalBasePath = %q / %q", p.localBasePath, p.localBasePathUnicode)
+	}
+	wantStrings := []string{link.Description, link.WorkingDir, link.Arguments, link.IconLocation}
+	if strings.Join(p.strings, "|") != strings.Join(wantStrings, "|") {
+		t.Errorf("StringData = %q, atteso %q", p.strings, wantStrings)
+	}
+}
+
+func TestMarshalBinaryMinimal(t *testing.T) {
+	data, err := Link{Target: `D:\Dati`, TargetIsDir: true}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parse(t, data)
+	if p.flags != hasLinkTargetIDList|hasLinkInfo|isUnicode {
+		t.Errorf("LinkFlags = %#x, attesi solo IDList, LinkInfo e Unicode", p.flags)
+	}
+	if p.attributes != fileAttributeDirectory || p.show != ShowNormal || len(p.strings) != 0 {
+		t.Errorf("attributi %#x, finestra %d, stringhe %q", p.attributes, p.show, p.strings)
+	}
+	if len(p.items) != 3 || p.items[2][0] != 0x31 {
+		t.Errorf("voci IDList: % x", p.items)
+	}
+}
+
+func TestMarshalBinaryUnicode(t *testing.T) {
+	data, err := Link{Target: `C:\Utenti\Città\è.exe`}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parse(t, data)
+	if p.localBasePath != `C:\Utenti\Citt?\?.exe` {
+		t.Errorf("LocalBasePath ANSI = %q", p.localBasePath)
+	}
+	if p.localBasePathUnicode != `C:\Utenti\Città\è.exe` {
+		t.Errorf("LocalBasePathUnicode = %q", p.localBasePathUnicode)
+	}
+	item := p.items[len(p.items)-1]
+	if item[0] != 0x32|0x04 || utf16String(item[12:]) != "è.exe" {
+		t.Errorf("voce Unicode: tipo %#x nome %q", item[0], utf16String(item[12:]))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, l := range []Link{
+		{Target: `relativo\tool.exe`},
+		{Target: `\\server\share\tool.exe`},
+		{Target: `C:\Tool\\tool.exe`},
+		{Target: `C:\tool.exe`, ShowCommand: 2},
+		{Target: `C:\tool.exe`, Arguments: strings.Repeat("a", maxStringChars+1)},
+	} {
+		if err := l.Validate(); err == nil {
+			t.Errorf("Validate(%+.60v) senza errore", l)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package support
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"WebGainInstaller/internal/admin"
+	"WebGainInstaller/internal/logger"
+	"WebGainInstaller/internal/module"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// maxLogFiles limita i file di log inclusi, dal piu' recente.
+const maxLogFiles = 30
+
+// maxReportFiles limita i report inclusi (JSON e HTML), dal piu' recente.
+const maxReportFiles = 20
+
+// Info descrive lo stato dell'esecuzione da includere nel pacchetto di supporto.
+// WebgainRoot e Modules possono essere vuoti, ad esempio da riga di comando.
+type Info struct {
+	WebgainRoot string
+	Source      string
+	Modules     []module.ModuleStatus
+	LogDir      string
+	CacheDir    string
+	ReportDir   string
+}
+
+// installedEntry e' una voce di App installate registrata per un modulo.
+type installedEntry struct {
+	Key    string                 `json:"key"`
+	Values map[string]interface{} `json:"values"`
+}
+
+type systemInfo struct {
+	CreatedAt   time.Time `json:"createdAt"`
+	RunID       string    `json:"runId,omitempty"`
+	Source      string    `json:"setupSource,omitempty"`
+	OS          string    `json:"os"`
+	OSBuild     string    `json:"osBuild"`
+	Arch        string    `json:"arch"`
+	Elevated    bool      `json:"elevated"`
+	ElevatedErr string    `json:"elevatedError,omitempty"`
+	Path        []string  `json:"path"`
+	MachinePath []string  `json:"machinePath,omitempty"`
+	UserPath    []string  `json:"userPath,omitempty"`
+	CurrentLog  string    `json:"currentLog,omitempty"`
+}
+
+// CreateBundle scrive in destPath uno zip con log recenti, setup.json risolto,
+// stato dei moduli, report delle ultime esecuzioni, voci di App installate
+// dei moduli e informazioni di sistema. Tutti i contenuti testuali
+// passano da logger.Redact.
+func CreateBundle(destPath string, info Info) error {
+	f, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("impossibile creare %s: %w", destPath, err)
+	}
+	zw := zip.NewWriter(f)
+
+	err = writeBundle(zw, info)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(destPath)
+		return fmt.Errorf("creazione pacchetto di supporto fallita: %w", err)
+	}
+	return nil
+}
+
+func writeBundle(zw *zip.Writer, info Info) error {
+	if err := addJSON(zw, "system.json", collectSystemInfo(info)); err != nil {
+		return err
+	}
+	if err := addJSON(zw, "modules.json", info.Modules); err != nil {
+		return err
+	}
+	if err := addJSON(zw, "installed.json", installedEntries()); err != nil {
+		return err
+	}
+
+	if info.WebgainRoot != "" {
+		for _, name := range []string{"setup.json", "setup.meta.json", filepath.Join("modules", "order.json")} {
+			if err := addFile(zw, filepath.Join("webgainroot", filepath.ToSlash(name)), filepath.Join(info.WebgainRoot, name)); err != nil {
+				return err
+			}
+		}
+	}
+	if info.CacheDir != "" {
+		if err := addDir(zw, "cache", info.CacheDir, 0); err != nil {
+			return err
+		}
+	}
+	if info.ReportDir != "" {
+		if err := addDir(zw, "reports", info.ReportDir, maxReportFiles); err != nil {
+			return err
+		}
+	}
+	if info.LogDir != "" {
+		if err := addDir(zw, "logs", info.LogDir, maxLogFiles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installedEntries legge le voci WebGain.* di App installate, cioe' i moduli
+// installati e registrati per la disinstallazione.
+func installedEntries() []installedEntry {
+	i := strings.LastIndex(module.UninstallKeyPrefix, `\`)
+	parent, name := module.UninstallKeyPrefix[:i], module.UninstallKeyPrefix[i+1:]
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, parent, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil
+	}
+	defer key.Close()
+	subkeys, err := key.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil
+	}
+	sort.Strings(subkeys)
+
+	entries := []installedEntry{}
+	for _, sub := range subkeys {
+		if !strings.HasPrefix(sub, name) {
+			continue
+		}
+		entry := installedEntry{Key: sub, Values: make(map[string]interface{})}
+		if k, err := registry.OpenKey(key, sub, registry.QUERY_VALUE); err == nil {
+			names, _ := k.ReadValueNames(-1)
+			for _, n := range names {
+				if v, _, err := k.GetStringValue(n); err == nil {
+					entry.Values[n] = v
+				} else if v, _, err := k.GetIntegerValue(n); err == nil {
+					entry.Values[n] = v
+				}
+			}
+			k.Close()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func collectSystemInfo(info Info) systemInfo {
+	sys := systemInfo{
+		CreatedAt:  time.Now().UTC(),
+		RunID:      logger.RunID(),
+		Source:     info.Source,
+		Arch:       runtime.GOARCH,
+		Path:       splitPath(os.Getenv("PATH")),
+		CurrentLog: logger.Path(),
+	}
+
+	v := windows.RtlGetVersion()
+	sys.OSBuild = fmt.Sprintf("%d.%d.%d", v.MajorVersion, v.MinorVersion, v.BuildNumber)
+	sys.OS = "Windows"
+	if key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, registry.QUERY_VALUE); err == nil {
+		if name, _, err := key.GetStringValue("ProductName"); err == nil {
+			sys.OS = name
+		}
+		if display, _, err := key.GetStringValue("DisplayVersion"); err == nil {
+			sys.OS += " " + display
+		}
+		key.Close()
+	}
+
+	elevated, err := admin.IsElevated()
+	sys.Elevated = elevated
+	if err != nil {
+		sys.ElevatedErr = err.Error()
+	}
+
+	sys.MachinePath = readRegistryPath(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`)
+	sys.UserPath = readRegistryPath(registry.CURRENT_USER, `Environment`)
+	return sys
+}
+
+func readRegistryPath(root registry.Key, path string) []string {
+	key, err := registry.OpenKey(root, path, registry.QUERY_VALUE)
+	if err != nil {
+		return nil
+	}
+	defer key.Close()
+	value, _, err := key.GetStringValue("Path")
+	if err != nil {
+		return nil
+	}
+	return splitPath(value)
+}
+
+func splitPath(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ";") {
+		if entry != "" {
+			entries = append(entries, logger.Redact(entry))
+		}
+	}
+	return entries
+}
+
+func addJSON(zw *zip.Writer, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return addContent(zw, name, data)
+}
+
+// addFile aggiunge srcPath se esiste; i file assenti vengono ignorati.
+func addFile(zw *zip.Writer, name, srcPath string) error {
+	data, err := os.ReadFile(srcPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("impossibile leggere %s: %w", srcPath, err)
+	}
+	return addContent(zw, name, data)
+}
+
+// addDir aggiunge i file di primo livello di dir, al massimo limit
+// (i piu' recenti per nome, che per i log inizia con il timestamp); 0 = tutti.
+func addDir(zw *zip.Writer, prefix, dir string, limit int) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("impossibile leggere %s: %w", dir, err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	if limit > 0 && len(names) > limit {
+		names = names[:limit]
+	}
+	for _, name := range names {
+		if err := addFile(zw, prefix+"/"+name, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addContent(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(logger.Redact(string(data))))
+	return err
+}
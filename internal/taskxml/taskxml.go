@@ -0,0 +1,464 @@
+// Package taskxml genera la definizione XML di un'attivita' dell'Utilita'
+// di pianificazione di Windows (schema Task 1.2) da una descrizione
+// dichiarativa. Non dipende da Windows: l'output e' deterministico e puo'
+// essere confrontato con file di riferimento.
+package taskxml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Tipi di trigger.
+const (
+	TriggerDaily  = "daily"
+	TriggerWeekly = "weekly"
+	TriggerOnce   = "once"
+	TriggerLogon  = "logon"
+	TriggerBoot   = "boot"
+	TriggerIdle   = "idle"
+)
+
+// Task descrive l'attivita': cosa eseguire, quando e con quale account.
+type Task struct {
+	Description      string     `json:"description,omitempty"`
+	Author           string     `json:"author,omitempty"`
+	Command          string     `json:"command"`
+	Arguments        string     `json:"arguments,omitempty"`
+	WorkingDirectory string     `json:"workingDirectory,omitempty"`
+	Triggers         []Trigger  `json:"triggers,omitempty"`
+	Principal        Principal  `json:"principal,omitempty"`
+	Conditions       Conditions `json:"conditions,omitempty"`
+	Settings         Settings   `json:"settings,omitempty"`
+}
+
+// Trigger avvia l'attivita'. At e' l'ora (HH:MM) per daily e weekly, data e
+// ora (2026-01-31T03:00) per once; le durate usano la sintassi Go (30m, 1h30m).
+type Trigger struct {
+	Type string `json:"type"`
+	At   string `json:"at,omitempty"`
+	// Every e' l'intervallo in giorni (daily) o settimane (weekly), 1 se assente.
+	Every int      `json:"every,omitempty"`
+	Days  []string `json:"days,omitempty"`
+	// User limita il trigger logon all'accesso di un utente, vuoto per tutti.
+	User        string      `json:"user,omitempty"`
+	Delay       string      `json:"delay,omitempty"`
+	RandomDelay string      `json:"randomDelay,omitempty"`
+	Repeat      *Repetition `json:"repeat,omitempty"`
+	Disabled    bool        `json:"disabled,omitempty"`
+}
+
+// Repetition ripete l'attivita' ogni Interval per Duration (vuota: senza fine).
+type Repetition struct {
+	Interval string `json:"interval"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// Principal e' l'account con cui gira l'attivita'. User accetta SYSTEM
+// (predefinito), LOCAL SERVICE, NETWORK SERVICE, USERS (qualunque utente
+// connesso) o un account; LogonType vale per gli account: interactive
+// (predefinito), s4u o password.
+type Principal struct {
+	User      string `json:"user,omitempty"`
+	LogonType string `json:"logonType,omitempty"`
+	// RunLevel e' highest (privilegi elevati) o limited (predefinito).
+	RunLevel string `json:"runLevel,omitempty"`
+	// Password serve alla registrazione con logonType password e non
+	// compare nell'XML.
+	Password string `json:"password,omitempty"`
+}
+
+// Conditions limita l'avvio dell'attivita'.
+type Conditions struct {
+	IdleOnly    bool `json:"idleOnly,omitempty"`
+	NetworkOnly bool `json:"networkOnly,omitempty"`
+	ACOnly      bool `json:"acOnly,omitempty"`
+	WakeToRun   bool `json:"wakeToRun,omitempty"`
+}
+
+// Settings regola l'esecuzione. ExecutionTimeLimit vuoto vale 72h, 0 senza
+// limite; MultipleInstances e' ignore (predefinito), parallel, queue o stop.
+type Settings struct {
+	StartWhenAvailable bool   `json:"startWhenAvailable,omitempty"`
+	ExecutionTimeLimit string `json:"executionTimeLimit,omitempty"`
+	MultipleInstances  string `json:"multipleInstances,omitempty"`
+	Hidden             bool   `json:"hidden,omitempty"`
+	Disabled           bool   `json:"disabled,omitempty"`
+}
+
+// calendarDate e' la data di inizio dei trigger daily e weekly, che
+// richiedono un StartBoundary anche se conta solo l'ora.
+const calendarDate = "2000-01-01"
+
+var (
+	clockTime = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+	dateTime  = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T([01]\d|2[0-3]):[0-5]\d(:[0-5]\d)?$`)
+)
+
+var weekDays = map[string]string{
+	"mon": "Monday", "tue": "Tuesday", "wed": "Wednesday", "thu": "Thursday",
+	"fri": "Friday", "sat": "Saturday", "sun": "Sunday",
+}
+
+var dayOrder = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// wellKnown associa gli account predefiniti al loro SID.
+var wellKnown = map[string]string{
+	"SYSTEM":          "S-1-5-18",
+	"LOCAL SERVICE":   "S-1-5-19",
+	"NETWORK SERVICE": "S-1-5-20",
+	"USERS":           "S-1-5-32-545",
+}
+
+var logonTypes = map[string]string{
+	"interactive": "InteractiveToken",
+	"s4u":         "S4U",
+	"password":    "Password",
+}
+
+var instancePolicies = map[string]string{
+	"ignore":   "IgnoreNew",
+	"parallel": "Parallel",
+	"queue":    "Queue",
+	"stop":     "StopExisting",
+}
+
+// Validate controlla la definizione senza generare l'XML.
+func (t Task) Validate() error {
+	if strings.TrimSpace(t.Command) == "" {
+		return fmt.Errorf("command obbligatorio")
+	}
+	for i, tr := range t.Triggers {
+		if err := tr.validate(); err != nil {
+			return fmt.Errorf("triggers[%d] (%s): %w", i, tr.Type, err)
+		}
+	}
+
+	p := t.Principal
+	account := strings.ToUpper(p.User)
+	if _, ok := wellKnown[account]; ok || p.User == "" {
+		if p.LogonType != "" {
+			return fmt.Errorf("logonType ammesso solo per account utente")
+		}
+	} else if _, ok := logonTypes[p.LogonType]; !ok && p.LogonType != "" {
+		return fmt.Errorf("logonType sconosciuto: %s (ammessi: interactive, s4u, password)", p.LogonType)
+	}
+	if (p.LogonType == "password") != (p.Password != "") {
+		return fmt.Errorf("password richiesta solo e sempre con logonType password")
+	}
+	switch p.RunLevel {
+	case "", "limited", "highest":
+	default:
+		return fmt.Errorf("runLevel sconosciuto: %s (ammessi: highest, limited)", p.RunLevel)
+	}
+
+	if _, ok := instancePolicies[t.Settings.MultipleInstances]; !ok && t.Settings.MultipleInstances != "" {
+		return fmt.Errorf("multipleInstances sconosciuto: %s (ammessi: ignore, parallel, queue, stop)", t.Settings.MultipleInstances)
+	}
+	if t.Settings.ExecutionTimeLimit != "" {
+		if _, err := Duration(t.Settings.ExecutionTimeLimit); err != nil {
+			return fmt.Errorf("executionTimeLimit: %w", err)
+		}
+	}
+	return nil
+}
+
+func (tr Trigger) validate() error {
+	switch tr.Type {
+	case TriggerDaily, TriggerWeekly:
+		if !clockTime.MatchString(tr.At) {
+			return fmt.Errorf("at deve essere un orario HH:MM")
+		}
+	case TriggerOnce:
+		if !dateTime.MatchString(tr.At) {
+			return fmt.Errorf("at deve essere data e ora, es. 2026-01-31T03:00")
+		}
+	case TriggerLogon, TriggerBoot, TriggerIdle:
+		if tr.At != "" {
+			return fmt.Errorf("at non ammesso")
+		}
+	default:
+		return fmt.Errorf("tipo di trigger sconosciuto (ammessi: daily, weekly, once, logon, boot, idle)")
+	}
+	if tr.Every < 0 || (tr.Every > 0 && tr.Type != TriggerDaily && tr.Type != TriggerWeekly) {
+		return fmt.Errorf("every ammesso solo per daily e weekly, maggiore di 0")
+	}
+	if len(tr.Days) > 0 && tr.Type != TriggerWeekly {
+		return fmt.Errorf("days ammesso solo per weekly")
+	}
+	if tr.Type == TriggerWeekly && len(tr.Days) == 0 {
+		return fmt.Errorf("days obbligatorio per weekly (mon, tue, wed, thu, fri, sat, sun)")
+	}
+	for _, d := range tr.Days {
+		if _, ok := weekDays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("giorno sconosciuto: %s (ammessi: mon, tue, wed, thu, fri, sat, sun)", d)
+		}
+	}
+	if tr.User != "" && tr.Type != TriggerLogon {
+		return fmt.Errorf("user ammesso solo per logon")
+	}
+	if tr.Delay != "" && tr.Type != TriggerLogon && tr.Type != TriggerBoot {
+		return fmt.Errorf("delay ammesso solo per logon e boot")
+	}
+	if tr.RandomDelay != "" && tr.Type != TriggerDaily && tr.Type != TriggerWeekly && tr.Type != TriggerOnce {
+		return fmt.Errorf("randomDelay ammesso solo per daily, weekly e once")
+	}
+	for _, d := range []string{tr.Delay, tr.RandomDelay} {
+		if _, err := Duration(d); d != "" && err != nil {
+			return err
+		}
+	}
+	if tr.Repeat != nil {
+		if _, err := Duration(tr.Repeat.Interval); err != nil || tr.Repeat.Interval == "" {
+			return fmt.Errorf("repeat.interval non valido: %q", tr.Repeat.Interval)
+		}
+		if _, err := Duration(tr.Repeat.Duration); tr.Repeat.Duration != "" && err != nil {
+			return fmt.Errorf("repeat.duration: %w", err)
+		}
+	}
+	return nil
+}
+
+// Duration converte una durata Go (90m, 1h30m, 45s) nel formato ISO 8601
+// usato dall'Utilita' di pianificazione (PT1H30M).
+func Duration(s string) (string, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 || d%time.Second != 0 {
+		return "", fmt.Errorf("durata non valida: %q (es. 30s, 15m, 1h30m)", s)
+	}
+	if d == 0 {
+		return "PT0S", nil
+	}
+	var b strings.Builder
+	b.WriteString("P")
+	if days := d / (24 * time.Hour); days > 0 {
+		fmt.Fprintf(&b, "%dD", days)
+		d -= days * 24 * time.Hour
+	}
+	if d > 0 {
+		b.WriteString("T")
+	}
+	for _, u := range []struct {
+		unit time.Duration
+		name string
+	}{{time.Hour, "H"}, {time.Minute, "M"}, {time.Second, "S"}} {
+		if n := d / u.unit; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, u.name)
+			d -= n * u.unit
+		}
+	}
+	return b.String(), nil
+}
+
+// Marshal genera l'XML dell'attivita' uri (es. \WebGain\Aggiornamento),
+// con intestazione UTF-16 come le esportazioni di Windows; Encode lo converte
+// nella codifica corrispondente.
+func Marshal(uri string, t Task) (string, error) {
+	if err := t.Validate(); err != nil {
+		return "", err
+	}
+	w := &writer{}
+	w.line(0, `<?xml version="1.0" encoding="UTF-16"?>`)
+	w.line(0, `<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">`)
+
+	w.open(1, "RegistrationInfo")
+	w.elem(2, "Author", t.Author)
+	w.elem(2, "Description", t.Description)
+	w.elem(2, "URI", uri)
+	w.close(1, "RegistrationInfo")
+
+	if len(t.Triggers) == 0 {
+		w.line(1, "<Triggers />")
+	} else {
+		w.open(1, "Triggers")
+		for _, tr := range t.Triggers {
+			w.trigger(tr)
+		}
+		w.close(1, "Triggers")
+	}
+
+	w.open(1, "Principals")
+	w.line(2, `<Principal id="Author">`)
+	p := t.Principal
+	account := strings.ToUpper(p.User)
+	if account == "" {
+		account = "SYSTEM"
+	}
+	switch sid := wellKnown[account]; {
+	case account == "USERS":
+		w.elem(3, "GroupId", sid)
+	case sid != "":
+		w.elem(3, "UserId", sid)
+	default:
+		w.elem(3, "UserId", p.User)
+		logon := p.LogonType
+		if logon == "" {
+			logon = "interactive"
+		}
+		w.elem(3, "LogonType", logonTypes[logon])
+	}
+	if p.RunLevel == "highest" {
+		w.elem(3, "RunLevel", "HighestAvailable")
+	} else {
+		w.elem(3, "RunLevel", "LeastPrivilege")
+	}
+	w.close(2, "Principal")
+	w.close(1, "Principals")
+
+	s, c := t.Settings, t.Conditions
+	policy := s.MultipleInstances
+	if policy == "" {
+		policy = "ignore"
+	}
+	limit := "PT72H"
+	if s.ExecutionTimeLimit != "" {
+		limit, _ = Duration(s.ExecutionTimeLimit)
+	}
+	w.open(1, "Settings")
+	w.elem(2, "MultipleInstancesPolicy", instancePolicies[policy])
+	w.bool(2, "DisallowStartIfOnBatteries", c.ACOnly)
+	w.bool(2, "StopIfGoingOnBatteries", c.ACOnly)
+	w.bool(2, "AllowHardTerminate", true)
+	w.bool(2, "StartWhenAvailable", s.StartWhenAvailable)
+	w.bool(2, "RunOnlyIfNetworkAvailable", c.NetworkOnly)
+	w.open(2, "IdleSettings")
+	w.bool(3, "StopOnIdleEnd", c.IdleOnly)
+	w.bool(3, "RestartOnIdle", false)
+	w.close(2, "IdleSettings")
+	w.bool(2, "AllowStartOnDemand", true)
+	w.bool(2, "Enabled", !s.Disabled)
+	w.bool(2, "Hidden", s.Hidden)
+	w.bool(2, "RunOnlyIfIdle", c.IdleOnly)
+	w.bool(2, "WakeToRun", c.WakeToRun)
+	w.elem(2, "ExecutionTimeLimit", limit)
+	w.elem(2, "Priority", "7")
+	w.close(1, "Settings")
+
+	w.line(1, `<Actions Context="Author">`)
+	w.open(2, "Exec")
+	w.elem(3, "Command", t.Command)
+	w.elem(3, "Arguments", t.Arguments)
+	w.elem(3, "WorkingDirectory", t.WorkingDirectory)
+	w.close(2, "Exec")
+	w.close(1, "Actions")
+	w.line(0, "</Task>")
+	return w.String(), nil
+}
+
+func (w *writer) trigger(tr Trigger) {
+	name := map[string]string{
+		TriggerDaily:  "CalendarTrigger",
+		TriggerWeekly: "CalendarTrigger",
+		TriggerOnce:   "TimeTrigger",
+		TriggerLogon:  "LogonTrigger",
+		TriggerBoot:   "BootTrigger",
+		TriggerIdle:   "IdleTrigger",
+	}[tr.Type]
+	w.open(2, name)
+	if tr.Repeat != nil {
+		w.open(3, "Repetition")
+		interval, _ := Duration(tr.Repeat.Interval)
+		w.elem(4, "Interval", interval)
+		if tr.Repeat.Duration != "" {
+			duration, _ := Duration(tr.Repeat.Duration)
+			w.elem(4, "Duration", duration)
+		}
+		w.bool(4, "StopAtDurationEnd", false)
+		w.close(3, "Repetition")
+	}
+	switch tr.Type {
+	case TriggerDaily, TriggerWeekly:
+		w.elem(3, "StartBoundary", calendarDate+"T"+tr.At+":00")
+	case TriggerOnce:
+		at := tr.At
+		if len(at) == len("2006-01-02T15:04") {
+			at += ":00"
+		}
+		w.elem(3, "StartBoundary", at)
+	}
+	w.bool(3, "Enabled", !tr.Disabled)
+	if tr.RandomDelay != "" {
+		d, _ := Duration(tr.RandomDelay)
+		w.elem(3, "RandomDelay", d)
+	}
+	every := tr.Every
+	if every == 0 {
+		every = 1
+	}
+	switch tr.Type {
+	case TriggerDaily:
+		w.open(3, "ScheduleByDay")
+		w.elem(4, "DaysInterval", fmt.Sprint(every))
+		w.close(3, "ScheduleByDay")
+	case TriggerWeekly:
+		w.open(3, "ScheduleByWeek")
+		w.open(4, "DaysOfWeek")
+		for _, d := range dayOrder {
+			for _, want := range tr.Days {
+				if strings.ToLower(want) == d {
+					w.line(5, "<"+weekDays[d]+" />")
+					break
+				}
+			}
+		}
+		w.close(4, "DaysOfWeek")
+		w.elem(4, "WeeksInterval", fmt.Sprint(every))
+		w.close(3, "ScheduleByWeek")
+	case TriggerLogon:
+		w.elem(3, "UserId", tr.User)
+	}
+	if tr.Delay != "" {
+		d, _ := Duration(tr.Delay)
+		w.elem(3, "Delay", d)
+	}
+	w.close(2, name)
+}
+
+// Encode converte l'XML in UTF-16 little endian con BOM, la codifica
+// dichiarata nell'intestazione e attesa da schtasks /XML.
+func Encode(doc string) []byte {
+	doc = strings.ReplaceAll(doc, "\n", "\r\n")
+	units := utf16.Encode([]rune(doc))
+	out := make([]byte, 2, 2+2*len(units))
+	out[0], out[1] = 0xFF, 0xFE
+	for _, u := range units {
+		out = append(out, byte(u), byte(u>>8))
+	}
+	return out
+}
+
+type writer struct {
+	strings.Builder
+}
+
+func (w *writer) line(depth int, s string) {
+	w.WriteString(strings.Repeat("  ", depth))
+	w.WriteString(s)
+	w.WriteString("\n")
+}
+
+func (w *writer) open(depth int, name string) {
+	w.line(depth, "<"+name+">")
+}
+
+func (w *writer) close(depth int, name string) {
+	w.line(depth, "</"+name+">")
+}
+
+// elem scrive un elemento di solo testo; i valori vuoti vengono omessi.
+func (w *writer) elem(depth int, name, value string) {
+	if value == "" {
+		return
+	}
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	w.line(depth, "<"+name+">"+b.String()+"</"+name+">")
+}
+
+func (w *writer) bool(depth int, name string, value bool) {
+	w.elem(depth, name, fmt.Sprint(value))
+}
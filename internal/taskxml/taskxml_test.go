@@ -0,0 +1,140 @@
+package taskxml
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+var update = flag.Bool("update", false, "riscrive i file di riferimento in testdata")
+
+func TestMarshalGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		task Task
+	}{
+		{"daily", Task{
+			Description: "Pulizia notturna",
+			Command:     `C:\Tools\clean.exe`,
+			Arguments:   `--all "C:\Temp"`,
+			Triggers:    []Trigger{{Type: TriggerDaily, At: "03:00", Every: 2, RandomDelay: "15m"}},
+		}},
+		{"weekly", Task{
+			Command:   `C:\Tools\report.exe`,
+			Triggers:  []Trigger{{Type: TriggerWeekly, At: "08:30", Days: []string{"fri", "MON"}, Repeat: &Repetition{Interval: "1h", Duration: "8h"}}},
+			Principal: Principal{User: "users"},
+			Settings:  Settings{MultipleInstances: "queue", ExecutionTimeLimit: "0s"},
+		}},
+		{"once", Task{
+			Command:    `C:\Tools\migrate.exe`,
+			Triggers:   []Trigger{{Type: TriggerOnce, At: "2026-01-31T03:00"}},
+			Principal:  Principal{User: "NETWORK SERVICE"},
+			Conditions: Conditions{NetworkOnly: true, WakeToRun: true},
+			Settings:   Settings{StartWhenAvailable: true, ExecutionTimeLimit: "1h30m"},
+		}},
+		{"logon", Task{
+			Command:          `C:\Tools\agent.exe`,
+			WorkingDirectory: `C:\Tools`,
+			Triggers:         []Trigger{{Type: TriggerLogon, User: `CORP\dev`, Delay: "30s", Repeat: &Repetition{Interval: "15m"}}},
+			Principal:        Principal{User: `CORP\svc-build`, LogonType: "password", Password: "s3gr3t0!", RunLevel: "highest"},
+			Settings:         Settings{Hidden: true},
+		}},
+		{"boot", Task{
+			Command:    `C:\Tools\watchdog.exe`,
+			Triggers:   []Trigger{{Type: TriggerBoot, Delay: "2m"}, {Type: TriggerIdle, Disabled: true}},
+			Principal:  Principal{User: "SYSTEM", RunLevel: "highest"},
+			Conditions: Conditions{ACOnly: true, IdleOnly: true},
+			Settings:   Settings{Disabled: true, MultipleInstances: "stop"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(`\WebGain\`+tt.name, tt.task)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", tt.name+".xml")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("XML diverso da %s:\n%s", golden, got)
+			}
+			if p := tt.task.Principal.Password; p != "" && strings.Contains(got, p) {
+				t.Errorf("la password compare nell'XML")
+			}
+		})
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		task Task
+		want string
+	}{
+		{"senza comando", Task{}, "command obbligatorio"},
+		{"daily senza ora", Task{Command: "x", Triggers: []Trigger{{Type: TriggerDaily}}}, "HH:MM"},
+		{"weekly senza giorni", Task{Command: "x", Triggers: []Trigger{{Type: TriggerWeekly, At: "10:00"}}}, "days obbligatorio"},
+		{"giorno sconosciuto", Task{Command: "x", Triggers: []Trigger{{Type: TriggerWeekly, At: "10:00", Days: []string{"lun"}}}}, "giorno sconosciuto"},
+		{"once senza data", Task{Command: "x", Triggers: []Trigger{{Type: TriggerOnce, At: "10:00"}}}, "data e ora"},
+		{"delay su daily", Task{Command: "x", Triggers: []Trigger{{Type: TriggerDaily, At: "10:00", Delay: "1m"}}}, "delay ammesso solo"},
+		{"repeat senza intervallo", Task{Command: "x", Triggers: []Trigger{{Type: TriggerBoot, Repeat: &Repetition{}}}}, "repeat.interval"},
+		{"logonType per SYSTEM", Task{Command: "x", Principal: Principal{User: "SYSTEM", LogonType: "s4u"}}, "logonType ammesso solo"},
+		{"password senza logonType", Task{Command: "x", Principal: Principal{User: "dev", Password: "p"}}, "password richiesta"},
+		{"logonType password senza password", Task{Command: "x", Principal: Principal{User: "dev", LogonType: "password"}}, "password richiesta"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.task.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("errore = %v, atteso %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := map[string]string{
+		"0s":    "PT0S",
+		"45s":   "PT45S",
+		"90m":   "PT1H30M",
+		"1h30m": "PT1H30M",
+		"49h":   "P2DT1H",
+		"48h":   "P2D",
+	}
+	for in, want := range tests {
+		if got, err := Duration(in); err != nil || got != want {
+			t.Errorf("Duration(%q) = %q, %v; atteso %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "-1m", "1.5s", "10"} {
+		if _, err := Duration(in); err == nil {
+			t.Errorf("Duration(%q) senza errore", in)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	got := Encode("<a>è</a>\n")
+	if !bytes.HasPrefix(got, []byte{0xFF, 0xFE}) {
+		t.Fatalf("BOM UTF-16LE mancante: % x", got[:2])
+	}
+	units := make([]uint16, 0, len(got)/2-1)
+	for i := 2; i+1 < len(got); i += 2 {
+		units = append(units, uint16(got[i])|uint16(got[i+1])<<8)
+	}
+	if s := string(utf16.Decode(units)); s != "<a>è</a>\r\n" {
+		t.Errorf("decodificato %q", s)
+	}
+}
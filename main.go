@@ -2,14 +2,22 @@ package main
 
 import (
 	"embed"
+	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
+	"os"
 	"strings"
+	"syscall"
+	"unsafe"
 
 	"WebGainInstaller/internal/admin"
+	"WebGainInstaller/internal/engine"
 	"WebGainInstaller/internal/font"
+	"WebGainInstaller/internal/logger"
 	"WebGainInstaller/internal/screen"
+	"WebGainInstaller/internal/setup"
+	"WebGainInstaller/internal/support"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -29,7 +37,21 @@ var mediaFS embed.FS
 //go:embed config/*
 var configFS embed.FS
 
+//go:embed all:module
+var moduleFS embed.FS
+
 func main() {
+	if dest, ok := supportBundleArg(os.Args[1:]); ok {
+		os.Exit(runSupportBundle(dest))
+	}
+	if only, ok := auditArg(os.Args[1:]); ok {
+		os.Exit(runAudit(only))
+	}
+	if folder, ok := uninstallArg(os.Args[1:]); ok {
+		admin.RequireAdmin()
+		os.Exit(runUninstall(folder, hasArg(os.Args[1:], "quiet")))
+	}
+
 	admin.RequireAdmin()
 
 	fontSubFS, err := fs.Sub(fontFS, "font")
@@ -43,7 +65,8 @@ func main() {
 	winW, winH := screen.CalculateWindowSize(1150, 900)
 
 	configSubFS, _ := fs.Sub(configFS, "config")
-	app := NewApp(configSubFS)
+	moduleSubFS, _ := fs.Sub(moduleFS, "module")
+	app := NewApp(configSubFS, moduleSubFS)
 
 	mediaSubFS, _ := fs.Sub(mediaFS, "media")
 	mediaHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -93,3 +116,175 @@ func main() {
 		log.Fatal("Errore avvio applicazione: " + err.Error())
 	}
 }
+
+// supportBundleArg cerca -support-bundle <percorso> (o --support-bundle=<percorso>)
+// senza usare flag.Parse, che rifiuterebbe gli argomenti passati da Wails.
+func supportBundleArg(args []string) (string, bool) {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "support-bundle" {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		if value == "" {
+			value = "WebGain-supporto.zip"
+		}
+		return value, true
+	}
+	return "", false
+}
+
+// runSupportBundle crea il pacchetto di supporto da riga di comando, senza
+// interfaccia ne' privilegi di amministratore.
+func runSupportBundle(dest string) int {
+	configSubFS, _ := fs.Sub(configFS, "config")
+	setup.RegisterSecrets(configSubFS)
+
+	err := support.CreateBundle(dest, support.Info{
+		LogDir:    setup.PersistentDir("logs"),
+		CacheDir:  setup.PersistentDir("cache"),
+		ReportDir: setup.PersistentDir("reports"),
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(dest)
+	return 0
+}
+
+// auditArg cerca -audit (tutti i moduli) o -audit=<modulo>; il valore e'
+// opzionale, quindi l'argomento successivo non viene mai consumato.
+func auditArg(args []string) (string, bool) {
+	for _, arg := range args {
+		name, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && name == "audit" {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// runAudit legge le definizioni dei moduli senza accedere alla rete ed esegue
+// solo i loro step verify, senza interfaccia. Stampa l'esito dei moduli ed esce con 1 se
+// almeno un controllo non e' superato.
+func runAudit(only string) int {
+	configSubFS, _ := fs.Sub(configFS, "config")
+	moduleSubFS, _ := fs.Sub(moduleFS, "module")
+	setup.RegisterSecrets(configSubFS)
+
+	fail := func(err error) int {
+		logger.Error("Verifica postazione fallita: %v", err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	root, err := setup.PrepareRoot()
+	if err != nil {
+		return fail(err)
+	}
+	logOpts := setup.LoggingOptions(configSubFS)
+	logOpts.Dir = setup.PersistentDir("logs")
+	if err := logger.Init(root, logOpts); err != nil {
+		log.Printf("Impossibile inizializzare log: %v", err)
+	}
+	defer logger.Close()
+
+	installFS, err := setup.OfflineModules(configSubFS, moduleSubFS, root)
+	if err != nil {
+		return fail(err)
+	}
+	eng, err := engine.New(installFS, nil)
+	if err != nil {
+		return fail(err)
+	}
+
+	report, err := eng.Audit(only)
+	if report == nil {
+		return fail(err)
+	}
+	for _, m := range report.Modules {
+		fmt.Printf("%s: %s\n", m.Name, m.Status)
+		for _, s := range m.Steps {
+			for _, c := range s.Checks {
+				if !c.Passed {
+					fmt.Printf("  KO %s %s: %s\n", c.Type, c.Name, c.Detail)
+				}
+			}
+			if s.Status == engine.StepStatusFailed && len(s.Checks) == 0 {
+				fmt.Printf("  KO step %d: %s\n", s.Index, s.Error)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// uninstallArg cerca -uninstall <modulo> (o -uninstall=<modulo>), usato da
+// UninstallString delle voci registrate in App installate.
+func uninstallArg(args []string) (string, bool) {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "uninstall" {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		return value, true
+	}
+	return "", false
+}
+
+func hasArg(args []string, name string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && strings.TrimLeft(arg, "-") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runUninstall disinstalla un modulo da App installate. Senza quiet chiede
+// conferma e mostra l'esito in una finestra di messaggio.
+func runUninstall(folder string, quiet bool) int {
+	configSubFS, _ := fs.Sub(configFS, "config")
+	setup.RegisterSecrets(configSubFS)
+	logOpts := setup.LoggingOptions(configSubFS)
+	logOpts.Dir = setup.PersistentDir("logs")
+	if err := logger.Init("", logOpts); err != nil {
+		log.Printf("Impossibile inizializzare log: %v", err)
+	}
+	defer logger.Close()
+
+	if folder == "" {
+		logger.Error("Disinstallazione: modulo non indicato")
+		return 1
+	}
+	if !quiet && messageBox("Disinstallare il modulo "+folder+"?", mbYesNo|mbIconWarning) != idYes {
+		logger.Info("Disinstallazione del modulo %s annullata", folder)
+		return 1
+	}
+	if err := engine.Uninstall(folder); err != nil {
+		logger.Error("%v", err)
+		if !quiet {
+			messageBox(fmt.Sprintf("Disinstallazione non riuscita: %v\n\nLog: %s", err, logger.Path()), mbOK|mbIconError)
+		}
+		return 1
+	}
+	if !quiet {
+		messageBox("Modulo "+folder+" disinstallato.", mbOK|mbIconInfo)
+	}
+	return 0
+}
+
+func messageBox(text string, flags uintptr) int {
+	title, _ := syscall.UTF16PtrFromString("WebGain Installer")
+	msg, _ := syscall.UTF16PtrFromString(text)
+	ret, _, _ := procMessageBoxW.Call(0, uintptr(unsafe.Pointer(msg)), uintptr(unsafe.Pointer(title)), flags)
+	return int(ret)
+}
@@ -34,7 +34,7 @@ if exist "%TEMP%\path_refresh.txt" (
 )
 echo.
 
-echo [1/6] Pulizia e preparazione build...
+echo [1/7] Pulizia e preparazione build...
 if exist "build" (
     rmdir /s /q "build"
 )
@@ -45,7 +45,7 @@ powershell -NoProfile -ExecutionPolicy Bypass -File "%~dp0scripts\init_build.ps1
 echo       Completato.
 echo.
 
-echo [2/6] Verifica strumenti di build...
+echo [2/7] Verifica strumenti di build...
 set "toolsOk=1"
 where go >nul 2>&1 || (
     echo       [!!] go non trovato
@@ -73,7 +73,7 @@ if "!toolsOk!"=="0" (
 echo       Tutti gli strumenti presenti.
 echo.
 
-echo [3/6] Verifica dipendenze Go...
+echo [3/7] Verifica dipendenze Go...
 call go mod tidy
 if !errorlevel! neq 0 (
     echo ERRORE: go mod tidy fallito.
@@ -82,7 +82,7 @@ if !errorlevel! neq 0 (
 echo       Completato.
 echo.
 
-echo [4/6] Verifica dipendenze frontend...
+echo [4/7] Verifica dipendenze frontend...
 set "NEED_NPM=1"
 
 if exist "frontend\package.json" if exist "frontend\package-lock.json" if exist "frontend\node_modules" (
@@ -118,11 +118,24 @@ if "!NEED_NPM!"=="1" (
 )
 echo.
 
+echo [5/7] Generazione manifest dei moduli embedded...
+for /d %%M in ("module\*") do (
+    if exist "%%M\command.json" (
+        call go run ./cmd/webgain-pack -manifest "%%M"
+        if !errorlevel! neq 0 (
+            echo ERRORE: manifest del modulo %%~nxM non generato.
+            exit /b 1
+        )
+    )
+)
+echo       Completato.
+echo.
+
 if "!DEV_MODE!"=="1" (
-    echo [5/6] Compilazione sviluppo...
+    echo [6/7] Compilazione sviluppo...
     call wails build -platform windows/amd64 -ldflags "-s -w -X main.devMode=true" -trimpath -clean
 ) else (
-    echo [5/6] Compilazione produzione con offuscamento e compressione...
+    echo [6/7] Compilazione produzione con offuscamento e compressione...
     call wails build -platform windows/amd64 -ldflags "-s -w" -trimpath -clean -obfuscated -upx -upxflags "--best"
 )
 if !errorlevel! neq 0 (
@@ -132,7 +145,7 @@ if !errorlevel! neq 0 (
 echo       Completato.
 echo.
 
-echo [6/6] Verifica eseguibile...
+echo [7/7] Verifica eseguibile...
 if not exist "build\bin\WebGainInstaller.exe" (
     echo ERRORE: eseguibile non trovato!
     exit /b 1